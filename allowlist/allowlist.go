@@ -0,0 +1,142 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package allowlist restricts the AWS partitions and accounts whose IAM
+// principals mappings may grant cluster access to.
+package allowlist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// Partitions are the AWS partitions an Allowlist may allow.
+var Partitions = []string{"aws", "aws-cn", "aws-us-gov"}
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Allowlist lists the AWS partitions and accounts of IAM principals that may
+// be mapped. Empty lists allow any partition or account.
+type Allowlist struct {
+	// Partitions are the allowed AWS partitions.
+	Partitions []string `yaml:"partitions"`
+
+	// Accounts are the IDs of the AWS accounts allowed for every group.
+	Accounts []string `yaml:"accounts"`
+
+	// Groups further restricts, by group, the IDs of the AWS accounts whose
+	// principals may be assigned the group.
+	Groups map[string][]string `yaml:"groups"`
+}
+
+// Load reads an Allowlist from the YAML file at path.
+func Load(path string) (*Allowlist, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var allowlist Allowlist
+	if err := yaml.UnmarshalStrict(data, &allowlist); err != nil {
+		return nil, fmt.Errorf("allowlist %s: %w", path, err)
+	}
+	if err := allowlist.validate(); err != nil {
+		return nil, fmt.Errorf("allowlist %s: %w", path, err)
+	}
+	return &allowlist, nil
+}
+
+// validate returns an error if the allowlist names unknown partitions or
+// malformed account IDs.
+func (a *Allowlist) validate() error {
+	for _, partition := range a.Partitions {
+		if !contains(Partitions, partition) {
+			return fmt.Errorf("unknown partition %s", partition)
+		}
+	}
+	accounts := append([]string(nil), a.Accounts...)
+	for _, groupAccounts := range a.Groups {
+		accounts = append(accounts, groupAccounts...)
+	}
+	for _, account := range accounts {
+		if !accountIDPattern.MatchString(account) {
+			return fmt.Errorf("malformed account ID %s", account)
+		}
+	}
+	return nil
+}
+
+// Check returns an error describing why the principal with the ARN may not be
+// assigned groups, or nil if it may. A nil Allowlist allows every principal.
+func (a *Allowlist) Check(principalARN string, groups []string) error {
+	if a == nil {
+		return nil
+	}
+	parsed, err := arn.Parse(principalARN)
+	if err != nil {
+		return err
+	}
+	if len(a.Partitions) > 0 && !contains(a.Partitions, parsed.Partition) {
+		return fmt.Errorf("partition %s of %s is not allowed", parsed.Partition, principalARN)
+	}
+	return a.checkAccount(parsed.AccountID, " of "+principalARN, groups)
+}
+
+// CheckAccount returns an error describing why the principals of the AWS
+// account may not be assigned groups, or nil if they may, for mappings whose
+// principal is not known until it is resolved. A nil Allowlist allows every
+// account.
+func (a *Allowlist) CheckAccount(accountID string, groups []string) error {
+	if a == nil {
+		return nil
+	}
+	return a.checkAccount(accountID, "", groups)
+}
+
+// checkAccount checks an account, describing the principal it is the account
+// of, if known, by of.
+func (a *Allowlist) checkAccount(accountID, of string, groups []string) error {
+	if len(a.Accounts) > 0 && !contains(a.Accounts, accountID) {
+		return fmt.Errorf("account %s%s is not allowed", accountID, of)
+	}
+	var denied []string
+	for _, group := range groups {
+		if groupAccounts, ok := a.Groups[group]; ok && !contains(groupAccounts, accountID) {
+			denied = append(denied, group)
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("account %s%s is not allowed groups %s", accountID, of, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// contains returns whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package allowlist
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestLoad(t *testing.T) {
+	g := gomega.NewWithT(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "allowlist.yaml")
+
+	g.Expect(ioutil.WriteFile(path, []byte(`
+partitions: [aws]
+accounts: ["123456789012", "210987654321"]
+groups:
+  system:masters: ["123456789012"]
+`), 0o600)).To(gomega.Succeed())
+	allowlist, err := Load(path)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(allowlist).To(gomega.Equal(&Allowlist{
+		Partitions: []string{"aws"},
+		Accounts:   []string{"123456789012", "210987654321"},
+		Groups:     map[string][]string{"system:masters": {"123456789012"}},
+	}))
+
+	g.Expect(ioutil.WriteFile(path, []byte("partitions: [aws-iso]\n"), 0o600)).To(gomega.Succeed())
+	_, err = Load(path)
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("unknown partition aws-iso")))
+
+	g.Expect(ioutil.WriteFile(path, []byte("accounts: [\"1234\"]\n"), 0o600)).To(gomega.Succeed())
+	_, err = Load(path)
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("malformed account ID 1234")))
+
+	g.Expect(ioutil.WriteFile(path, []byte("account: [\"123456789012\"]\n"), 0o600)).To(gomega.Succeed())
+	_, err = Load(path)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestAllowlist_Check(t *testing.T) {
+	g := gomega.NewWithT(t)
+	allowlist := &Allowlist{
+		Partitions: []string{"aws", "aws-us-gov"},
+		Accounts:   []string{"123456789012", "210987654321"},
+		Groups:     map[string][]string{"system:masters": {"123456789012"}},
+	}
+
+	g.Expect(allowlist.Check("arn:aws:iam::123456789012:role/admin", []string{"system:masters"})).To(gomega.Succeed())
+	g.Expect(allowlist.Check("arn:aws-us-gov:iam::210987654321:user/alice", []string{"view"})).To(gomega.Succeed())
+	g.Expect(allowlist.Check("arn:aws-cn:iam::123456789012:role/admin", nil)).To(gomega.MatchError(
+		"partition aws-cn of arn:aws-cn:iam::123456789012:role/admin is not allowed"))
+	g.Expect(allowlist.Check("arn:aws:iam::999999999999:role/vendor", nil)).To(gomega.MatchError(
+		"account 999999999999 of arn:aws:iam::999999999999:role/vendor is not allowed"))
+	g.Expect(allowlist.Check("arn:aws:iam::210987654321:role/ops", []string{"view", "system:masters"})).To(gomega.MatchError(
+		"account 210987654321 of arn:aws:iam::210987654321:role/ops is not allowed groups system:masters"))
+	g.Expect(allowlist.Check("not-an-arn", nil)).To(gomega.MatchError("malformed ARN not-an-arn"))
+
+	// A nil allowlist allows every principal.
+	var none *Allowlist
+	g.Expect(none.Check("arn:aws:iam::999999999999:role/vendor", []string{"system:masters"})).To(gomega.Succeed())
+}
+
+func TestAllowlist_CheckAccount(t *testing.T) {
+	g := gomega.NewWithT(t)
+	allowlist := &Allowlist{
+		Partitions: []string{"aws"},
+		Accounts:   []string{"123456789012", "210987654321"},
+		Groups:     map[string][]string{"system:masters": {"123456789012"}},
+	}
+
+	g.Expect(allowlist.CheckAccount("123456789012", []string{"system:masters"})).To(gomega.Succeed())
+	g.Expect(allowlist.CheckAccount("999999999999", nil)).To(gomega.MatchError("account 999999999999 is not allowed"))
+	g.Expect(allowlist.CheckAccount("210987654321", []string{"system:masters"})).To(gomega.MatchError(
+		"account 210987654321 is not allowed groups system:masters"))
+
+	var none *Allowlist
+	g.Expect(none.CheckAccount("999999999999", []string{"system:masters"})).To(gomega.Succeed())
+}
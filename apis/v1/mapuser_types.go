@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MapUserSpec defines the desired state of MapUser
+type MapUserSpec struct {
+	// The ARN of the IAM user to map
+	UserARN string `json:"userARN"`
+
+	// The Kubernetes groups to associate with the MapUser
+	// +kubebuilder:validation:Optional
+	Groups []string `json:"groups,omitempty"`
+
+	// A useful description of the MapUser
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+
+	// The email address of a contact person for the MapUser
+	// +kubebuilder:validation:Optional
+	Email string `json:"email,omitempty"`
+
+	// Bounds when the MapUser is present in aws-auth
+	// +kubebuilder:validation:Optional
+	Window *AccessWindow `json:"window,omitempty"`
+
+	// The ClusterRoles bound to the MapUser groups while it is present in aws-auth
+	// +kubebuilder:validation:Optional
+	RBAC []RBACBinding `json:"rbac,omitempty"`
+
+	// Selects the managed clusters the MapUser is synced to when the operator
+	// runs in hub mode, instead of the local cluster
+	// +kubebuilder:validation:Optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// The EKS access policies associated with the MapUser when it is stored as
+	// an EKS access entry
+	// +kubebuilder:validation:Optional
+	AccessPolicies []AccessPolicy `json:"accessPolicies,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:storageversion
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="User ARN",type=string,JSONPath=`.spec.userARN`
+//+kubebuilder:printcolumn:name="Groups",type=string,JSONPath=`.spec.groups`
+//+kubebuilder:printcolumn:name="Email",type=string,JSONPath=`.spec.email`
+//+kubebuilder:printcolumn:name="Description",type=string,JSONPath=`.spec.description`
+//+kubebuilder:printcolumn:name="Expires",type=string,format=date-time,JSONPath=`.spec.window.expiresAt`
+//+kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.conditions[?(@.type=="Active")].status`
+
+// MapUser is the Schema for the MapUser API. Its name is its aws-auth username.
+type MapUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MapUserSpec   `json:"spec,omitempty"`
+	Status MappingStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MapUserList contains a list of MapUser
+type MapUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MapUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MapUser{}, &MapUserList{})
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+)
+
+// SetupConversionWebhookWithManager registers the webhook converting MapRole
+// and MapUser objects between their versions with the manager. Every version
+// must be registered with the manager's scheme.
+func SetupConversionWebhookWithManager(mgr ctrlruntime.Manager) error {
+	if err := ctrlruntime.NewWebhookManagedBy(mgr).For(&MapRole{}).Complete(); err != nil {
+		return err
+	}
+	return ctrlruntime.NewWebhookManagedBy(mgr).For(&MapUser{}).Complete()
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessApprovalSpec defines the desired state of AccessApproval
+type AccessApprovalSpec struct {
+	// The kind of the approved mapping
+	// +kubebuilder:validation:Enum=MapRole;MapUser;NamespacedMapRole;PermissionSetMapping
+	Kind string `json:"kind"`
+
+	// The namespace of the approved mapping, if it is a NamespacedMapRole
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// The name of the approved mapping
+	Name string `json:"name"`
+
+	// The Role or User ARN of the approved mapping, which is the role
+	// currently provisioned for the permission set of a PermissionSetMapping
+	ARN string `json:"arn"`
+
+	// The Kubernetes groups of the approved mapping
+	// +kubebuilder:validation:Optional
+	Groups []string `json:"groups"`
+
+	// The RBAC bindings of the approved mapping, as in its spec.rbac
+	// +kubebuilder:validation:Optional
+	RBAC []RBACBinding `json:"rbac,omitempty"`
+}
+
+// AccessApprovalStatus defines the observed state of AccessApproval
+type AccessApprovalStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.kind`
+//+kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.namespace`
+//+kubebuilder:printcolumn:name="Name",type=string,JSONPath=`.spec.name`
+//+kubebuilder:printcolumn:name="ARN",type=string,JSONPath=`.spec.arn`
+//+kubebuilder:printcolumn:name="Groups",type=string,JSONPath=`.spec.groups`
+//+kubebuilder:printcolumn:name="Approved By",type=string,JSONPath=`.metadata.annotations.aws-auth\.samba\.tv/requested-by`
+
+// AccessApproval is the Schema for the AccessApproval API. It approves a
+// mapping with the given ARN, groups and RBAC bindings on behalf of the identity that last
+// changed its spec.
+type AccessApproval struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AccessApprovalSpec   `json:"spec,omitempty"`
+	Status AccessApprovalStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AccessApprovalList contains a list of AccessApproval
+type AccessApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AccessApproval `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessApproval{}, &AccessApprovalList{})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/sambatv/aws-auth-operator/allowlist"
+)
+
+// AllowlistWebhookPath is the path the allowlist webhook is served at.
+const AllowlistWebhookPath = "/validate-aws-auth-samba-tv-v1beta1-accounts"
+
+//+kubebuilder:webhook:path=/validate-aws-auth-samba-tv-v1beta1-accounts,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws-auth.samba.tv,resources=maproles;mapusers;namespacedmaproles;permissionsetmappings,verbs=create;update,versions=v1beta1,name=vaccounts.aws-auth.samba.tv,admissionReviewVersions={v1,v1beta1}
+
+// SetupAllowlistWebhookWithManager registers the allowlist webhook with the
+// manager, rejecting mappings of principals the allowlist does not allow. A
+// nil allowlist allows every principal.
+func SetupAllowlistWebhookWithManager(mgr ctrlruntime.Manager, allowlist *allowlist.Allowlist) {
+	mgr.GetWebhookServer().Register(AllowlistWebhookPath, &webhook.Admission{Handler: &AllowlistValidator{
+		Allowlist: allowlist,
+	}})
+}
+
+//+kubebuilder:object:generate=false
+
+// AllowlistValidator is an admission handler checking that the principal of a
+// mapping is in an allowed AWS partition and account.
+type AllowlistValidator struct {
+	Allowlist *allowlist.Allowlist
+}
+
+// Handle implements admission.Handler.
+func (v *AllowlistValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	var obj struct {
+		Spec struct {
+			RoleARN   string   `json:"rolearn"`
+			UserARN   string   `json:"userarn"`
+			AccountID string   `json:"accountId"`
+			Groups    []string `json:"groups"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The role of a PermissionSetMapping is only known once resolved, so
+	// only its account is checked here.
+	var err error
+	switch {
+	case obj.Spec.AccountID != "":
+		err = v.Allowlist.CheckAccount(obj.Spec.AccountID, obj.Spec.Groups)
+	case obj.Spec.RoleARN != "":
+		err = v.Allowlist.Check(obj.Spec.RoleARN, obj.Spec.Groups)
+	default:
+		err = v.Allowlist.Check(obj.Spec.UserARN, obj.Spec.Groups)
+	}
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
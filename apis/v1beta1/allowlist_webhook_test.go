@@ -0,0 +1,67 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/sambatv/aws-auth-operator/allowlist"
+)
+
+func TestAllowlistValidator(t *testing.T) {
+	g := gomega.NewWithT(t)
+	validator := &AllowlistValidator{Allowlist: &allowlist.Allowlist{
+		Partitions: []string{"aws"},
+		Accounts:   []string{"123456789012"},
+	}}
+	newRequest := func(obj interface{}) admission.Request {
+		raw, err := json.Marshal(obj)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    pkgruntime.RawExtension{Raw: raw},
+		}}
+	}
+
+	resp := validator.Handle(context.Background(), newRequest(&MapRole{Spec: MapRoleSpec{RoleARN: "arn:aws:iam::123456789012:role/admin"}}))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+
+	resp = validator.Handle(context.Background(), newRequest(&MapUser{Spec: MapUserSpec{UserARN: "arn:aws:iam::123456789012:user/alice"}}))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+
+	resp = validator.Handle(context.Background(), newRequest(&MapRole{Spec: MapRoleSpec{RoleARN: "arn:aws:iam::999999999999:role/vendor"}}))
+	g.Expect(resp.Allowed).To(gomega.BeFalse())
+	g.Expect(string(resp.Result.Reason)).To(gomega.ContainSubstring("account 999999999999"))
+
+	resp = validator.Handle(context.Background(), newRequest(&NamespacedMapRole{Spec: NamespacedMapRoleSpec{RoleARN: "arn:aws-cn:iam::123456789012:role/team"}}))
+	g.Expect(resp.Allowed).To(gomega.BeFalse())
+	g.Expect(string(resp.Result.Reason)).To(gomega.ContainSubstring("partition aws-cn"))
+
+	resp = validator.Handle(context.Background(), newRequest(&PermissionSetMapping{Spec: PermissionSetMappingSpec{AccountID: "123456789012", PermissionSetName: "ReadOnly"}}))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+
+	resp = validator.Handle(context.Background(), newRequest(&PermissionSetMapping{Spec: PermissionSetMappingSpec{AccountID: "999999999999", PermissionSetName: "ReadOnly"}}))
+	g.Expect(resp.Allowed).To(gomega.BeFalse())
+	g.Expect(string(resp.Result.Reason)).To(gomega.ContainSubstring("account 999999999999"))
+}
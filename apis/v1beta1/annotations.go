@@ -0,0 +1,40 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+const (
+	// CreatedByAnnotation records the identity that created an object. It is
+	// set by the creator admission webhook and cannot be changed afterwards.
+	CreatedByAnnotation = "aws-auth.samba.tv/created-by"
+
+	// RequestedByAnnotation records the identity that last changed an object's
+	// spec. It is set by the creator admission webhook.
+	RequestedByAnnotation = "aws-auth.samba.tv/requested-by"
+
+	// ApprovalAnnotation holds a signed approval of a mapping in the form
+	// "<approver>:<base64 signature>".
+	ApprovalAnnotation = "aws-auth.samba.tv/approval"
+
+	// RepairedAtAnnotation records when kubectl aws-auth repair last rebuilt
+	// the aws-auth ConfigMap, changing it to requeue the object so that its
+	// entry is rewritten.
+	RepairedAtAnnotation = "aws-auth.samba.tv/repaired-at"
+)
+
+// OwnerKindLabel records the kind of the mapping that generated an object,
+// such as the RBAC bindings of a MapRole.
+const OwnerKindLabel = "aws-auth.samba.tv/owner-kind"
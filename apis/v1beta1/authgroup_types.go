@@ -0,0 +1,103 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AuthGroupSpec defines the desired state of AuthGroup
+type AuthGroupSpec struct {
+	// The Kubernetes group mappings may assign
+	Group string `json:"group"`
+
+	// A useful description of what the group grants
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+
+	// The contacts responsible for the group
+	// +kubebuilder:validation:Optional
+	Owners []string `json:"owners,omitempty"`
+
+	// How sensitive the access granted by the group is
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Low;Medium;High;Critical
+	// +kubebuilder:default=Low
+	Sensitivity string `json:"sensitivity,omitempty"`
+}
+
+// AuthGroupStatus defines the observed state of AuthGroup
+type AuthGroupStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Group",type=string,JSONPath=`.spec.group`
+//+kubebuilder:printcolumn:name="Sensitivity",type=string,JSONPath=`.spec.sensitivity`
+//+kubebuilder:printcolumn:name="Owners",type=string,JSONPath=`.spec.owners`
+//+kubebuilder:printcolumn:name="Description",type=string,JSONPath=`.spec.description`
+
+// AuthGroup is the Schema for the AuthGroup API. It catalogs a Kubernetes
+// group that mappings may assign.
+type AuthGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AuthGroupSpec   `json:"spec,omitempty"`
+	Status AuthGroupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AuthGroupList contains a list of AuthGroup
+type AuthGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AuthGroup `json:"items"`
+}
+
+// Resolve returns the names of the AuthGroup objects cataloging groups, and
+// the groups not cataloged by any of them.
+func (l *AuthGroupList) Resolve(groups []string) (catalog []string, unknown []string) {
+	byGroup := map[string][]string{}
+	for _, authGroup := range l.Items {
+		byGroup[authGroup.Spec.Group] = append(byGroup[authGroup.Spec.Group], authGroup.Name)
+	}
+	seen := map[string]bool{}
+	for _, group := range groups {
+		names, ok := byGroup[group]
+		if !ok {
+			unknown = append(unknown, group)
+			continue
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				catalog = append(catalog, name)
+			}
+		}
+	}
+	sort.Strings(catalog)
+	return catalog, unknown
+}
+
+func init() {
+	SchemeBuilder.Register(&AuthGroup{}, &AuthGroupList{})
+}
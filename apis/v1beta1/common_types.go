@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// AccessSchedule defines recurring windows during which a mapping is present
+// in the aws-auth ConfigMap. A window opens at each time matching Start and
+// closes at the next time matching End.
+type AccessSchedule struct {
+	// The cron expression matching the times access windows open
+	Start string `json:"start"`
+
+	// The cron expression matching the times access windows close
+	End string `json:"end"`
+
+	// The IANA time zone the cron expressions are evaluated in, defaulting to UTC
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// RBACBinding references a ClusterRole to bind to the Kubernetes groups of a
+// mapping, or to its username if it has no groups.
+type RBACBinding struct {
+	// The name of the ClusterRole to bind
+	ClusterRole string `json:"clusterRole"`
+
+	// The namespaces to bind the ClusterRole in with RoleBindings, binding it
+	// cluster-wide with a ClusterRoleBinding if empty
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// ClusterStatus is the result of syncing a mapping to a managed cluster.
+type ClusterStatus struct {
+	// The name of the managed cluster
+	Name string `json:"name"`
+
+	// Whether the mapping is in its desired state in the cluster's aws-auth
+	Synced bool `json:"synced"`
+
+	// Why the mapping could not be synced to the cluster
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+}
+
+// AccessPolicy is an EKS access policy associated with a mapping stored as an
+// EKS access entry. It is ignored by the aws-auth ConfigMap backend.
+type AccessPolicy struct {
+	// The ARN of the EKS access policy
+	PolicyARN string `json:"policyArn"`
+
+	// The namespaces to scope the access policy to, scoping it to the cluster if empty
+	// +kubebuilder:validation:Optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// PrincipalStatus records the unique ID of the AWS IAM principal of a mapping
+// when it was approved, so that a principal recreated with the same ARN is not
+// granted the access of its predecessor.
+type PrincipalStatus struct {
+	// The ARN of the IAM role or user
+	ARN string `json:"arn"`
+
+	// The unique ID of the IAM role or user, such as AROA... or AIDA...
+	UniqueID string `json:"uniqueId"`
+
+	// The approval the unique ID was recorded under, if approvals are required
+	// +kubebuilder:validation:Optional
+	Approval string `json:"approval,omitempty"`
+}
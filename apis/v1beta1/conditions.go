@@ -0,0 +1,138 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// Condition types reported in MapRole and MapUser status.
+const (
+	// ConditionActive indicates whether the mapping is present in the aws-auth ConfigMap.
+	ConditionActive = "Active"
+
+	// ConditionApproved indicates whether the mapping has been approved by an
+	// identity other than its creator.
+	ConditionApproved = "Approved"
+
+	// ConditionValid indicates whether every group the mapping assigns is
+	// cataloged by an AuthGroup.
+	ConditionValid = "Valid"
+
+	// ConditionVerified indicates whether the mapping's IAM principal exists
+	// and is the one it was approved for.
+	ConditionVerified = "Verified"
+
+	// ConditionAllowed indicates whether the mapping's IAM principal is in an
+	// AWS partition and account allowed by the operator's allowlist.
+	ConditionAllowed = "Allowed"
+
+	// ConditionConflict indicates whether another MapRole or MapUser maps the
+	// same IAM principal or Kubernetes username as the mapping.
+	ConditionConflict = "Conflict"
+)
+
+// Condition reasons reported in MapRole and MapUser status.
+const (
+	// ReasonSynced indicates the mapping has been written to the aws-auth ConfigMap.
+	ReasonSynced = "Synced"
+
+	// ReasonNotYetValid indicates the mapping's notBefore time has not been reached.
+	ReasonNotYetValid = "NotYetValid"
+
+	// ReasonExpired indicates the mapping's expiresAt time has passed.
+	ReasonExpired = "Expired"
+
+	// ReasonOutsideSchedule indicates the mapping's schedule has no open window.
+	ReasonOutsideSchedule = "OutsideSchedule"
+
+	// ReasonInvalidSchedule indicates the mapping's schedule cannot be evaluated.
+	ReasonInvalidSchedule = "InvalidSchedule"
+
+	// ReasonApproved indicates the mapping has a valid approval.
+	ReasonApproved = "Approved"
+
+	// ReasonPendingApproval indicates the mapping has no valid approval.
+	ReasonPendingApproval = "PendingApproval"
+
+	// ReasonPolicyViolation indicates the mapping assigns groups not allowed
+	// by any NamespaceMappingPolicy selecting its namespace.
+	ReasonPolicyViolation = "PolicyViolation"
+
+	// ReasonGroupsCataloged indicates every group the mapping assigns is
+	// cataloged by an AuthGroup.
+	ReasonGroupsCataloged = "GroupsCataloged"
+
+	// ReasonUnknownGroups indicates the mapping assigns groups not cataloged
+	// by any AuthGroup.
+	ReasonUnknownGroups = "UnknownGroups"
+
+	// ReasonSyncFailed indicates the mapping could not be synced to the
+	// aws-auth ConfigMap of one or more clusters.
+	ReasonSyncFailed = "SyncFailed"
+
+	// ReasonAuthMapTooLarge indicates the mapping was refused as it would grow
+	// the aws-auth ConfigMap beyond its size limit.
+	ReasonAuthMapTooLarge = "AuthMapTooLarge"
+
+	// ReasonAuthMapMalformed indicates the mapping could not be synced as the
+	// aws-auth ConfigMap is malformed and quarantined.
+	ReasonAuthMapMalformed = "AuthMapMalformed"
+
+	// ReasonPrincipalVerified indicates the mapping's IAM principal exists and
+	// has the unique ID it was approved with.
+	ReasonPrincipalVerified = "PrincipalVerified"
+
+	// ReasonPrincipalUnverifiable indicates the mapping's IAM principal cannot
+	// be looked up, such as one of another AWS account, and is not verified.
+	ReasonPrincipalUnverifiable = "PrincipalUnverifiable"
+
+	// ReasonPrincipalNotFound indicates the mapping's IAM principal does not exist.
+	ReasonPrincipalNotFound = "PrincipalNotFound"
+
+	// ReasonPrincipalChanged indicates the mapping's IAM principal has been
+	// recreated with a different unique ID since the mapping was approved.
+	ReasonPrincipalChanged = "PrincipalChanged"
+
+	// ReasonPrincipalAllowed indicates the mapping's IAM principal is allowed
+	// by the operator's allowlist.
+	ReasonPrincipalAllowed = "PrincipalAllowed"
+
+	// ReasonPrincipalNotAllowed indicates the mapping's IAM principal is in an
+	// AWS partition or account not allowed by the operator's allowlist.
+	ReasonPrincipalNotAllowed = "PrincipalNotAllowed"
+
+	// ReasonInvalidARN indicates the mapping's ARN is malformed or names the
+	// wrong type of IAM principal.
+	ReasonInvalidARN = "InvalidARN"
+
+	// ReasonPermissionSetNotFound indicates no role is provisioned for the
+	// PermissionSetMapping's permission set in its account.
+	ReasonPermissionSetNotFound = "PermissionSetNotFound"
+
+	// ReasonNoConflict indicates no other mapping maps the same IAM principal
+	// or username as the mapping.
+	ReasonNoConflict = "NoConflict"
+
+	// ReasonConflictWon indicates the mapping is written to the aws-auth
+	// ConfigMap in place of the other mappings it conflicts with.
+	ReasonConflictWon = "ConflictWon"
+
+	// ReasonConflictRejected indicates the mapping is kept out of the aws-auth
+	// ConfigMap in favor of another mapping it conflicts with.
+	ReasonConflictRejected = "ConflictRejected"
+
+	// ReasonGroupsMerged indicates the groups of the mappings of the same IAM
+	// principal are merged into the aws-auth entry of the oldest of them.
+	ReasonGroupsMerged = "GroupsMerged"
+)
@@ -0,0 +1,103 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/sambatv/aws-auth-operator/apis/v1"
+)
+
+// accessWindowToV1 groups the access window fields of a v1beta1 mapping,
+// returning nil if none are set.
+func accessWindowToV1(notBefore, expiresAt *metav1.Time, deleteOnExpiry bool, schedule *AccessSchedule) *v1.AccessWindow {
+	if notBefore == nil && expiresAt == nil && !deleteOnExpiry && schedule == nil {
+		return nil
+	}
+	return &v1.AccessWindow{
+		NotBefore:      notBefore,
+		ExpiresAt:      expiresAt,
+		DeleteOnExpiry: deleteOnExpiry,
+		Schedule:       (*v1.AccessSchedule)(schedule),
+	}
+}
+
+func rbacBindingsToV1(bindings []RBACBinding) []v1.RBACBinding {
+	if bindings == nil {
+		return nil
+	}
+	converted := make([]v1.RBACBinding, len(bindings))
+	for i, binding := range bindings {
+		converted[i] = v1.RBACBinding(binding)
+	}
+	return converted
+}
+
+func rbacBindingsFromV1(bindings []v1.RBACBinding) []RBACBinding {
+	if bindings == nil {
+		return nil
+	}
+	converted := make([]RBACBinding, len(bindings))
+	for i, binding := range bindings {
+		converted[i] = RBACBinding(binding)
+	}
+	return converted
+}
+
+func accessPoliciesToV1(policies []AccessPolicy) []v1.AccessPolicy {
+	if policies == nil {
+		return nil
+	}
+	converted := make([]v1.AccessPolicy, len(policies))
+	for i, policy := range policies {
+		converted[i] = v1.AccessPolicy(policy)
+	}
+	return converted
+}
+
+func accessPoliciesFromV1(policies []v1.AccessPolicy) []AccessPolicy {
+	if policies == nil {
+		return nil
+	}
+	converted := make([]AccessPolicy, len(policies))
+	for i, policy := range policies {
+		converted[i] = AccessPolicy(policy)
+	}
+	return converted
+}
+
+func clusterStatusesToV1(statuses []ClusterStatus) []v1.ClusterStatus {
+	if statuses == nil {
+		return nil
+	}
+	converted := make([]v1.ClusterStatus, len(statuses))
+	for i, status := range statuses {
+		converted[i] = v1.ClusterStatus(status)
+	}
+	return converted
+}
+
+func clusterStatusesFromV1(statuses []v1.ClusterStatus) []ClusterStatus {
+	if statuses == nil {
+		return nil
+	}
+	converted := make([]ClusterStatus, len(statuses))
+	for i, status := range statuses {
+		converted[i] = ClusterStatus(status)
+	}
+	return converted
+}
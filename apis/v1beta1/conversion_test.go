@@ -0,0 +1,313 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrlconversion "sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	v1 "github.com/sambatv/aws-auth-operator/apis/v1"
+)
+
+func conversionTime(value string) *metav1.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return &metav1.Time{Time: parsed}
+}
+
+func TestMapRole_ConversionRoundTrip(t *testing.T) {
+	g := gomega.NewWithT(t)
+	headroom := int64(524288)
+	original := &MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin", Annotations: map[string]string{CreatedByAnnotation: "alice"}},
+		Spec: MapRoleSpec{
+			RoleARN:        "arn:aws:iam::123456789012:role/admin",
+			Groups:         []string{"system:masters"},
+			Description:    "Administrators",
+			Email:          "admin@example.com",
+			NotBefore:      conversionTime("2021-06-01T09:00:00Z"),
+			ExpiresAt:      conversionTime("2021-06-01T18:00:00Z"),
+			DeleteOnExpiry: true,
+			Schedule:       &AccessSchedule{Start: "0 9 * * *", End: "0 17 * * *", TimeZone: "UTC"},
+			RBAC:           []RBACBinding{{ClusterRole: "view", Namespaces: []string{"default"}}},
+			ClusterSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"env": "prod"},
+			},
+			AccessPolicies: []AccessPolicy{{PolicyARN: "arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy"}},
+		},
+		Status: MapRoleStatus{
+			Conditions:         []metav1.Condition{{Type: ConditionActive, Status: metav1.ConditionTrue, Reason: ReasonSynced}},
+			AuthGroups:         []string{"masters"},
+			NextTransitionTime: conversionTime("2021-06-01T18:00:00Z"),
+			ApprovedBy:         "bob",
+			Principal:          &PrincipalStatus{ARN: "arn:aws:iam::123456789012:role/admin", UniqueID: "AROAEXAMPLE"},
+			Clusters:           []ClusterStatus{{Name: "prod", Synced: true}},
+			AuthMapHeadroom:    &headroom,
+		},
+	}
+
+	hub := &v1.MapRole{}
+	g.Expect(original.DeepCopy().ConvertTo(hub)).To(gomega.Succeed())
+	g.Expect(hub.Spec.RoleARN).To(gomega.Equal(original.Spec.RoleARN))
+	g.Expect(hub.Spec.Window).NotTo(gomega.BeNil())
+	g.Expect(hub.Spec.Window.ExpiresAt).To(gomega.Equal(original.Spec.ExpiresAt))
+	g.Expect(hub.Spec.Window.Schedule.Start).To(gomega.Equal("0 9 * * *"))
+	g.Expect(hub.Status.Principal.UniqueID).To(gomega.Equal("AROAEXAMPLE"))
+
+	converted := &MapRole{}
+	g.Expect(converted.ConvertFrom(hub)).To(gomega.Succeed())
+	g.Expect(converted).To(gomega.Equal(original))
+
+	// A v1 object without a window converts back without one.
+	hub = &v1.MapRole{Spec: v1.MapRoleSpec{RoleARN: "arn:aws:iam::123456789012:role/view"}}
+	converted = &MapRole{}
+	g.Expect(converted.ConvertFrom(hub)).To(gomega.Succeed())
+	roundTripped := &v1.MapRole{}
+	g.Expect(converted.ConvertTo(roundTripped)).To(gomega.Succeed())
+	g.Expect(roundTripped).To(gomega.Equal(hub))
+}
+
+func TestMapUser_ConversionRoundTrip(t *testing.T) {
+	g := gomega.NewWithT(t)
+	original := &MapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice"},
+		Spec: MapUserSpec{
+			UserARN:   "arn:aws:iam::123456789012:user/alice",
+			Groups:    []string{"developers"},
+			ExpiresAt: conversionTime("2021-06-01T18:00:00Z"),
+			RBAC:      []RBACBinding{{ClusterRole: "edit"}},
+		},
+		Status: MapUserStatus{
+			Conditions: []metav1.Condition{{Type: ConditionActive, Status: metav1.ConditionFalse, Reason: ReasonExpired}},
+			Principal:  &PrincipalStatus{ARN: "arn:aws:iam::123456789012:user/alice", UniqueID: "AIDAEXAMPLE"},
+		},
+	}
+
+	hub := &v1.MapUser{}
+	g.Expect(original.DeepCopy().ConvertTo(hub)).To(gomega.Succeed())
+	g.Expect(hub.Spec.UserARN).To(gomega.Equal(original.Spec.UserARN))
+	g.Expect(hub.Spec.Window.ExpiresAt).To(gomega.Equal(original.Spec.ExpiresAt))
+
+	converted := &MapUser{}
+	g.Expect(converted.ConvertFrom(hub)).To(gomega.Succeed())
+	g.Expect(converted).To(gomega.Equal(original))
+
+	hub = &v1.MapUser{Spec: v1.MapUserSpec{UserARN: "arn:aws:iam::123456789012:user/bob"}}
+	converted = &MapUser{}
+	g.Expect(converted.ConvertFrom(hub)).To(gomega.Succeed())
+	roundTripped := &v1.MapUser{}
+	g.Expect(converted.ConvertTo(roundTripped)).To(gomega.Succeed())
+	g.Expect(roundTripped).To(gomega.Equal(hub))
+}
+
+// TestConversion_HubRoundTrip converts fully populated v1 objects, as stored,
+// to v1beta1 and back, as when a v1beta1 client updates a stored object.
+func TestConversion_HubRoundTrip(t *testing.T) {
+	g := gomega.NewWithT(t)
+	headroom := int64(1024)
+	window := &v1.AccessWindow{
+		NotBefore:      conversionTime("2021-06-01T09:00:00Z"),
+		ExpiresAt:      conversionTime("2021-06-01T18:00:00Z"),
+		DeleteOnExpiry: true,
+		Schedule:       &v1.AccessSchedule{Start: "0 9 * * 1-5", End: "0 17 * * 1-5", TimeZone: "Europe/Paris"},
+	}
+	status := v1.MappingStatus{
+		Conditions:         []metav1.Condition{{Type: ConditionActive, Status: metav1.ConditionTrue, Reason: ReasonSynced, Message: "mapping is present in aws-auth"}},
+		AuthGroups:         []string{"masters"},
+		NextTransitionTime: conversionTime("2021-06-01T17:00:00Z"),
+		ApprovedBy:         "bob",
+		Principal:          &v1.PrincipalStatus{ARN: "arn:aws:iam::123456789012:role/admin", UniqueID: "AROAEXAMPLE"},
+		Clusters:           []v1.ClusterStatus{{Name: "staging", Message: "unreachable"}},
+		AuthMapHeadroom:    &headroom,
+	}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	policies := []v1.AccessPolicy{{PolicyARN: "arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy", Namespaces: []string{"apps"}}}
+
+	for _, tc := range []struct {
+		hub    ctrlconversion.Hub
+		spoke  ctrlconversion.Convertible
+		result ctrlconversion.Hub
+	}{{
+		hub: &v1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin", ResourceVersion: "42"},
+			Spec: v1.MapRoleSpec{
+				RoleARN:         "arn:aws:iam::123456789012:role/admin",
+				Groups:          []string{"system:masters"},
+				Description:     "Administrators",
+				Email:           "admin@example.com",
+				Window:          window,
+				RBAC:            []v1.RBACBinding{{ClusterRole: "admin", Namespaces: []string{"apps"}}},
+				ClusterSelector: selector,
+				AccessPolicies:  policies,
+			},
+			Status: status,
+		},
+		spoke:  &MapRole{},
+		result: &v1.MapRole{},
+	}, {
+		hub: &v1.MapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice", ResourceVersion: "43"},
+			Spec: v1.MapUserSpec{
+				UserARN:         "arn:aws:iam::123456789012:user/alice",
+				Groups:          []string{"developers"},
+				Description:     "Alice",
+				Email:           "alice@example.com",
+				Window:          window,
+				RBAC:            []v1.RBACBinding{{ClusterRole: "edit"}},
+				ClusterSelector: selector,
+				AccessPolicies:  policies,
+			},
+			Status: status,
+		},
+		spoke:  &MapUser{},
+		result: &v1.MapUser{},
+	}} {
+		g.Expect(tc.spoke.ConvertFrom(tc.hub)).To(gomega.Succeed())
+		g.Expect(tc.spoke.ConvertTo(tc.result)).To(gomega.Succeed())
+		g.Expect(tc.result).To(gomega.Equal(tc.hub), "%T", tc.hub)
+	}
+}
+
+// TestConversionWebhook_Deployed checks that the default kustomize
+// configuration and the helm chart generated from it route the conversion of
+// every kind stored as v1 to the conversion webhook, as the API server cannot
+// convert them otherwise.
+func TestConversionWebhook_Deployed(t *testing.T) {
+	g := gomega.NewWithT(t)
+	readYAML := func(elem ...string) map[string]interface{} {
+		file, err := os.Open(filepath.Join(append([]string{"..", ".."}, elem...)...))
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		defer file.Close()
+		// Skip the empty document before a leading separator.
+		decoder := utilyaml.NewYAMLOrJSONDecoder(file, 4096)
+		var object map[string]interface{}
+		for object == nil {
+			g.Expect(decoder.Decode(&object)).To(gomega.Succeed())
+		}
+		return object
+	}
+
+	crds := readYAML("config", "crd", "kustomization.yaml")
+	for _, plural := range []string{"maproles", "mapusers"} {
+		crd := readYAML("config", "crd", "bases", "aws-auth.samba.tv_"+plural+".yaml")
+		versions := crd["spec"].(map[string]interface{})["versions"].([]interface{})
+		storage := ""
+		for _, version := range versions {
+			if version := version.(map[string]interface{}); version["storage"] == true {
+				storage = version["name"].(string)
+			}
+		}
+		g.Expect(storage).To(gomega.Equal(v1.GroupVersion.Version), plural)
+		g.Expect(crds["patchesStrategicMerge"]).To(gomega.ContainElements(
+			"patches/webhook_in_"+plural+".yaml",
+			"patches/cainjection_in_"+plural+".yaml",
+		), plural)
+
+		chartCRD := readYAML("charts", "aws-auth-operator", "crds", plural+".yaml")
+		conversion := chartCRD["spec"].(map[string]interface{})["conversion"]
+		g.Expect(conversion).To(gomega.HaveKeyWithValue("strategy", "Webhook"), "chart %s CRD is stale, run make chart-build", plural)
+	}
+
+	deploy := readYAML("config", "default", "kustomization.yaml")
+	g.Expect(deploy["bases"]).To(gomega.ContainElements("../crd", "../webhook", "../certmanager"))
+	g.Expect(deploy["patchesStrategicMerge"]).To(gomega.ContainElements("manager_webhook_patch.yaml", "webhookcainjection_patch.yaml"))
+	manager := readYAML("config", "default", "manager_webhook_patch.yaml")
+	containers := manager["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	g.Expect(containers[0].(map[string]interface{})["args"]).To(gomega.ContainElement("--enable-webhooks"))
+
+	// The chart ships a CRD for every kind.
+	bases, err := filepath.Glob(filepath.Join("..", "..", "config", "crd", "bases", "*.yaml"))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	for _, base := range bases {
+		plural := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(base), GroupVersion.Group+"_"), ".yaml")
+		g.Expect(filepath.Join("..", "..", "charts", "aws-auth-operator", "crds", plural+".yaml")).To(gomega.BeARegularFile(), "chart lacks the %s CRD, run make chart-build", plural)
+	}
+}
+
+// TestConversionWebhook_Samples converts the v1beta1 samples to v1 and back
+// through the conversion webhook, as the API server does for stored objects.
+func TestConversionWebhook_Samples(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(v1.AddToScheme(scheme)).To(gomega.Succeed())
+	webhook := &conversion.Webhook{}
+	g.Expect(webhook.InjectScheme(scheme)).To(gomega.Succeed())
+
+	convert := func(object map[string]interface{}, apiVersion string) map[string]interface{} {
+		review := map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "ConversionReview",
+			"request": map[string]interface{}{
+				"uid":               "1",
+				"desiredAPIVersion": apiVersion,
+				"objects":           []interface{}{object},
+			},
+		}
+		body, err := json.Marshal(review)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		webhook.ServeHTTP(recorder, request)
+		g.Expect(recorder.Code).To(gomega.Equal(http.StatusOK))
+
+		var response struct {
+			Response struct {
+				ConvertedObjects []map[string]interface{} `json:"convertedObjects"`
+				Result           metav1.Status            `json:"result"`
+			} `json:"response"`
+		}
+		g.Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(gomega.Succeed())
+		g.Expect(response.Response.Result.Status).To(gomega.Equal(metav1.StatusSuccess), response.Response.Result.Message)
+		g.Expect(response.Response.ConvertedObjects).To(gomega.HaveLen(1))
+		return response.Response.ConvertedObjects[0]
+	}
+
+	for sample, arnField := range map[string]string{"maprole.yaml": "roleARN", "mapuser.yaml": "userARN"} {
+		file, err := os.Open(filepath.Join("..", "..", "config", "samples", sample))
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		var object map[string]interface{}
+		err = utilyaml.NewYAMLOrJSONDecoder(file, 4096).Decode(&object)
+		file.Close()
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		stored := convert(object, v1.GroupVersion.String())
+		g.Expect(stored["apiVersion"]).To(gomega.Equal(v1.GroupVersion.String()), sample)
+		g.Expect(stored["spec"]).To(gomega.HaveKeyWithValue(arnField, gomega.HavePrefix("arn:aws:iam::123456789012:")), sample)
+
+		served := convert(stored, GroupVersion.String())
+		g.Expect(served["spec"]).To(gomega.Equal(object["spec"]), sample)
+		g.Expect(served["metadata"]).To(gomega.HaveKeyWithValue("name", "sample"), sample)
+	}
+}
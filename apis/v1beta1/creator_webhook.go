@@ -0,0 +1,92 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// CreatorWebhookPath is the path the creator webhook is served at.
+const CreatorWebhookPath = "/mutate-aws-auth-samba-tv-v1beta1-creator"
+
+//+kubebuilder:webhook:path=/mutate-aws-auth-samba-tv-v1beta1-creator,mutating=true,failurePolicy=fail,sideEffects=None,groups=aws-auth.samba.tv,resources=maproles;mapusers;namespacedmaproles;permissionsetmappings;accessapprovals,verbs=create;update,versions=v1beta1,name=mcreator.aws-auth.samba.tv,admissionReviewVersions={v1,v1beta1}
+
+// SetupCreatorWebhookWithManager registers the creator webhook with the manager.
+func SetupCreatorWebhookWithManager(mgr ctrlruntime.Manager) {
+	mgr.GetWebhookServer().Register(CreatorWebhookPath, &webhook.Admission{Handler: &CreatorAnnotator{}})
+}
+
+// CreatorAnnotator is an admission handler recording the identity that created
+// an object in its CreatedByAnnotation, and the identity that last changed its
+// spec in its RequestedByAnnotation, preventing either from being set or
+// changed by anyone else.
+type CreatorAnnotator struct{}
+
+// Handle implements admission.Handler.
+func (a *CreatorAnnotator) Handle(_ context.Context, req admission.Request) admission.Response {
+	var obj unstructured.Unstructured
+	if err := json.Unmarshal(req.Object.Raw, &obj.Object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	createdBy := req.UserInfo.Username
+	requestedBy := req.UserInfo.Username
+	if req.Operation == admissionv1.Update {
+		var old unstructured.Unstructured
+		if err := json.Unmarshal(req.OldObject.Raw, &old.Object); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		createdBy = old.GetAnnotations()[CreatedByAnnotation]
+		if reflect.DeepEqual(obj.Object["spec"], old.Object["spec"]) {
+			requestedBy = old.GetAnnotations()[RequestedByAnnotation]
+		}
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations[CreatedByAnnotation] == createdBy && annotations[RequestedByAnnotation] == requestedBy {
+		return admission.Allowed("")
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	setOrDelete(annotations, CreatedByAnnotation, createdBy)
+	setOrDelete(annotations, RequestedByAnnotation, requestedBy)
+	obj.SetAnnotations(annotations)
+
+	marshaled, err := json.Marshal(obj.Object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+func setOrDelete(annotations map[string]string, key, value string) {
+	if value == "" {
+		delete(annotations, key)
+	} else {
+		annotations[key] = value
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newCreatorRequest(g *gomega.WithT, op admissionv1.Operation, username string, obj, old *MapRole) admission.Request {
+	raw, err := json.Marshal(obj)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: op,
+		UserInfo:  authenticationv1.UserInfo{Username: username},
+		Object:    pkgruntime.RawExtension{Raw: raw},
+	}}
+	if old != nil {
+		raw, err = json.Marshal(old)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		req.OldObject = pkgruntime.RawExtension{Raw: raw}
+	}
+	return req
+}
+
+func TestCreatorAnnotator(t *testing.T) {
+	g := gomega.NewWithT(t)
+	annotator := &CreatorAnnotator{}
+	mapRole := &MapRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "admin",
+			Annotations: map[string]string{CreatedByAnnotation: "mallory"},
+		},
+		Spec: MapRoleSpec{RoleARN: "arn:aws:iam::123456789012:role/admin"},
+	}
+
+	// Creation records the requesting user, overriding any supplied value.
+	resp := annotator.Handle(context.Background(), newCreatorRequest(g, admissionv1.Create, "alice", mapRole, nil))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+	g.Expect(resp.Patches).To(gomega.HaveLen(2))
+	for _, patch := range resp.Patches {
+		g.Expect(patch.Value).To(gomega.Equal("alice"))
+	}
+
+	// Metadata-only updates keep the recorded identities.
+	old := mapRole.DeepCopy()
+	old.Annotations = map[string]string{CreatedByAnnotation: "alice", RequestedByAnnotation: "alice"}
+	updated := old.DeepCopy()
+	updated.Labels = map[string]string{"team": "ops"}
+	resp = annotator.Handle(context.Background(), newCreatorRequest(g, admissionv1.Update, "bob", updated, old))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+	g.Expect(resp.Patches).To(gomega.BeEmpty())
+
+	// Spec updates record the requesting user as requester only.
+	updated.Spec.Groups = []string{"system:masters"}
+	resp = annotator.Handle(context.Background(), newCreatorRequest(g, admissionv1.Update, "bob", updated, old))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+	g.Expect(resp.Patches).To(gomega.HaveLen(1))
+	g.Expect(resp.Patches[0].Path).To(gomega.Equal("/metadata/annotations/aws-auth.samba.tv~1requested-by"))
+	g.Expect(resp.Patches[0].Value).To(gomega.Equal("bob"))
+}
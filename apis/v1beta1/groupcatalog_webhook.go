@@ -0,0 +1,84 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// GroupCatalogWebhookPath is the path the group catalog webhook is served at.
+const GroupCatalogWebhookPath = "/validate-aws-auth-samba-tv-v1beta1-groups"
+
+//+kubebuilder:webhook:path=/validate-aws-auth-samba-tv-v1beta1-groups,mutating=false,failurePolicy=fail,sideEffects=None,groups=aws-auth.samba.tv,resources=maproles;mapusers;namespacedmaproles;permissionsetmappings,verbs=create;update,versions=v1beta1,name=vgroups.aws-auth.samba.tv,admissionReviewVersions={v1,v1beta1}
+
+// SetupGroupCatalogWebhookWithManager registers the group catalog webhook with
+// the manager, rejecting mappings that assign uncataloged groups if enforce is
+// set, and warning about them otherwise.
+func SetupGroupCatalogWebhookWithManager(mgr ctrlruntime.Manager, enforce bool) {
+	mgr.GetWebhookServer().Register(GroupCatalogWebhookPath, &webhook.Admission{Handler: &GroupCatalogValidator{
+		Reader:  mgr.GetClient(),
+		Enforce: enforce,
+	}})
+}
+
+//+kubebuilder:object:generate=false
+
+// GroupCatalogValidator is an admission handler checking that every group a
+// mapping assigns is cataloged by an AuthGroup.
+type GroupCatalogValidator struct {
+	Reader ctrlclient.Reader
+
+	// Enforce rejects mappings assigning uncataloged groups, instead of
+	// admitting them with a warning.
+	Enforce bool
+}
+
+// Handle implements admission.Handler.
+func (v *GroupCatalogValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var obj unstructured.Unstructured
+	if err := json.Unmarshal(req.Object.Raw, &obj.Object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	groups, _, err := unstructured.NestedStringSlice(obj.Object, "spec", "groups")
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var authGroups AuthGroupList
+	if err := v.Reader.List(ctx, &authGroups); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	_, unknown := authGroups.Resolve(groups)
+	if len(unknown) == 0 {
+		return admission.Allowed("")
+	}
+	message := fmt.Sprintf("groups not cataloged by any AuthGroup: %s", strings.Join(unknown, ", "))
+	if v.Enforce {
+		return admission.Denied(message)
+	}
+	return admission.Allowed("").WithWarnings(message)
+}
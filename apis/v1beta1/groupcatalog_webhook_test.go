@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestAuthGroupList_Resolve(t *testing.T) {
+	g := gomega.NewWithT(t)
+	authGroups := AuthGroupList{Items: []AuthGroup{
+		{ObjectMeta: metav1.ObjectMeta{Name: "masters"}, Spec: AuthGroupSpec{Group: "system:masters"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "ops"}, Spec: AuthGroupSpec{Group: "ops"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admins"}, Spec: AuthGroupSpec{Group: "system:masters"}},
+	}}
+
+	catalog, unknown := authGroups.Resolve([]string{"system:masters", "ops"})
+	g.Expect(catalog).To(gomega.Equal([]string{"cluster-admins", "masters", "ops"}))
+	g.Expect(unknown).To(gomega.BeEmpty())
+
+	catalog, unknown = authGroups.Resolve([]string{"system:master", "ops"})
+	g.Expect(catalog).To(gomega.Equal([]string{"ops"}))
+	g.Expect(unknown).To(gomega.Equal([]string{"system:master"}))
+}
+
+func TestGroupCatalogValidator(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(AddToScheme(scheme)).To(gomega.Succeed())
+	validator := &GroupCatalogValidator{
+		Reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&AuthGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "masters"},
+			Spec:       AuthGroupSpec{Group: "system:masters"},
+		}).Build(),
+		Enforce: true,
+	}
+	newRequest := func(groups ...string) admission.Request {
+		raw, err := json.Marshal(&MapRole{Spec: MapRoleSpec{Groups: groups}})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    pkgruntime.RawExtension{Raw: raw},
+		}}
+	}
+
+	resp := validator.Handle(context.Background(), newRequest("system:masters"))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+	g.Expect(resp.Warnings).To(gomega.BeEmpty())
+
+	resp = validator.Handle(context.Background(), newRequest("system:master"))
+	g.Expect(resp.Allowed).To(gomega.BeFalse())
+	g.Expect(string(resp.Result.Reason)).To(gomega.ContainSubstring("system:master"))
+
+	// Uncataloged groups are only warned about unless enforced.
+	validator.Enforce = false
+	resp = validator.Handle(context.Background(), newRequest("system:master"))
+	g.Expect(resp.Allowed).To(gomega.BeTrue())
+	g.Expect(resp.Warnings).To(gomega.HaveLen(1))
+}
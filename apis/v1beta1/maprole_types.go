@@ -42,12 +42,70 @@ type MapRoleSpec struct {
 	// The email address of a contact person for the MapUser
 	// +kubebuilder:validation:Optional
 	Email string `json:"email"`
+
+	// The time before which the MapRole is kept out of aws-auth
+	// +kubebuilder:validation:Optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+
+	// The time after which the MapRole is removed from aws-auth
+	// +kubebuilder:validation:Optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Whether to delete the MapRole once it has expired
+	// +kubebuilder:validation:Optional
+	DeleteOnExpiry bool `json:"deleteOnExpiry,omitempty"`
+
+	// The recurring windows during which the MapRole is present in aws-auth
+	// +kubebuilder:validation:Optional
+	Schedule *AccessSchedule `json:"schedule,omitempty"`
+
+	// The ClusterRoles bound to the MapRole groups while it is present in aws-auth
+	// +kubebuilder:validation:Optional
+	RBAC []RBACBinding `json:"rbac,omitempty"`
+
+	// Selects the managed clusters the MapRole is synced to when the operator
+	// runs in hub mode, instead of the local cluster
+	// +kubebuilder:validation:Optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// The EKS access policies associated with the MapRole when it is stored as
+	// an EKS access entry
+	// +kubebuilder:validation:Optional
+	AccessPolicies []AccessPolicy `json:"accessPolicies,omitempty"`
 }
 
 // MapRoleStatus defines the observed state of MapRole
 type MapRoleStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// The latest available observations of the MapRole state
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The names of the AuthGroup objects cataloging the groups the MapRole assigns
+	// +kubebuilder:validation:Optional
+	AuthGroups []string `json:"authGroups,omitempty"`
+
+	// The time the MapRole is next added to or removed from aws-auth
+	// +kubebuilder:validation:Optional
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
+
+	// The identity that approved the MapRole, if approval is required
+	// +kubebuilder:validation:Optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+
+	// The IAM principal of the MapRole when it was approved, if principals are verified
+	// +kubebuilder:validation:Optional
+	Principal *PrincipalStatus `json:"principal,omitempty"`
+
+	// The sync results of the managed clusters the MapRole is synced to
+	// +kubebuilder:validation:Optional
+	Clusters []ClusterStatus `json:"clusters,omitempty"`
+
+	// The number of bytes the aws-auth ConfigMap could still grow by when the MapRole was last synced
+	// +kubebuilder:validation:Optional
+	AuthMapHeadroom *int64 `json:"authMapHeadroom,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -57,6 +115,8 @@ type MapRoleStatus struct {
 //+kubebuilder:printcolumn:name="Groups",type=string,JSONPath=`.spec.groups`
 //+kubebuilder:printcolumn:name="Email",type=string,JSONPath=`.spec.email`
 //+kubebuilder:printcolumn:name="Description",type=string,JSONPath=`.spec.description`
+//+kubebuilder:printcolumn:name="Expires",type=string,format=date-time,JSONPath=`.spec.expiresAt`
+//+kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.conditions[?(@.type=="Active")].status`
 
 // MapRole is the Schema for the MapRole API
 type MapRole struct {
@@ -0,0 +1,80 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/sambatv/aws-auth-operator/apis/v1"
+)
+
+// ConvertTo converts the MapUser to the v1 hub version.
+func (src *MapUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.MapUser)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = v1.MapUserSpec{
+		UserARN:         src.Spec.UserARN,
+		Groups:          src.Spec.Groups,
+		Description:     src.Spec.Description,
+		Email:           src.Spec.Email,
+		Window:          accessWindowToV1(src.Spec.NotBefore, src.Spec.ExpiresAt, src.Spec.DeleteOnExpiry, src.Spec.Schedule),
+		RBAC:            rbacBindingsToV1(src.Spec.RBAC),
+		ClusterSelector: src.Spec.ClusterSelector,
+		AccessPolicies:  accessPoliciesToV1(src.Spec.AccessPolicies),
+	}
+	dst.Status = v1.MappingStatus{
+		Conditions:         src.Status.Conditions,
+		AuthGroups:         src.Status.AuthGroups,
+		NextTransitionTime: src.Status.NextTransitionTime,
+		ApprovedBy:         src.Status.ApprovedBy,
+		Principal:          (*v1.PrincipalStatus)(src.Status.Principal),
+		Clusters:           clusterStatusesToV1(src.Status.Clusters),
+		AuthMapHeadroom:    src.Status.AuthMapHeadroom,
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1 hub version to the MapUser.
+func (dst *MapUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.MapUser)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = MapUserSpec{
+		UserARN:         src.Spec.UserARN,
+		Groups:          src.Spec.Groups,
+		Description:     src.Spec.Description,
+		Email:           src.Spec.Email,
+		RBAC:            rbacBindingsFromV1(src.Spec.RBAC),
+		ClusterSelector: src.Spec.ClusterSelector,
+		AccessPolicies:  accessPoliciesFromV1(src.Spec.AccessPolicies),
+	}
+	if window := src.Spec.Window; window != nil {
+		dst.Spec.NotBefore = window.NotBefore
+		dst.Spec.ExpiresAt = window.ExpiresAt
+		dst.Spec.DeleteOnExpiry = window.DeleteOnExpiry
+		dst.Spec.Schedule = (*AccessSchedule)(window.Schedule)
+	}
+	dst.Status = MapUserStatus{
+		Conditions:         src.Status.Conditions,
+		AuthGroups:         src.Status.AuthGroups,
+		NextTransitionTime: src.Status.NextTransitionTime,
+		ApprovedBy:         src.Status.ApprovedBy,
+		Principal:          (*PrincipalStatus)(src.Status.Principal),
+		Clusters:           clusterStatusesFromV1(src.Status.Clusters),
+		AuthMapHeadroom:    src.Status.AuthMapHeadroom,
+	}
+	return nil
+}
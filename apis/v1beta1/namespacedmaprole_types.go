@@ -0,0 +1,111 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespacedMapRoleSpec defines the desired state of NamespacedMapRole
+type NamespacedMapRoleSpec struct {
+	// The Role ARN to associate with the NamespacedMapRole
+	RoleARN string `json:"rolearn"`
+
+	// The Kubernetes groups to associate with the NamespacedMapRole, which
+	// must be allowed for its namespace by a NamespaceMappingPolicy
+	// +kubebuilder:validation:Optional
+	Groups []string `json:"groups"`
+
+	// A useful description of the NamespacedMapRole
+	// +kubebuilder:validation:Optional
+	Description string `json:"description"`
+
+	// The email address of a contact person for the NamespacedMapRole
+	// +kubebuilder:validation:Optional
+	Email string `json:"email"`
+}
+
+// NamespacedMapRoleStatus defines the observed state of NamespacedMapRole
+type NamespacedMapRoleStatus struct {
+	// The username the NamespacedMapRole is mapped to in aws-auth
+	// +kubebuilder:validation:Optional
+	Username string `json:"username,omitempty"`
+
+	// The latest available observations of the NamespacedMapRole state
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The names of the AuthGroup objects cataloging the groups the NamespacedMapRole assigns
+	// +kubebuilder:validation:Optional
+	AuthGroups []string `json:"authGroups,omitempty"`
+
+	// The identity that approved the NamespacedMapRole, if approval is required
+	// +kubebuilder:validation:Optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+
+	// The IAM principal of the NamespacedMapRole when it was approved, if principals are verified
+	// +kubebuilder:validation:Optional
+	Principal *PrincipalStatus `json:"principal,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Role ARN",type=string,JSONPath=`.spec.rolearn`
+//+kubebuilder:printcolumn:name="Groups",type=string,JSONPath=`.spec.groups`
+//+kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.status.username`
+//+kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.conditions[?(@.type=="Active")].status`
+
+// NamespacedMapRole is the Schema for the NamespacedMapRole API. It lets teams
+// map roles to the groups allowed for their namespace without cluster-wide
+// permissions. Its aws-auth username is "namespace:<namespace>:<name>".
+type NamespacedMapRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespacedMapRoleSpec   `json:"spec,omitempty"`
+	Status NamespacedMapRoleStatus `json:"status,omitempty"`
+}
+
+// Username returns the aws-auth username of the NamespacedMapRole.
+func (r *NamespacedMapRole) Username() string {
+	return NamespacedUsername(r.Namespace, r.Name)
+}
+
+// NamespacedUsername returns the aws-auth username of a NamespacedMapRole in
+// namespace with name. Kubernetes names cannot contain colons, so these never
+// collide with MapRole usernames, and the reserved prefix keeps namespaces
+// such as "system" or "permission-set" from colliding with other usernames.
+func NamespacedUsername(namespace, name string) string {
+	return NamespacedUsernamePrefix + namespace + ":" + name
+}
+
+// NamespacedUsernamePrefix prefixes the aws-auth usernames of
+// NamespacedMapRole objects.
+const NamespacedUsernamePrefix = "namespace:"
+
+//+kubebuilder:object:root=true
+
+// NamespacedMapRoleList contains a list of NamespacedMapRole
+type NamespacedMapRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespacedMapRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespacedMapRole{}, &NamespacedMapRoleList{})
+}
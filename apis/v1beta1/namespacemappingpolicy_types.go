@@ -0,0 +1,68 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespacePlaceholder is replaced by the namespace name in the
+// AllowedGroups patterns of a NamespaceMappingPolicy.
+const NamespacePlaceholder = "{namespace}"
+
+// NamespaceMappingPolicySpec defines the desired state of NamespaceMappingPolicy
+type NamespaceMappingPolicySpec struct {
+	// Selects the namespaces the policy applies to, defaulting to all namespaces
+	// +kubebuilder:validation:Optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// The glob patterns of groups NamespacedMapRole objects in selected
+	// namespaces may assign, in which {namespace} is replaced by the namespace name
+	AllowedGroups []string `json:"allowedGroups"`
+}
+
+// NamespaceMappingPolicyStatus defines the observed state of NamespaceMappingPolicy
+type NamespaceMappingPolicyStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Allowed Groups",type=string,JSONPath=`.spec.allowedGroups`
+
+// NamespaceMappingPolicy is the Schema for the NamespaceMappingPolicy API. It
+// allows NamespacedMapRole objects in selected namespaces to assign groups.
+type NamespaceMappingPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespaceMappingPolicySpec   `json:"spec,omitempty"`
+	Status NamespaceMappingPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NamespaceMappingPolicyList contains a list of NamespaceMappingPolicy
+type NamespaceMappingPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespaceMappingPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespaceMappingPolicy{}, &NamespaceMappingPolicyList{})
+}
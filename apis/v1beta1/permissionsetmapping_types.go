@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PermissionSetMappingSpec defines the desired state of PermissionSetMapping
+type PermissionSetMappingSpec struct {
+	// The ID of the AWS account the permission set is provisioned to
+	// +kubebuilder:validation:Pattern=`^[0-9]{12}$`
+	AccountID string `json:"accountId"`
+
+	// The name of the IAM Identity Center permission set
+	// +kubebuilder:validation:MinLength=1
+	PermissionSetName string `json:"permissionSetName"`
+
+	// The Kubernetes groups to associate with the PermissionSetMapping
+	// +kubebuilder:validation:Optional
+	Groups []string `json:"groups"`
+
+	// A useful description of the PermissionSetMapping
+	// +kubebuilder:validation:Optional
+	Description string `json:"description"`
+
+	// The email address of a contact person for the PermissionSetMapping
+	// +kubebuilder:validation:Optional
+	Email string `json:"email"`
+}
+
+// PermissionSetMappingStatus defines the observed state of PermissionSetMapping
+type PermissionSetMappingStatus struct {
+	// The username the PermissionSetMapping is mapped to in aws-auth
+	// +kubebuilder:validation:Optional
+	Username string `json:"username,omitempty"`
+
+	// The ARN of the role currently provisioned for the permission set, without its path
+	// +kubebuilder:validation:Optional
+	RoleARN string `json:"roleArn,omitempty"`
+
+	// The latest available observations of the PermissionSetMapping state
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// The names of the AuthGroup objects cataloging the groups the PermissionSetMapping assigns
+	// +kubebuilder:validation:Optional
+	AuthGroups []string `json:"authGroups,omitempty"`
+
+	// The identity that approved the PermissionSetMapping, if approval is required
+	// +kubebuilder:validation:Optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+
+	// The IAM principal of the PermissionSetMapping when it was approved, if principals are verified
+	// +kubebuilder:validation:Optional
+	Principal *PrincipalStatus `json:"principal,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Account",type=string,JSONPath=`.spec.accountId`
+//+kubebuilder:printcolumn:name="Permission Set",type=string,JSONPath=`.spec.permissionSetName`
+//+kubebuilder:printcolumn:name="Groups",type=string,JSONPath=`.spec.groups`
+//+kubebuilder:printcolumn:name="Role ARN",type=string,JSONPath=`.status.roleArn`
+//+kubebuilder:printcolumn:name="Active",type=string,JSONPath=`.status.conditions[?(@.type=="Active")].status`
+
+// PermissionSetMapping is the Schema for the PermissionSetMapping API. It maps
+// the role IAM Identity Center provisions for a permission set in an account,
+// following it as the permission set is reprovisioned. Its aws-auth username
+// is "permission-set:<name>".
+type PermissionSetMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PermissionSetMappingSpec   `json:"spec,omitempty"`
+	Status PermissionSetMappingStatus `json:"status,omitempty"`
+}
+
+// Username returns the aws-auth username of the PermissionSetMapping.
+// Kubernetes names cannot contain colons, so these never collide with MapRole
+// usernames.
+func (m *PermissionSetMapping) Username() string {
+	return "permission-set:" + m.Name
+}
+
+//+kubebuilder:object:root=true
+
+// PermissionSetMappingList contains a list of PermissionSetMapping
+type PermissionSetMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PermissionSetMapping `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PermissionSetMapping{}, &PermissionSetMappingList{})
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package approval decides whether mappings have been approved by an identity
+// other than their creator, either by a signed approval annotation or by an
+// AccessApproval object.
+package approval
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// Mapping describes the mapping being approved.
+type Mapping struct {
+	Kind string
+
+	// Namespace is set for namespaced mappings only.
+	Namespace string
+	Name      string
+	ARN       string
+	Groups    []string
+
+	// RBAC is the spec.rbac of mappings that bind ClusterRoles.
+	RBAC        []v1beta1.RBACBinding
+	CreatedBy   string
+	RequestedBy string
+	Annotations map[string]string
+}
+
+// isRequester returns true if identity created the mapping or last changed it.
+func (m Mapping) isRequester(identity string) bool {
+	return identity == m.CreatedBy || identity == m.RequestedBy
+}
+
+// Payload returns the canonical bytes signed by an approver of the mapping.
+// Any change to the mapping's ARN, groups or RBAC bindings changes its
+// payload, invalidating earlier approvals. The RBAC bindings are only part of
+// the payload of mappings declaring some, so that the approvals of the others
+// stay valid.
+func (m Mapping) Payload() []byte {
+	lines := []string{m.Kind, m.qualifiedName(), m.ARN, strings.Join(sortedGroups(m.Groups), ",")}
+	if len(m.RBAC) > 0 {
+		lines = append(lines, canonicalRBAC(m.RBAC))
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// qualifiedName returns the name of the mapping, prefixed by its namespace
+// if it has one.
+func (m Mapping) qualifiedName() string {
+	if m.Namespace == "" {
+		return m.Name
+	}
+	return m.Namespace + "/" + m.Name
+}
+
+// Result is the outcome of an approval check.
+type Result struct {
+	Approved   bool
+	ApprovedBy string
+	Message    string
+
+	// ID identifies the approval granted, the UID of an AccessApproval object
+	// or the value of an approval annotation, so that a mapping approved anew
+	// can be told apart.
+	ID string
+}
+
+// Checker checks mappings for approvals.
+type Checker struct {
+	// Reader lists AccessApproval objects.
+	Reader ctrlclient.Reader
+
+	// Keys holds the public keys of approvers allowed to sign approval annotations.
+	Keys KeyRing
+
+	// TrustApprovalObjects enables approval by AccessApproval objects. The
+	// identities that last changed their specs are only known when the
+	// creator webhook is enabled.
+	TrustApprovalObjects bool
+}
+
+// Check returns whether the mapping has been approved, and by whom.
+func (c *Checker) Check(ctx context.Context, m Mapping) (Result, error) {
+	var reasons []string
+
+	if annotation, ok := m.Annotations[v1beta1.ApprovalAnnotation]; ok {
+		approver, err := c.Keys.Verify(annotation, m.Payload())
+		switch {
+		case err != nil:
+			reasons = append(reasons, err.Error())
+		case m.isRequester(approver):
+			reasons = append(reasons, fmt.Sprintf("approval annotation signed by requester %s", approver))
+		default:
+			return Result{Approved: true, ApprovedBy: approver, Message: "approved by signed annotation", ID: annotation}, nil
+		}
+	}
+
+	if c.TrustApprovalObjects {
+		var approvals v1beta1.AccessApprovalList
+		if err := c.Reader.List(ctx, &approvals); err != nil {
+			return Result{}, err
+		}
+		for _, approval := range approvals.Items {
+			if !matches(&approval, m) {
+				continue
+			}
+			// The approver is whoever last changed the approval's spec, so
+			// that editing someone else's approval does not borrow it.
+			approver := approval.Annotations[v1beta1.RequestedByAnnotation]
+			switch {
+			case approver == "":
+				reasons = append(reasons, fmt.Sprintf("AccessApproval %s has no known approver", approval.Name))
+			case m.isRequester(approver):
+				reasons = append(reasons, fmt.Sprintf("AccessApproval %s approved by requester %s", approval.Name, approver))
+			default:
+				return Result{Approved: true, ApprovedBy: approver, Message: fmt.Sprintf("approved by AccessApproval %s", approval.Name), ID: string(approval.UID)}, nil
+			}
+		}
+	}
+
+	if len(reasons) == 0 {
+		return Result{Message: "waiting for approval"}, nil
+	}
+	return Result{Message: "waiting for approval: " + strings.Join(reasons, "; ")}, nil
+}
+
+// matches returns true if the approval applies to the mapping as it currently is.
+func matches(approval *v1beta1.AccessApproval, m Mapping) bool {
+	if approval.Spec.Kind != m.Kind || approval.Spec.Namespace != m.Namespace || approval.Spec.Name != m.Name || approval.Spec.ARN != m.ARN {
+		return false
+	}
+	if canonicalRBAC(approval.Spec.RBAC) != canonicalRBAC(m.RBAC) {
+		return false
+	}
+	return strings.Join(sortedGroups(approval.Spec.Groups), ",") == strings.Join(sortedGroups(m.Groups), ",")
+}
+
+// Sign returns an approval annotation value for the mapping signed by approver with key.
+func Sign(approver string, key ed25519.PrivateKey, m Mapping) string {
+	signature := ed25519.Sign(key, m.Payload())
+	return approver + ":" + base64.StdEncoding.EncodeToString(signature)
+}
+
+// KeyRing maps approver identities to their ed25519 public keys.
+type KeyRing map[string]ed25519.PublicKey
+
+// LoadKeyRing loads a KeyRing from a directory, such as a mounted Secret,
+// holding one file per approver named after the approver identity and
+// containing its base64 encoded ed25519 public key.
+func LoadKeyRing(dir string) (KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	keys := KeyRing{}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("approver %s key: %w", name, err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("approver %s key: invalid ed25519 public key size %d", name, len(key))
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// Verify verifies an approval annotation value over payload, returning the
+// approver identity that signed it.
+func (k KeyRing) Verify(annotation string, payload []byte) (string, error) {
+	i := strings.LastIndex(annotation, ":")
+	if i < 1 {
+		return "", errors.New("malformed approval annotation")
+	}
+	approver, encoded := annotation[:i], annotation[i+1:]
+	key, ok := k[approver]
+	if !ok {
+		return "", fmt.Errorf("approval annotation signed by unknown approver %s", approver)
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed approval annotation signature: %w", err)
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return "", fmt.Errorf("approval annotation signed by %s does not match the mapping", approver)
+	}
+	return approver, nil
+}
+
+// canonicalRBAC returns RBAC bindings in an order-independent form, each
+// ClusterRole followed by the namespaces it is bound in, if any.
+func canonicalRBAC(bindings []v1beta1.RBACBinding) string {
+	canonical := make([]string, 0, len(bindings))
+	for _, binding := range bindings {
+		if len(binding.Namespaces) == 0 {
+			canonical = append(canonical, binding.ClusterRole)
+			continue
+		}
+		canonical = append(canonical, binding.ClusterRole+"@"+strings.Join(sortedGroups(binding.Namespaces), ","))
+	}
+	sort.Strings(canonical)
+	return strings.Join(canonical, ";")
+}
+
+func sortedGroups(groups []string) []string {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return sorted
+}
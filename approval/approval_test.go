@@ -0,0 +1,243 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func newTestMapping() Mapping {
+	return Mapping{
+		Kind:        "MapRole",
+		Name:        "admin",
+		ARN:         "arn:aws:iam::123456789012:role/admin",
+		Groups:      []string{"system:masters", "ops"},
+		CreatedBy:   "alice",
+		RequestedBy: "alice",
+	}
+}
+
+func newTestChecker(objs ...pkgruntime.Object) *Checker {
+	scheme := pkgruntime.NewScheme()
+	gomega.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	return &Checker{
+		Reader:               fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(),
+		Keys:                 KeyRing{},
+		TrustApprovalObjects: true,
+	}
+}
+
+func TestChecker_SignedAnnotation(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	checker := newTestChecker()
+	checker.Keys["bob"] = public
+	checker.Keys["alice"] = public
+
+	m := newTestMapping()
+	m.Annotations = map[string]string{v1beta1.ApprovalAnnotation: Sign("bob", private, m)}
+	result, err := checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeTrue())
+	g.Expect(result.ApprovedBy).To(gomega.Equal("bob"))
+	g.Expect(result.ID).To(gomega.Equal(m.Annotations[v1beta1.ApprovalAnnotation]))
+
+	// Group order does not matter, but group changes invalidate the approval.
+	m.Groups = []string{"ops", "system:masters"}
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeTrue())
+
+	m.Groups = []string{"system:masters"}
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+
+	// Requesters cannot approve their own mappings.
+	m = newTestMapping()
+	m.Annotations = map[string]string{v1beta1.ApprovalAnnotation: Sign("alice", private, m)}
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+
+	// Unknown approvers are rejected.
+	m.Annotations = map[string]string{v1beta1.ApprovalAnnotation: Sign("mallory", private, m)}
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+	g.Expect(result.Message).To(gomega.ContainSubstring("unknown approver mallory"))
+}
+
+func TestChecker_AccessApproval(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	m := newTestMapping()
+	newApproval := func(name, requestedBy string, groups []string) *v1beta1.AccessApproval {
+		return &v1beta1.AccessApproval{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Annotations: map[string]string{
+					v1beta1.CreatedByAnnotation:   name,
+					v1beta1.RequestedByAnnotation: requestedBy,
+				},
+			},
+			Spec: v1beta1.AccessApprovalSpec{Kind: m.Kind, Name: m.Name, ARN: m.ARN, Groups: groups},
+		}
+	}
+
+	checker := newTestChecker(newApproval("self", "alice", m.Groups), newApproval("stale", "bob", []string{"ops"}))
+	result, err := checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+	g.Expect(result.Message).To(gomega.ContainSubstring("approved by requester alice"))
+
+	// An approval created by bob but last changed by alice is hers.
+	checker = newTestChecker(newApproval("bob", "alice", m.Groups))
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+	g.Expect(result.Message).To(gomega.ContainSubstring("AccessApproval bob approved by requester alice"))
+
+	approval := newApproval("bob", "bob", m.Groups)
+	approval.UID = "5f1d1a0e-approval"
+	checker = newTestChecker(approval)
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeTrue())
+	g.Expect(result.ApprovedBy).To(gomega.Equal("bob"))
+	g.Expect(result.ID).To(gomega.Equal("5f1d1a0e-approval"))
+
+	checker.TrustApprovalObjects = false
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+}
+
+func TestChecker_Namespaced(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	m := newTestMapping()
+	m.Kind, m.Namespace = "NamespacedMapRole", "team-a"
+	newApproval := func(namespace string) *v1beta1.AccessApproval {
+		return &v1beta1.AccessApproval{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        namespace,
+				Annotations: map[string]string{v1beta1.RequestedByAnnotation: "bob"},
+			},
+			Spec: v1beta1.AccessApprovalSpec{Kind: m.Kind, Namespace: namespace, Name: m.Name, ARN: m.ARN, Groups: m.Groups},
+		}
+	}
+
+	// Approvals of a mapping of the same name in another namespace do not apply.
+	checker := newTestChecker(newApproval("team-b"))
+	result, err := checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+
+	checker = newTestChecker(newApproval("team-a"))
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeTrue())
+
+	// Neither do signed annotations.
+	other := m
+	other.Namespace = "team-b"
+	checker.Keys["bob"] = public
+	m.Annotations = map[string]string{v1beta1.ApprovalAnnotation: Sign("bob", private, other)}
+	checker.TrustApprovalObjects = false
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+}
+
+func TestChecker_RBAC(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	m := newTestMapping()
+	m.RBAC = []v1beta1.RBACBinding{{ClusterRole: "edit", Namespaces: []string{"b", "a"}}, {ClusterRole: "view"}}
+	approval := &v1beta1.AccessApproval{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin", Annotations: map[string]string{v1beta1.RequestedByAnnotation: "bob"}},
+		Spec: v1beta1.AccessApprovalSpec{Kind: m.Kind, Name: m.Name, ARN: m.ARN, Groups: m.Groups, RBAC: []v1beta1.RBACBinding{
+			{ClusterRole: "view"},
+			{ClusterRole: "edit", Namespaces: []string{"a", "b"}},
+		}},
+	}
+	checker := newTestChecker(approval)
+	checker.Keys["bob"] = public
+	result, err := checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeTrue())
+
+	// Binding another ClusterRole after approval invalidates both kinds of approval.
+	m.Annotations = map[string]string{v1beta1.ApprovalAnnotation: Sign("bob", private, m)}
+	m.RBAC = append(m.RBAC, v1beta1.RBACBinding{ClusterRole: "cluster-admin"})
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+	g.Expect(result.Message).To(gomega.ContainSubstring("does not match the mapping"))
+
+	// So does binding a ClusterRole in another namespace.
+	m.RBAC = []v1beta1.RBACBinding{{ClusterRole: "edit", Namespaces: []string{"a", "b", "c"}}, {ClusterRole: "view"}}
+	result, err = checker.Check(context.Background(), m)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Approved).To(gomega.BeFalse())
+
+	// Mappings without RBAC bindings keep the payload they had before bindings were signed.
+	g.Expect(string(newTestMapping().Payload())).To(gomega.Equal("MapRole\nadmin\narn:aws:iam::123456789012:role/admin\nops,system:masters"))
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	g := gomega.NewWithT(t)
+	dir, err := ioutil.TempDir("", "approvers")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	encoded := base64.StdEncoding.EncodeToString(public)
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "bob"), []byte(encoded+"\n"), 0600)).To(gomega.Succeed())
+	g.Expect(os.Mkdir(filepath.Join(dir, "..data"), 0700)).To(gomega.Succeed())
+
+	keys, err := LoadKeyRing(dir)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(keys).To(gomega.HaveLen(1))
+	g.Expect(keys["bob"]).To(gomega.Equal(public))
+
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "carol"), []byte("bm90IGEga2V5"), 0600)).To(gomega.Succeed())
+	_, err = LoadKeyRing(dir)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
@@ -0,0 +1,125 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package arn parses the ARNs of the AWS IAM principals mapped to Kubernetes
+// identities: IAM roles and users, and STS assumed-role sessions.
+package arn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceType is the type of IAM principal an ARN names.
+type ResourceType string
+
+const (
+	// Role is the resource type of IAM role ARNs, arn:aws:iam::<account>:role/<path><name>.
+	Role ResourceType = "role"
+
+	// User is the resource type of IAM user ARNs, arn:aws:iam::<account>:user/<path><name>.
+	User ResourceType = "user"
+
+	// AssumedRole is the resource type of STS assumed-role session ARNs,
+	// arn:aws:sts::<account>:assumed-role/<name>/<session>.
+	AssumedRole ResourceType = "assumed-role"
+)
+
+// ARN is a parsed IAM principal ARN.
+type ARN struct {
+	Partition    string
+	Service      string
+	AccountID    string
+	ResourceType ResourceType
+
+	// Path is the IAM path of a role or user, "/" if it has none.
+	Path string
+
+	// Name is the name of the role or user, or of the assumed role.
+	Name string
+
+	// SessionName is the session name of an assumed-role ARN.
+	SessionName string
+}
+
+// Parse parses an IAM role, IAM user or STS assumed-role ARN.
+func Parse(s string) (ARN, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ARN{}, fmt.Errorf("malformed ARN %s", s)
+	}
+	a := ARN{Partition: parts[1], Service: parts[2], AccountID: parts[4]}
+	if a.Partition == "" || a.AccountID == "" || parts[3] != "" {
+		return ARN{}, fmt.Errorf("malformed ARN %s", s)
+	}
+	resource := strings.Split(parts[5], "/")
+	a.ResourceType = ResourceType(resource[0])
+	switch {
+	case a.Service == "iam" && (a.ResourceType == Role || a.ResourceType == User) && len(resource) >= 2:
+		a.Path = "/" + strings.Join(resource[1:len(resource)-1], "/")
+		if len(resource) > 2 {
+			a.Path += "/"
+		}
+		a.Name = resource[len(resource)-1]
+	case a.Service == "sts" && a.ResourceType == AssumedRole && len(resource) == 3:
+		a.Name, a.SessionName = resource[1], resource[2]
+		if a.SessionName == "" {
+			return ARN{}, fmt.Errorf("malformed ARN %s", s)
+		}
+	default:
+		return ARN{}, fmt.Errorf("%s is not an IAM role, IAM user or assumed-role ARN", s)
+	}
+	if a.Name == "" || strings.Contains(a.Path, "//") {
+		return ARN{}, fmt.Errorf("malformed ARN %s", s)
+	}
+	return a, nil
+}
+
+// String returns the ARN.
+func (a ARN) String() string {
+	resource := string(a.ResourceType) + a.Path + a.Name
+	if a.ResourceType == AssumedRole {
+		resource = string(a.ResourceType) + "/" + a.Name + "/" + a.SessionName
+	}
+	return fmt.Sprintf("arn:%s:%s::%s:%s", a.Partition, a.Service, a.AccountID, resource)
+}
+
+// IsRole returns whether the ARN names an IAM role or a session of one.
+func (a ARN) IsRole() bool {
+	return a.ResourceType == Role || a.ResourceType == AssumedRole
+}
+
+// IsUser returns whether the ARN names an IAM user.
+func (a ARN) IsUser() bool {
+	return a.ResourceType == User
+}
+
+// Canonical returns the ARN in the form the AWS IAM authenticator matches
+// against: the IAM role ARN without a path for roles and assumed-role
+// sessions, as the authenticator discards the path of the roles it
+// authenticates, and the ARN unchanged for users.
+func (a ARN) Canonical() ARN {
+	if !a.IsRole() {
+		return a
+	}
+	return ARN{
+		Partition:    a.Partition,
+		Service:      "iam",
+		AccountID:    a.AccountID,
+		ResourceType: Role,
+		Path:         "/",
+		Name:         a.Name,
+	}
+}
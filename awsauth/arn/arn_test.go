@@ -0,0 +1,61 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arn
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	a, err := Parse("arn:aws:iam::123456789012:role/team/ops/admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(a).To(gomega.Equal(ARN{Partition: "aws", Service: "iam", AccountID: "123456789012", ResourceType: Role, Path: "/team/ops/", Name: "admin"}))
+	g.Expect(a.String()).To(gomega.Equal("arn:aws:iam::123456789012:role/team/ops/admin"))
+	g.Expect(a.Canonical().String()).To(gomega.Equal("arn:aws:iam::123456789012:role/admin"))
+
+	a, err = Parse("arn:aws-cn:iam::123456789012:user/alice")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(a).To(gomega.Equal(ARN{Partition: "aws-cn", Service: "iam", AccountID: "123456789012", ResourceType: User, Path: "/", Name: "alice"}))
+	g.Expect(a.IsUser()).To(gomega.BeTrue())
+	g.Expect(a.Canonical()).To(gomega.Equal(a))
+
+	a, err = Parse("arn:aws:sts::123456789012:assumed-role/admin/alice@example.com")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(a).To(gomega.Equal(ARN{Partition: "aws", Service: "sts", AccountID: "123456789012", ResourceType: AssumedRole, Name: "admin", SessionName: "alice@example.com"}))
+	g.Expect(a.String()).To(gomega.Equal("arn:aws:sts::123456789012:assumed-role/admin/alice@example.com"))
+	g.Expect(a.IsRole()).To(gomega.BeTrue())
+	g.Expect(a.Canonical().String()).To(gomega.Equal("arn:aws:iam::123456789012:role/admin"))
+
+	for _, s := range []string{
+		"",
+		"admin",
+		"arn:aws:iam::123456789012",
+		"arn:aws:iam::123456789012:role/",
+		"arn:aws:iam::123456789012:role//admin",
+		"arn:aws:iam:us-east-1:123456789012:role/admin",
+		"arn:aws:iam:::role/admin",
+		"arn:aws:iam::123456789012:group/admins",
+		"arn:aws:sts::123456789012:assumed-role/admin",
+		"arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy",
+	} {
+		_, err := Parse(s)
+		g.Expect(err).To(gomega.HaveOccurred(), s)
+	}
+}
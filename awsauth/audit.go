@@ -0,0 +1,263 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	kcorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Trigger identifies the object whose reconciliation changed the auth map,
+// and the identity that requested the change.
+type Trigger struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Requester string `json:"requester,omitempty"`
+}
+
+// AuditEntry is a mapRoles or mapUsers item of the auth map.
+type AuditEntry struct {
+	ARN    string   `json:"arn"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// AuditChange is the difference between the items of the auth map keyed by a
+// username before and after an update. Before is nil for added items, and
+// After is nil for removed items.
+type AuditChange struct {
+	DataType DataType    `json:"dataType"`
+	Username string      `json:"username"`
+	Before   *AuditEntry `json:"before,omitempty"`
+	After    *AuditEntry `json:"after,omitempty"`
+}
+
+// AuditRecord is a structured record of an update of the auth map.
+type AuditRecord struct {
+	Time      time.Time     `json:"time"`
+	Cluster   string        `json:"cluster,omitempty"`
+	Operation OperationType `json:"operation"`
+	Username  string        `json:"username"`
+	Trigger   *Trigger      `json:"trigger,omitempty"`
+	Changes   []AuditChange `json:"changes"`
+}
+
+// AuditSink stores audit records.
+type AuditSink interface {
+	Write(ctx context.Context, record *AuditRecord) error
+}
+
+// AuditSinks writes audit records to every sink it holds.
+type AuditSinks []AuditSink
+
+// Write writes the record to every sink, returning the aggregated errors.
+func (sinks AuditSinks) Write(ctx context.Context, record *AuditRecord) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+// LogAuditSink writes audit records to a logger.
+type LogAuditSink struct {
+	Log logr.Logger
+}
+
+// Write logs the record.
+func (s LogAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.Log.Info("aws-auth changed", "record", record)
+	return nil
+}
+
+// DefaultAuditHistoryLimit is the number of records kept by a
+// ConfigMapAuditSink without a limit.
+const DefaultAuditHistoryLimit = 500
+
+// ConfigMapAuditSink appends audit records to a history ConfigMap, one
+// JSON record per key. Keys are named after the record times, so that they
+// sort chronologically, and the oldest are dropped beyond Limit records or
+// MaxAuthMapSize bytes to keep the ConfigMap within its size limit.
+type ConfigMapAuditSink struct {
+	KubeClient kubernetes.Interface
+	Namespace  string
+	Name       string
+	Limit      int
+}
+
+// auditKeyFormat formats record times as ConfigMap keys.
+const auditKeyFormat = "20060102T150405.000000000Z"
+
+// Write appends the record to the history ConfigMap, creating it if needed.
+func (s ConfigMapAuditSink) Write(ctx context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	limit := s.Limit
+	if limit < 1 {
+		limit = DefaultAuditHistoryLimit
+	}
+	configMaps := s.KubeClient.CoreV1().ConfigMaps(s.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, s.Name, apismetav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &kcorev1.ConfigMap{ObjectMeta: apismetav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace}}
+			cm.Data = map[string]string{auditKey(cm.Data, record.Time): string(data)}
+			_, err = configMaps.Create(ctx, cm, apismetav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(kcorev1.Resource("configmaps"), s.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[auditKey(cm.Data, record.Time)] = string(data)
+		size := authMapSize(cm.Data, cm.BinaryData)
+		if len(cm.Data) > limit || size > MaxAuthMapSize {
+			keys := make([]string, 0, len(cm.Data))
+			for key := range cm.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys[:len(keys)-1] {
+				if len(cm.Data) <= limit && size <= MaxAuthMapSize {
+					break
+				}
+				size -= len(key) + len(cm.Data[key])
+				delete(cm.Data, key)
+			}
+		}
+		_, err = configMaps.Update(ctx, cm, apismetav1.UpdateOptions{})
+		return err
+	})
+}
+
+// auditKey returns an unused key for a record made at t.
+func auditKey(data map[string]string, t time.Time) string {
+	key := t.UTC().Format(auditKeyFormat)
+	for i := 1; ; i++ {
+		if _, ok := data[key]; !ok {
+			return key
+		}
+		key = fmt.Sprintf("%s-%d", t.UTC().Format(auditKeyFormat), i)
+	}
+}
+
+// WebhookAuditSink posts audit records as JSON to a URL.
+type WebhookAuditSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Write posts the record, returning an error unless the response is successful.
+func (s WebhookAuditSink) Write(ctx context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type auditKeyType struct {
+	dataType DataType
+	username string
+}
+
+// auditEntries returns a copy of the items of the auth map, by username.
+func auditEntries(authData AwsAuthData) map[auditKeyType]AuditEntry {
+	entries := map[auditKeyType]AuditEntry{}
+	for _, mapRole := range authData.MapRoles {
+		entries[auditKeyType{MapRoleData, mapRole.Username}] = AuditEntry{
+			ARN:    mapRole.RoleARN,
+			Groups: append([]string(nil), mapRole.Groups...),
+		}
+	}
+	for _, mapUser := range authData.MapUsers {
+		entries[auditKeyType{MapUserData, mapUser.Username}] = AuditEntry{
+			ARN:    mapUser.UserARN,
+			Groups: append([]string(nil), mapUser.Groups...),
+		}
+	}
+	return entries
+}
+
+// diffAuditEntries returns the changes between two copies of the items of
+// the auth map, sorted by data type and username.
+func diffAuditEntries(before, after map[auditKeyType]AuditEntry) []AuditChange {
+	var changes []AuditChange
+	for key, entry := range before {
+		entry := entry
+		change := AuditChange{DataType: key.dataType, Username: key.username, Before: &entry}
+		if afterEntry, ok := after[key]; ok {
+			if afterEntry.ARN == entry.ARN && strings.Join(afterEntry.Groups, "\n") == strings.Join(entry.Groups, "\n") {
+				continue
+			}
+			change.After = &afterEntry
+		}
+		changes = append(changes, change)
+	}
+	for key, entry := range after {
+		if _, ok := before[key]; !ok {
+			entry := entry
+			changes = append(changes, AuditChange{DataType: key.dataType, Username: key.username, After: &entry})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].DataType != changes[j].DataType {
+			return changes[i].DataType < changes[j].DataType
+		}
+		return changes[i].Username < changes[j].Username
+	})
+	return changes
+}
@@ -0,0 +1,183 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMapper_Audit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	var records []*AuditRecord
+	mapper := NewMapper(client, true)
+	mapper.Audit = func(record *AuditRecord) {
+		records = append(records, record)
+	}
+
+	upsert := func(groups ...string) {
+		err := mapper.Upsert(&Arguments{
+			DataType: MapRoleData,
+			RoleARN:  testARNs["node-2"],
+			Username: "node-2",
+			Groups:   groups,
+		})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	upsert("system:nodes")
+	g.Expect(records).To(gomega.HaveLen(1))
+	g.Expect(records[0].Operation).To(gomega.Equal(UpsertOperation))
+	g.Expect(records[0].Username).To(gomega.Equal("node-2"))
+	g.Expect(records[0].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapRoleData,
+		Username: "node-2",
+		After:    &AuditEntry{ARN: testARNs["node-2"], Groups: []string{"system:nodes"}},
+	}}))
+
+	// Upserts not changing the auth map are not audited.
+	upsert("system:nodes")
+	g.Expect(records).To(gomega.HaveLen(1))
+
+	upsert("system:nodes", "system:bootstrappers")
+	g.Expect(records).To(gomega.HaveLen(2))
+	g.Expect(records[1].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapRoleData,
+		Username: "node-2",
+		Before:   &AuditEntry{ARN: testARNs["node-2"], Groups: []string{"system:nodes"}},
+		After:    &AuditEntry{ARN: testARNs["node-2"], Groups: []string{"system:nodes", "system:bootstrappers"}},
+	}}))
+
+	err := mapper.Remove(&Arguments{DataType: MapUserData, Username: "admin"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(records).To(gomega.HaveLen(3))
+	g.Expect(records[2].Operation).To(gomega.Equal(RemoveOperation))
+	g.Expect(records[2].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapUserData,
+		Username: "admin",
+		Before:   &AuditEntry{ARN: testARNs["user-1"], Groups: []string{"system:masters"}},
+	}}))
+}
+
+func TestService_Audit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	sink := &recordingAuditSink{}
+	trigger := &Trigger{Kind: "MapRole", Name: "node-2", Requester: "alice"}
+	svc, err := NewService(&ServiceConfig{KubeClient: client, AuditSink: sink, Trigger: trigger, Cluster: "prod"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(svc.UpsertMapRole("node-2", MapRole{RoleARN: testARNs["node-2"]})).To(gomega.Succeed())
+	g.Expect(sink.records).To(gomega.HaveLen(1))
+	g.Expect(sink.records[0].Trigger).To(gomega.Equal(trigger))
+	g.Expect(sink.records[0].Cluster).To(gomega.Equal("prod"))
+}
+
+type recordingAuditSink struct {
+	records []*AuditRecord
+}
+
+func (s *recordingAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestConfigMapAuditSink(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	sink := ConfigMapAuditSink{KubeClient: client, Namespace: "audit", Name: "aws-auth-history", Limit: 2}
+
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i, username := range []string{"first", "second", "third"} {
+		// The first two records are made at the same time.
+		recordTime := now.Add(time.Duration(i/2) * time.Second)
+		g.Expect(sink.Write(ctx, &AuditRecord{Time: recordTime, Operation: UpsertOperation, Username: username})).To(gomega.Succeed())
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("audit").Get(ctx, "aws-auth-history", apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cm.Data).To(gomega.HaveLen(2))
+	g.Expect(cm.Data).To(gomega.HaveKey("20210601T090000.000000000Z-1"))
+	g.Expect(cm.Data).To(gomega.HaveKey("20210601T090001.000000000Z"))
+
+	var record AuditRecord
+	g.Expect(json.Unmarshal([]byte(cm.Data["20210601T090000.000000000Z-1"]), &record)).To(gomega.Succeed())
+	g.Expect(record.Username).To(gomega.Equal("second"))
+}
+
+func TestWebhookAuditSink(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var received []AuditRecord
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record AuditRecord
+		g.Expect(json.NewDecoder(r.Body).Decode(&record)).To(gomega.Succeed())
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	sink := WebhookAuditSink{URL: server.URL}
+
+	record := &AuditRecord{
+		Operation: RemoveOperation,
+		Username:  "admin",
+		Trigger:   &Trigger{Kind: "MapUser", Name: "admin", Requester: "alice"},
+	}
+	g.Expect(sink.Write(context.Background(), record)).To(gomega.Succeed())
+	g.Expect(received).To(gomega.HaveLen(1))
+	g.Expect(received[0].Trigger).To(gomega.Equal(record.Trigger))
+
+	status = http.StatusInternalServerError
+	g.Expect(sink.Write(context.Background(), record)).To(gomega.MatchError(gomega.ContainSubstring("500")))
+}
+
+func TestConfigMapAuditSink_SizeLimit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	sink := ConfigMapAuditSink{KubeClient: client, Namespace: "audit", Name: "aws-auth-history"}
+
+	// Each record takes more than a third of the size limit of the ConfigMap.
+	groups := []string{strings.Repeat("g", MaxAuthMapSize/3)}
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i, username := range []string{"first", "second", "third", "fourth"} {
+		record := &AuditRecord{Time: now.Add(time.Duration(i) * time.Second), Operation: UpsertOperation, Username: username,
+			Changes: []AuditChange{{DataType: MapRoleData, Username: username, After: &AuditEntry{ARN: "arn", Groups: groups}}}}
+		g.Expect(sink.Write(ctx, record)).To(gomega.Succeed())
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("audit").Get(ctx, "aws-auth-history", apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authMapSize(cm.Data, cm.BinaryData)).To(gomega.BeNumerically("<=", MaxAuthMapSize))
+	g.Expect(cm.Data).To(gomega.HaveLen(2))
+	g.Expect(cm.Data).To(gomega.HaveKey("20210601T090002.000000000Z"))
+	g.Expect(cm.Data).To(gomega.HaveKey("20210601T090003.000000000Z"))
+}
@@ -0,0 +1,47 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+// Backend stores the mappings of IAM principals to Kubernetes identities for
+// a cluster. The Mapper is the backend storing them in the aws-auth ConfigMap.
+type Backend interface {
+	// Upsert updates or inserts the mapping of args.DataType keyed by args.Username.
+	Upsert(args *Arguments) error
+
+	// Remove removes the mapping of args.DataType keyed by args.Username,
+	// returning an error satisfying IsNotFound if there is none.
+	Remove(args *Arguments) error
+}
+
+// BackendType identifies a Backend implementation.
+type BackendType string
+
+const (
+	// ConfigMapBackend stores mappings in the aws-auth ConfigMap.
+	ConfigMapBackend BackendType = "configmap"
+
+	// EKSAccessEntriesBackend stores mappings as EKS access entries.
+	EKSAccessEntriesBackend BackendType = "eks"
+)
+
+// AccessPolicy is an EKS access policy associated with a mapped principal. It
+// is only supported by the EKS access entries backend.
+type AccessPolicy struct {
+	PolicyARN string
+
+	// Namespaces scopes the policy to namespaces, or to the cluster if empty.
+	Namespaces []string
+}
@@ -0,0 +1,193 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
+)
+
+// NewBatcher returns a new Batcher of the aws-auth ConfigMap of client.
+func NewBatcher(client kubernetes.Interface, window time.Duration) *Batcher {
+	return &Batcher{KubernetesClient: client, Window: window}
+}
+
+// Batcher is a Backend storing mappings in the aws-auth ConfigMap, like the
+// Mapper, that coalesces the upserts and removals submitted within Window of
+// the first pending one into a single update of the ConfigMap. Each operation
+// blocks until its batch is applied, and reports and audits its own outcome.
+type Batcher struct {
+	KubernetesClient kubernetes.Interface
+	Window           time.Duration
+
+	// Size, if set, tracks the size of the auth map as it is written.
+	Size *SizeMonitor
+
+	// Owner, if set, is the operator instance the Batcher writes entries as,
+	// as for the Mapper.
+	Owner string
+
+	mu      sync.Mutex
+	pending []*batchOperation
+	timer   *time.Timer
+
+	// flushMu serializes the updates of successive batches.
+	flushMu sync.Mutex
+}
+
+// batchOperation is an operation pending in a batch.
+type batchOperation struct {
+	operation OperationType
+	args      *Arguments
+	done      chan error
+}
+
+// Upsert updates or inserts a mapRole or mapUser item into the auth map, with
+// its principal ARN normalized, in the next batch.
+func (b *Batcher) Upsert(args *Arguments) error {
+	args.Validate()
+	if err := args.normalize(); err != nil {
+		return err
+	}
+	return b.submit("Batcher.Upsert", UpsertOperation, args)
+}
+
+// Remove removes a mapRole or mapUser from the auth map in the next batch.
+func (b *Batcher) Remove(args *Arguments) error {
+	args.Validate()
+	return b.submit("Batcher.Remove", RemoveOperation, args)
+}
+
+// submit adds an operation to the pending batch, scheduling its flush if it is
+// the first one, and waits for its outcome.
+func (b *Batcher) submit(name string, operation OperationType, args *Arguments) (err error) {
+	ctx, span := tracer.Start(args.context(), name, trace.WithAttributes(args.attributes(operation)...))
+	defer func() { endSpan(span, err) }()
+
+	op := &batchOperation{
+		operation: operation,
+		args:      args.withContext(ctx),
+		done:      make(chan error, 1),
+	}
+	b.mu.Lock()
+	b.pending = append(b.pending, op)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.Window, b.flush)
+	}
+	b.mu.Unlock()
+	return <-op.done
+}
+
+// flush applies the pending batch, and reports the outcome of each of its
+// operations.
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	operations := b.pending
+	b.pending = nil
+	b.timer = nil
+	b.mu.Unlock()
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	results, records := b.apply(operations)
+	for i, op := range operations {
+		if records[i] != nil && op.args.Audit != nil {
+			op.args.Audit(records[i])
+		}
+		op.done <- results[i]
+	}
+}
+
+// apply applies operations to the auth map in a single update, retried on
+// conflicts. It returns the outcome of each operation, and the record of its
+// changes if the update succeeded.
+func (b *Batcher) apply(operations []*batchOperation) ([]error, []*AuditRecord) {
+	links := make([]trace.Link, 0, len(operations))
+	for _, op := range operations {
+		links = append(links, trace.Link{SpanContext: trace.SpanContextFromContext(op.args.context())})
+	}
+	ctx, span := tracer.Start(context.Background(), "Batcher.Flush",
+		trace.WithLinks(links...),
+		trace.WithAttributes(tracing.BatchSizeKey.Int(len(operations))))
+
+	results := make([]error, len(operations))
+	records := make([]*AuditRecord, len(operations))
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		authData, configMap, err := ReadAuthMapWithContext(ctx, b.KubernetesClient)
+		if err != nil {
+			return err
+		}
+
+		var applied bool
+		now := time.Now()
+		for i, op := range operations {
+			records[i] = nil
+			before := auditEntries(authData)
+			if op.operation == RemoveOperation {
+				results[i] = removeAuthData(&authData, op.args, b.Owner)
+			} else {
+				results[i] = upsertAuthData(&authData, op.args, b.Owner)
+			}
+			if results[i] != nil {
+				continue
+			}
+			applied = true
+			if changes := diffAuditEntries(before, auditEntries(authData)); len(changes) > 0 {
+				records[i] = &AuditRecord{
+					Time:      now,
+					Operation: op.operation,
+					Username:  op.args.Username,
+					Changes:   changes,
+				}
+			}
+		}
+		if !applied {
+			return nil
+		}
+		size, err := writeAuthMap(ctx, b.KubernetesClient, authData, configMap)
+		if err == nil {
+			b.Size.Observe(size)
+		}
+		return err
+	})
+	endSpan(span, err)
+
+	// Apply the operations of a batch too large as a whole one at a time, so
+	// that only those growing the auth map beyond its limit are refused.
+	if IsTooLarge(err) && len(operations) > 1 {
+		for i, op := range operations {
+			opResults, opRecords := b.apply([]*batchOperation{op})
+			results[i], records[i] = opResults[0], opRecords[0]
+		}
+		return results, records
+	}
+	if err != nil {
+		for i := range operations {
+			if !IsNotFound(results[i]) && !IsOwnedElsewhere(results[i]) {
+				results[i] = err
+			}
+			records[i] = nil
+		}
+	}
+	return results, records
+}
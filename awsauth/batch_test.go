@@ -0,0 +1,134 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestBatcher(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+
+	// The first update conflicts, and the whole batch is retried.
+	var updates int32
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, pkgruntime.Object, error) {
+		if atomic.AddInt32(&updates, 1) == 1 {
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, ConfigMapName, nil)
+		}
+		return false, nil, nil
+	})
+
+	batcher := NewBatcher(client, 50*time.Millisecond)
+	var mu sync.Mutex
+	records := map[string][]*AuditRecord{}
+	audit := func(record *AuditRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		records[record.Username] = append(records[record.Username], record)
+	}
+
+	operations := map[string]func() error{
+		"node-2": func() error {
+			return batcher.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-2"], Username: "node-2", Groups: []string{"system:nodes"}, Audit: audit})
+		},
+		"user-2": func() error {
+			return batcher.Upsert(&Arguments{DataType: MapUserData, UserARN: testARNs["user-2"], Username: "user-2", Groups: []string{"view"}, Audit: audit})
+		},
+		"admin": func() error {
+			return batcher.Remove(&Arguments{DataType: MapUserData, Username: "admin", Audit: audit})
+		},
+		"missing": func() error {
+			return batcher.Remove(&Arguments{DataType: MapRoleData, Username: "missing", Audit: audit})
+		},
+	}
+	var wg sync.WaitGroup
+	results := map[string]error{}
+	for username, operation := range operations {
+		wg.Add(1)
+		go func(username string, operation func() error) {
+			defer wg.Done()
+			err := operation()
+			mu.Lock()
+			defer mu.Unlock()
+			results[username] = err
+		}(username, operation)
+	}
+	wg.Wait()
+
+	g.Expect(atomic.LoadInt32(&updates)).To(gomega.Equal(int32(2)))
+	g.Expect(results["node-2"]).NotTo(gomega.HaveOccurred())
+	g.Expect(results["user-2"]).NotTo(gomega.HaveOccurred())
+	g.Expect(results["admin"]).NotTo(gomega.HaveOccurred())
+	g.Expect(IsNotFound(results["missing"])).To(gomega.BeTrue())
+
+	authData, _, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.MapRoles).To(gomega.HaveLen(2))
+	g.Expect(authData.MapUsers).To(gomega.Equal([]*MapUser{NewMapUser(testARNs["user-2"], "user-2", []string{"view"})}))
+
+	// Each operation is audited with its own changes.
+	g.Expect(records).To(gomega.HaveLen(3))
+	g.Expect(records["node-2"]).To(gomega.HaveLen(1))
+	g.Expect(records["node-2"][0].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapRoleData,
+		Username: "node-2",
+		After:    &AuditEntry{ARN: testARNs["node-2"], Groups: []string{"system:nodes"}},
+	}}))
+	g.Expect(records["admin"][0].Operation).To(gomega.Equal(RemoveOperation))
+	g.Expect(records["admin"][0].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapUserData,
+		Username: "admin",
+		Before:   &AuditEntry{ARN: testARNs["user-1"], Groups: []string{"system:masters"}},
+	}}))
+}
+
+func TestBatcher_Failure(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, pkgruntime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, ConfigMapName, nil)
+	})
+
+	var audited bool
+	batcher := NewBatcher(client, 0)
+	err := batcher.Upsert(&Arguments{
+		DataType: MapRoleData,
+		RoleARN:  testARNs["node-2"],
+		Username: "node-2",
+		Audit:    func(*AuditRecord) { audited = true },
+	})
+	g.Expect(apierrors.IsForbidden(err)).To(gomega.BeTrue())
+	g.Expect(audited).To(gomega.BeFalse())
+
+	// Removals of missing mappings still report they are not found.
+	err = batcher.Remove(&Arguments{DataType: MapRoleData, Username: "missing"})
+	g.Expect(IsNotFound(err)).To(gomega.BeTrue())
+}
@@ -39,12 +39,21 @@ const (
 
 // ReadAuthMap reads the auth ConfigMap and returns AwsAuthData and the read ConfigMap.
 func ReadAuthMap(k kubernetes.Interface) (AwsAuthData, *kcorev1.ConfigMap, error) {
+	return ReadAuthMapWithContext(context.Background(), k)
+}
+
+// ReadAuthMapWithContext is ReadAuthMap with a context, tracing its API calls.
+// It returns the ConfigMap with an error satisfying IsMalformed if its data
+// cannot be parsed completely.
+func ReadAuthMapWithContext(ctx context.Context, k kubernetes.Interface) (AwsAuthData, *kcorev1.ConfigMap, error) {
 	var authData AwsAuthData
 
-	cm, err := k.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), ConfigMapName, apismetav1.GetOptions{})
+	spanCtx, span := tracer.Start(ctx, "ConfigMap.Get")
+	cm, err := k.CoreV1().ConfigMaps(ConfigMapNamespace).Get(spanCtx, ConfigMapName, apismetav1.GetOptions{})
+	endSpan(span, err)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
-			cm, err = CreateAuthMap(k)
+			cm, err = CreateAuthMapWithContext(ctx, k)
 			if err != nil {
 				return authData, cm, err
 			}
@@ -53,50 +62,98 @@ func ReadAuthMap(k kubernetes.Interface) (AwsAuthData, *kcorev1.ConfigMap, error
 		}
 	}
 
-	err = yaml.Unmarshal([]byte(cm.Data["mapRoles"]), &authData.MapRoles)
-	if err != nil {
-		return authData, cm, err
-	}
-
-	err = yaml.Unmarshal([]byte(cm.Data["mapUsers"]), &authData.MapUsers)
+	authData, err = decodeAuthMap(cm)
 	return authData, cm, err
 }
 
+// decodeAuthMap parses the data of the aws-auth ConfigMap. Malformed data is
+// never returned, so that it cannot be rewritten partially parsed.
+func decodeAuthMap(cm *kcorev1.ConfigMap) (AwsAuthData, error) {
+	var authData AwsAuthData
+	if err := parseAuthData("mapRoles", cm.Data["mapRoles"], &authData.MapRoles); err != nil {
+		return AwsAuthData{}, err
+	}
+	if err := parseAuthData("mapUsers", cm.Data["mapUsers"], &authData.MapUsers); err != nil {
+		return AwsAuthData{}, err
+	}
+	if err := validateAuthData(&authData); err != nil {
+		return AwsAuthData{}, err
+	}
+	var err error
+	authData.Owners, err = readOwners(cm)
+	return authData, err
+}
+
 func CreateAuthMap(k kubernetes.Interface) (*kcorev1.ConfigMap, error) {
+	return CreateAuthMapWithContext(context.Background(), k)
+}
+
+// CreateAuthMapWithContext is CreateAuthMap with a context, tracing its API call.
+func CreateAuthMapWithContext(ctx context.Context, k kubernetes.Interface) (*kcorev1.ConfigMap, error) {
 	configMapObject := &kcorev1.ConfigMap{
 		ObjectMeta: apismetav1.ObjectMeta{
 			Name:      ConfigMapName,
 			Namespace: ConfigMapNamespace,
 		},
 	}
-	return k.CoreV1().ConfigMaps(ConfigMapNamespace).Create(context.Background(), configMapObject, apismetav1.CreateOptions{})
+	ctx, span := tracer.Start(ctx, "ConfigMap.Create")
+	cm, err := k.CoreV1().ConfigMaps(ConfigMapNamespace).Create(ctx, configMapObject, apismetav1.CreateOptions{})
+	endSpan(span, err)
+	return cm, err
 }
 
 // UpdateAuthMap updates a given ConfigMap
 func UpdateAuthMap(k kubernetes.Interface, authData AwsAuthData, cm *kcorev1.ConfigMap) error {
+	return UpdateAuthMapWithContext(context.Background(), k, authData, cm)
+}
+
+// UpdateAuthMapWithContext is UpdateAuthMap with a context, tracing its API
+// call. It returns an error satisfying IsTooLarge, without updating the
+// ConfigMap, if its data would exceed MaxAuthMapSize.
+func UpdateAuthMapWithContext(ctx context.Context, k kubernetes.Interface, authData AwsAuthData, cm *kcorev1.ConfigMap) error {
+	_, err := writeAuthMap(ctx, k, authData, cm)
+	return err
+}
+
+// writeAuthMap updates a given ConfigMap, returning the size of its data.
+func writeAuthMap(ctx context.Context, k kubernetes.Interface, authData AwsAuthData, cm *kcorev1.ConfigMap) (int, error) {
 	mapRoles, err := yaml.Marshal(authData.MapRoles)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	mapUsers, err := yaml.Marshal(authData.MapUsers)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	cm.Data = map[string]string{
+	data := map[string]string{
 		"mapRoles": string(mapRoles),
 		"mapUsers": string(mapUsers),
 	}
+	size := authMapSize(data, cm.BinaryData)
+	if size > MaxAuthMapSize {
+		return size, fmt.Errorf("%s/%s ConfigMap of %d bytes %w of %d bytes", ConfigMapNamespace, ConfigMapName, size, ErrTooLarge, MaxAuthMapSize)
+	}
+	cm.Data = data
+	if err := writeOwners(cm, authData.Owners); err != nil {
+		return size, err
+	}
 
-	cm, err = k.CoreV1().ConfigMaps(ConfigMapNamespace).Update(context.Background(), cm, apismetav1.UpdateOptions{})
-	return err
+	ctx, span := tracer.Start(ctx, "ConfigMap.Update")
+	_, err = k.CoreV1().ConfigMaps(ConfigMapNamespace).Update(ctx, cm, apismetav1.UpdateOptions{})
+	endSpan(span, err)
+	return size, err
 }
 
 // AwsAuthData represents the data of the aws-auth configmap
 type AwsAuthData struct {
 	MapRoles []*MapRole `yaml:"mapRoles"`
 	MapUsers []*MapUser `yaml:"mapUsers"`
+
+	// Owners are the operator instances owning entries, recorded in the
+	// OwnersAnnotation of the ConfigMap.
+	Owners map[string]string `yaml:"-"`
 }
 
 // SetMapRoles sets the MapRoles element
@@ -114,6 +171,9 @@ type MapRole struct {
 	RoleARN  string   `yaml:"rolearn"`
 	Username string   `yaml:"username"`
 	Groups   []string `yaml:"groups,omitempty"`
+
+	// AccessPolicies are only supported by the EKS access entries backend.
+	AccessPolicies []AccessPolicy `yaml:"-"`
 }
 
 func (r *MapRole) String() string {
@@ -136,7 +196,7 @@ func (r *MapRole) SetGroups(g []string) *MapRole {
 
 // SetRoleARN sets the Username value
 func (r *MapRole) SetRoleARN(v string) *MapRole {
-	r.Username = v
+	r.RoleARN = v
 	return r
 }
 
@@ -154,6 +214,9 @@ type MapUser struct {
 	UserARN  string   `yaml:"userarn"`
 	Username string   `yaml:"username"`
 	Groups   []string `yaml:"groups,omitempty"`
+
+	// AccessPolicies are only supported by the EKS access entries backend.
+	AccessPolicies []AccessPolicy `yaml:"-"`
 }
 
 func (r *MapUser) String() string {
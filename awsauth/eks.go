@@ -0,0 +1,348 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EKSBackendConfig is the configuration for an EKSBackend object.
+type EKSBackendConfig struct {
+	// ClusterName is the name of the EKS cluster.
+	ClusterName string
+
+	// Region is the AWS region of the EKS cluster, defaulting to that of the
+	// environment.
+	Region string
+
+	// Endpoint overrides the EKS API endpoint.
+	Endpoint string
+}
+
+// eksIndexTTL is how long an EKSBackend trusts its index of the principal
+// ARNs of usernames before listing the access entries again, picking up
+// external changes.
+const eksIndexTTL = 10 * time.Minute
+
+// EKSBackend is the Backend storing mappings as EKS access entries of type
+// STANDARD, with their associated access policies.
+type EKSBackend struct {
+	Client      eksiface.EKSAPI
+	ClusterName string
+
+	// index records the principal ARNs of the access entries of each data
+	// type and username, as listed at indexedAt and changed since.
+	mu        sync.Mutex
+	index     map[eksIndexKey][]string
+	indexedAt time.Time
+	now       func() time.Time
+}
+
+// eksIndexKey keys the access entries of a principal type by username.
+type eksIndexKey struct {
+	dataType DataType
+	username string
+}
+
+// NewEKSBackend returns a new EKSBackend using the AWS credentials of the
+// environment.
+func NewEKSBackend(cfg *EKSBackendConfig) (*EKSBackend, error) {
+	if cfg.ClusterName == "" {
+		return nil, errors.New("eks backend cluster name must be provided")
+	}
+	awsConfig := aws.NewConfig()
+	if cfg.Region != "" {
+		awsConfig.WithRegion(cfg.Region)
+	}
+	if cfg.Endpoint != "" {
+		awsConfig.WithEndpoint(cfg.Endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EKSBackend{Client: eks.New(sess), ClusterName: cfg.ClusterName}, nil
+}
+
+// Upsert creates or updates the access entry of the principal of args, and
+// associates its access policies, disassociating any others.
+func (b *EKSBackend) Upsert(args *Arguments) (err error) {
+	ctx, span := tracer.Start(args.context(), "EKSBackend.Upsert", trace.WithAttributes(args.attributes(UpsertOperation)...))
+	defer func() { endSpan(span, err) }()
+	principalARN := args.principalARN()
+
+	// Delete the access entries of the username for other principals, such as
+	// a former ARN of the mapping, which would otherwise keep their access.
+	principalARNs, err := b.principalARNs(ctx, args.DataType, args.Username)
+	if err != nil {
+		return err
+	}
+	for _, former := range principalARNs {
+		if former != principalARN {
+			if err := b.deleteAccessEntry(ctx, args.DataType, args.Username, former); err != nil {
+				return err
+			}
+		}
+	}
+
+	entry, err := b.describeAccessEntry(ctx, principalARN)
+	switch {
+	case err != nil:
+		return err
+	case entry == nil:
+		if err := b.createAccessEntry(ctx, principalARN, args.Username, args.Groups); err != nil {
+			return err
+		}
+	case aws.StringValue(entry.Username) != args.Username || !equalGroups(aws.StringValueSlice(entry.KubernetesGroups), args.Groups):
+		if _, err := b.Client.UpdateAccessEntryWithContext(ctx, &eks.UpdateAccessEntryInput{
+			ClusterName:      aws.String(b.ClusterName),
+			PrincipalArn:     aws.String(principalARN),
+			Username:         aws.String(args.Username),
+			KubernetesGroups: aws.StringSlice(args.Groups),
+		}); err != nil {
+			return err
+		}
+	}
+	b.record(args.DataType, args.Username, principalARN)
+	return b.syncAccessPolicies(ctx, principalARN, args.AccessPolicies)
+}
+
+// describeAccessEntry returns the access entry of a principal, or nil if it has none.
+func (b *EKSBackend) describeAccessEntry(ctx context.Context, principalARN string) (*eks.AccessEntry, error) {
+	out, err := b.Client.DescribeAccessEntryWithContext(ctx, &eks.DescribeAccessEntryInput{
+		ClusterName:  aws.String(b.ClusterName),
+		PrincipalArn: aws.String(principalARN),
+	})
+	if isEKSNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.AccessEntry, nil
+}
+
+func (b *EKSBackend) createAccessEntry(ctx context.Context, principalARN, username string, groups []string) error {
+	input := &eks.CreateAccessEntryInput{
+		ClusterName:      aws.String(b.ClusterName),
+		PrincipalArn:     aws.String(principalARN),
+		KubernetesGroups: aws.StringSlice(groups),
+		Type:             aws.String("STANDARD"),
+	}
+	if username != "" {
+		input.Username = aws.String(username)
+	}
+	_, err := b.Client.CreateAccessEntryWithContext(ctx, input)
+	return err
+}
+
+// deleteAccessEntry deletes the access entry of a principal recorded for the
+// username, unless it has since been changed to another username.
+func (b *EKSBackend) deleteAccessEntry(ctx context.Context, dataType DataType, username, principalARN string) error {
+	entry, err := b.describeAccessEntry(ctx, principalARN)
+	if err != nil {
+		return err
+	}
+	if entry != nil && aws.StringValue(entry.Username) == username {
+		if _, err := b.Client.DeleteAccessEntryWithContext(ctx, &eks.DeleteAccessEntryInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(principalARN),
+		}); err != nil && !isEKSNotFound(err) {
+			return err
+		}
+	}
+	b.forget(dataType, username, principalARN)
+	return nil
+}
+
+func (b *EKSBackend) syncAccessPolicies(ctx context.Context, principalARN string, policies []AccessPolicy) error {
+	associated := map[string]*eks.AccessScope{}
+	if err := b.Client.ListAssociatedAccessPoliciesPagesWithContext(ctx, &eks.ListAssociatedAccessPoliciesInput{
+		ClusterName:  aws.String(b.ClusterName),
+		PrincipalArn: aws.String(principalARN),
+	}, func(page *eks.ListAssociatedAccessPoliciesOutput, _ bool) bool {
+		for _, policy := range page.AssociatedAccessPolicies {
+			associated[aws.StringValue(policy.PolicyArn)] = policy.AccessScope
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+
+	desired := map[string]bool{}
+	for _, policy := range policies {
+		desired[policy.PolicyARN] = true
+		scope := &eks.AccessScope{Type: aws.String(eks.AccessScopeTypeCluster)}
+		if len(policy.Namespaces) > 0 {
+			scope = &eks.AccessScope{Type: aws.String(eks.AccessScopeTypeNamespace), Namespaces: aws.StringSlice(policy.Namespaces)}
+		}
+		if current, ok := associated[policy.PolicyARN]; ok && aws.StringValue(current.Type) == aws.StringValue(scope.Type) &&
+			equalGroups(aws.StringValueSlice(current.Namespaces), policy.Namespaces) {
+			continue
+		}
+		if _, err := b.Client.AssociateAccessPolicyWithContext(ctx, &eks.AssociateAccessPolicyInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(principalARN),
+			PolicyArn:    aws.String(policy.PolicyARN),
+			AccessScope:  scope,
+		}); err != nil {
+			return err
+		}
+	}
+	for policyARN := range associated {
+		if desired[policyARN] {
+			continue
+		}
+		if _, err := b.Client.DisassociateAccessPolicyWithContext(ctx, &eks.DisassociateAccessPolicyInput{
+			ClusterName:  aws.String(b.ClusterName),
+			PrincipalArn: aws.String(principalARN),
+			PolicyArn:    aws.String(policyARN),
+		}); err != nil && !isEKSNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes the access entries of the principal type of args.DataType
+// with username args.Username, with their access policy associations.
+func (b *EKSBackend) Remove(args *Arguments) (err error) {
+	ctx, span := tracer.Start(args.context(), "EKSBackend.Remove", trace.WithAttributes(args.attributes(RemoveOperation)...))
+	defer func() { endSpan(span, err) }()
+
+	principalARNs, err := b.principalARNs(ctx, args.DataType, args.Username)
+	if err != nil {
+		return err
+	}
+	if len(principalARNs) == 0 {
+		return fmt.Errorf("%s with username '%s' %w", args.DataType, args.Username, ErrNotFound)
+	}
+	for _, principalARN := range principalARNs {
+		if err := b.deleteAccessEntry(ctx, args.DataType, args.Username, principalARN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// principalARNs returns the principal ARNs of the access entries of the
+// principal type of dataType with username, listing and describing every
+// access entry of the cluster if the index has expired.
+func (b *EKSBackend) principalARNs(ctx context.Context, dataType DataType, username string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.now == nil {
+		b.now = time.Now
+	}
+	if b.index == nil || b.now().Sub(b.indexedAt) > eksIndexTTL {
+		var principalARNs []string
+		if err := b.Client.ListAccessEntriesPagesWithContext(ctx, &eks.ListAccessEntriesInput{
+			ClusterName: aws.String(b.ClusterName),
+		}, func(page *eks.ListAccessEntriesOutput, _ bool) bool {
+			principalARNs = append(principalARNs, aws.StringValueSlice(page.AccessEntries)...)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		index := map[eksIndexKey][]string{}
+		for _, principalARN := range principalARNs {
+			entry, err := b.describeAccessEntry(ctx, principalARN)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				continue
+			}
+			key := eksIndexKey{dataType: MapRoleData, username: aws.StringValue(entry.Username)}
+			if strings.Contains(principalARN, ":user/") {
+				key.dataType = MapUserData
+			}
+			index[key] = append(index[key], principalARN)
+		}
+		b.index, b.indexedAt = index, b.now()
+	}
+	return append([]string(nil), b.index[eksIndexKey{dataType: dataType, username: username}]...), nil
+}
+
+// record records that the access entry of principalARN has username,
+// replacing any other username recorded for it.
+func (b *EKSBackend) record(dataType DataType, username, principalARN string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.index == nil {
+		return
+	}
+	for key, principalARNs := range b.index {
+		b.index[key] = without(principalARNs, principalARN)
+	}
+	key := eksIndexKey{dataType: dataType, username: username}
+	b.index[key] = append(b.index[key], principalARN)
+}
+
+// forget forgets the access entry of principalARN recorded for username.
+func (b *EKSBackend) forget(dataType DataType, username, principalARN string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := eksIndexKey{dataType: dataType, username: username}
+	if principalARNs, ok := b.index[key]; ok {
+		b.index[key] = without(principalARNs, principalARN)
+	}
+}
+
+// without returns values without value.
+func without(values []string, value string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func isEKSNotFound(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == eks.ErrCodeResourceNotFoundException
+}
+
+// equalGroups returns whether a and b hold the same strings in any order.
+func equalGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,270 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/gomega"
+)
+
+type fakeAccessScope struct {
+	Type       string   `json:"type"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+type fakeAccessEntry struct {
+	PrincipalArn     string   `json:"principalArn"`
+	Username         string   `json:"username,omitempty"`
+	KubernetesGroups []string `json:"kubernetesGroups,omitempty"`
+	Type             string   `json:"type,omitempty"`
+}
+
+type fakeAssociatedAccessPolicy struct {
+	PolicyArn   string           `json:"policyArn"`
+	AccessScope *fakeAccessScope `json:"accessScope"`
+}
+
+// fakeEKS is a local HTTP stand-in for the access entries API of an EKS endpoint.
+type fakeEKS struct {
+	mu       sync.Mutex
+	entries  map[string]*fakeAccessEntry
+	policies map[string]map[string]*fakeAccessScope
+	calls    []string
+}
+
+func newFakeEKS() *fakeEKS {
+	return &fakeEKS{
+		entries:  map[string]*fakeAccessEntry{},
+		policies: map[string]map[string]*fakeAccessScope{},
+	}
+}
+
+func (f *fakeEKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// URI labels such as principal ARNs are escaped, and may contain slashes.
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		unescaped, _ := url.PathUnescape(segment)
+		segments = append(segments, unescaped)
+	}
+	if len(segments) < 3 || segments[0] != "clusters" || segments[2] != "access-entries" {
+		http.NotFound(w, r)
+		return
+	}
+	f.calls = append(f.calls, r.Method+" "+strings.Join(segments[2:], " "))
+
+	switch {
+	case len(segments) == 3 && r.Method == http.MethodGet:
+		principalARNs := []string{}
+		for principalARN := range f.entries {
+			principalARNs = append(principalARNs, principalARN)
+		}
+		sort.Strings(principalARNs)
+		f.respond(w, map[string]interface{}{"accessEntries": principalARNs})
+	case len(segments) == 3 && r.Method == http.MethodPost:
+		var entry fakeAccessEntry
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+		f.entries[entry.PrincipalArn] = &entry
+		f.respond(w, map[string]interface{}{"accessEntry": entry})
+	case len(segments) >= 4 && f.entries[segments[3]] == nil:
+		w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException")
+		w.WriteHeader(http.StatusNotFound)
+		f.respond(w, map[string]string{"message": "access entry not found"})
+	case len(segments) == 4 && r.Method == http.MethodGet:
+		f.respond(w, map[string]interface{}{"accessEntry": f.entries[segments[3]]})
+	case len(segments) == 4 && r.Method == http.MethodPost:
+		entry := f.entries[segments[3]]
+		_ = json.NewDecoder(r.Body).Decode(entry)
+		f.respond(w, map[string]interface{}{"accessEntry": entry})
+	case len(segments) == 4 && r.Method == http.MethodDelete:
+		delete(f.entries, segments[3])
+		delete(f.policies, segments[3])
+		f.respond(w, map[string]interface{}{})
+	case len(segments) == 5 && r.Method == http.MethodGet:
+		policies := []fakeAssociatedAccessPolicy{}
+		for policyARN, scope := range f.policies[segments[3]] {
+			policies = append(policies, fakeAssociatedAccessPolicy{PolicyArn: policyARN, AccessScope: scope})
+		}
+		f.respond(w, map[string]interface{}{"associatedAccessPolicies": policies})
+	case len(segments) == 5 && r.Method == http.MethodPost:
+		var policy fakeAssociatedAccessPolicy
+		_ = json.NewDecoder(r.Body).Decode(&policy)
+		if f.policies[segments[3]] == nil {
+			f.policies[segments[3]] = map[string]*fakeAccessScope{}
+		}
+		f.policies[segments[3]][policy.PolicyArn] = policy.AccessScope
+		f.respond(w, map[string]interface{}{"associatedAccessPolicy": policy})
+	case len(segments) == 6 && r.Method == http.MethodDelete:
+		delete(f.policies[segments[3]], segments[5])
+		f.respond(w, map[string]interface{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEKS) respond(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newTestEKSBackend(t *testing.T, g *gomega.WithT) (*EKSBackend, *fakeEKS) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	fake := newFakeEKS()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	backend, err := NewEKSBackend(&EKSBackendConfig{
+		ClusterName: "test",
+		Region:      "us-east-1",
+		Endpoint:    server.URL,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	return backend, fake
+}
+
+func TestEKSBackend_Upsert(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, fake := newTestEKSBackend(t, g)
+	svc, err := NewService(&ServiceConfig{Backend: backend, Log: logr.Discard()})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	roleARN := "arn:aws:iam::00000000000:role/path/admin"
+	viewPolicy := "arn:aws:eks::aws:cluster-access-policy/AmazonEKSViewPolicy"
+	editPolicy := "arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy"
+
+	err = svc.UpsertMapRole("admin", MapRole{
+		RoleARN:        roleARN,
+		Groups:         []string{"ops"},
+		AccessPolicies: []AccessPolicy{{PolicyARN: viewPolicy}},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.entries).To(gomega.HaveKey(roleARN))
+	g.Expect(fake.entries[roleARN].Username).To(gomega.Equal("admin"))
+	g.Expect(fake.entries[roleARN].KubernetesGroups).To(gomega.Equal([]string{"ops"}))
+	g.Expect(fake.entries[roleARN].Type).To(gomega.Equal("STANDARD"))
+	g.Expect(fake.policies[roleARN]).To(gomega.Equal(map[string]*fakeAccessScope{viewPolicy: {Type: "cluster"}}))
+
+	// Unchanged mappings are left alone.
+	fake.calls = nil
+	err = svc.UpsertMapRole("admin", MapRole{
+		RoleARN:        roleARN,
+		Groups:         []string{"ops"},
+		AccessPolicies: []AccessPolicy{{PolicyARN: viewPolicy}},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.calls).To(gomega.Equal([]string{
+		"GET access-entries " + roleARN,
+		"GET access-entries " + roleARN + " access-policies",
+	}))
+
+	// Changed groups and policies are updated, and stale policies disassociated.
+	err = svc.UpsertMapRole("admin", MapRole{
+		RoleARN:        roleARN,
+		Groups:         []string{"ops", "dev"},
+		AccessPolicies: []AccessPolicy{{PolicyARN: editPolicy, Namespaces: []string{"payments"}}},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fake.entries[roleARN].KubernetesGroups).To(gomega.Equal([]string{"ops", "dev"}))
+	g.Expect(fake.policies[roleARN]).To(gomega.Equal(map[string]*fakeAccessScope{
+		editPolicy: {Type: "namespace", Namespaces: []string{"payments"}},
+	}))
+}
+
+func TestEKSBackend_Remove(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, fake := newTestEKSBackend(t, g)
+	g.Expect(backend.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-1"], Username: "admin"})).To(gomega.Succeed())
+	g.Expect(backend.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-2"], Username: "node"})).To(gomega.Succeed())
+	g.Expect(backend.Upsert(&Arguments{DataType: MapUserData, UserARN: testARNs["user-1"], Username: "admin"})).To(gomega.Succeed())
+
+	// Only entries of the principal type with the username are removed.
+	g.Expect(backend.Remove(&Arguments{DataType: MapRoleData, Username: "admin"})).To(gomega.Succeed())
+	g.Expect(fake.entries).To(gomega.HaveLen(2))
+	g.Expect(fake.entries).To(gomega.HaveKey(testARNs["node-2"]))
+	g.Expect(fake.entries).To(gomega.HaveKey(testARNs["user-1"]))
+
+	err := backend.Remove(&Arguments{DataType: MapRoleData, Username: "admin"})
+	g.Expect(IsNotFound(err)).To(gomega.BeTrue())
+}
+
+func TestEKSBackend_Upsert_ChangedARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, fake := newTestEKSBackend(t, g)
+	g.Expect(backend.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-1"], Username: "admin", Groups: []string{"ops"}})).To(gomega.Succeed())
+	g.Expect(backend.Upsert(&Arguments{DataType: MapUserData, UserARN: testARNs["user-1"], Username: "admin", Groups: []string{"ops"}})).To(gomega.Succeed())
+
+	// The access entry of the former principal of the username is deleted.
+	g.Expect(backend.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-2"], Username: "admin", Groups: []string{"ops"}})).To(gomega.Succeed())
+	g.Expect(fake.entries).To(gomega.HaveLen(2))
+	g.Expect(fake.entries).To(gomega.HaveKey(testARNs["node-2"]))
+	g.Expect(fake.entries).To(gomega.HaveKey(testARNs["user-1"]))
+
+	// Entries changed by others since they were indexed are left alone.
+	fake.entries[testARNs["node-2"]].Username = "other"
+	g.Expect(backend.Upsert(&Arguments{DataType: MapRoleData, RoleARN: testARNs["node-1"], Username: "admin", Groups: []string{"ops"}})).To(gomega.Succeed())
+	g.Expect(fake.entries).To(gomega.HaveLen(3))
+}
+
+func TestEKSBackend_Remove_Index(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, fake := newTestEKSBackend(t, g)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend.now = func() time.Time { return now }
+	fake.entries[testARNs["node-1"]] = &fakeAccessEntry{PrincipalArn: testARNs["node-1"], Username: "admin"}
+	fake.entries[testARNs["node-2"]] = &fakeAccessEntry{PrincipalArn: testARNs["node-2"], Username: "node"}
+	fake.entries[testARNs["user-1"]] = &fakeAccessEntry{PrincipalArn: testARNs["user-1"], Username: "user"}
+
+	// Access entries are described once, and then looked up in the index.
+	g.Expect(backend.Remove(&Arguments{DataType: MapRoleData, Username: "admin"})).To(gomega.Succeed())
+	fake.calls = nil
+	g.Expect(backend.Remove(&Arguments{DataType: MapRoleData, Username: "node"})).To(gomega.Succeed())
+	g.Expect(fake.calls).To(gomega.Equal([]string{
+		"GET access-entries " + testARNs["node-2"],
+		"DELETE access-entries " + testARNs["node-2"],
+	}))
+	err := backend.Remove(&Arguments{DataType: MapRoleData, Username: "added"})
+	g.Expect(IsNotFound(err)).To(gomega.BeTrue())
+
+	// Access entries added by others are found once the index expires.
+	fake.entries[testARNs["node-1"]] = &fakeAccessEntry{PrincipalArn: testARNs["node-1"], Username: "added"}
+	now = now.Add(eksIndexTTL + time.Second)
+	g.Expect(backend.Remove(&Arguments{DataType: MapRoleData, Username: "added"})).To(gomega.Succeed())
+	g.Expect(fake.entries).To(gomega.HaveLen(1))
+}
+
+func TestEKSBackend_Context(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, fake := newTestEKSBackend(t, g)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := backend.Upsert(&Arguments{Context: ctx, DataType: MapRoleData, RoleARN: testARNs["node-1"], Username: "admin"})
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("canceled")))
+	g.Expect(fake.entries).To(gomega.BeEmpty())
+}
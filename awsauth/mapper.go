@@ -16,6 +16,7 @@ limitations under the License.
 package awsauth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -23,9 +24,20 @@ import (
 	"reflect"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+	kcorev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// ErrNotFound indicates a mapRole or mapUser was not found in the auth map.
+var ErrNotFound = errors.New("not found in auth map")
+
+// IsNotFound returns true if err indicates a mapRole or mapUser was not found
+// in the auth map.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
 // NewMapper returns a new Mapper object.
 func NewMapper(client kubernetes.Interface, discardLogOutput bool) *Mapper {
 	var mapper = &Mapper{}
@@ -40,11 +52,25 @@ func NewMapper(client kubernetes.Interface, discardLogOutput bool) *Mapper {
 // Mapper is responsible for managing the auth map.
 type Mapper struct {
 	KubernetesClient kubernetes.Interface
+
+	// Audit, if set, is called with a record of each change to the auth map.
+	Audit func(record *AuditRecord)
+
+	// Size, if set, tracks the size of the auth map as it is written.
+	Size *SizeMonitor
+
+	// Owner, if set, is the operator instance the Mapper writes entries as. It
+	// only removes the entries it owns, and refuses to update those owned by
+	// other instances.
+	Owner string
 }
 
 // Remove removes a mapRole or mapUser from the auth map.
-func (m *Mapper) Remove(args *Arguments) error {
+func (m *Mapper) Remove(args *Arguments) (err error) {
 	args.Validate()
+	ctx, span := tracer.Start(args.context(), "Mapper.Remove", trace.WithAttributes(args.attributes(RemoveOperation)...))
+	defer func() { endSpan(span, err) }()
+	args = args.withContext(ctx)
 	if args.WithRetries {
 		return WithRetry(m.removeAuth, args)
 	}
@@ -52,10 +78,24 @@ func (m *Mapper) Remove(args *Arguments) error {
 }
 
 func (m *Mapper) removeAuth(args *Arguments) error {
-	authData, configMap, err := ReadAuthMap(m.KubernetesClient)
+	authData, configMap, err := ReadAuthMapWithContext(args.context(), m.KubernetesClient)
 	if err != nil {
 		return err
 	}
+	before := auditEntries(authData)
+
+	if err := removeAuthData(&authData, args, m.Owner); err != nil {
+		return err
+	}
+	return m.updateAuthMap(RemoveOperation, args, authData, configMap, before)
+}
+
+// removeAuthData removes the mapRole or mapUser of args from authData, if
+// owned by owner when set.
+func removeAuthData(authData *AwsAuthData, args *Arguments, owner string) error {
+	if owner != "" && authData.Owner(args.DataType, args.Username) != owner {
+		return fmt.Errorf("%s with username '%s' owned by operator instance %s %w", args.DataType, args.Username, owner, ErrNotFound)
+	}
 
 	var removed bool
 
@@ -84,14 +124,22 @@ func (m *Mapper) removeAuth(args *Arguments) error {
 	}
 
 	if !removed {
-		return errors.New(fmt.Sprintf("%s with username '%s' not found in auth map", args.DataType, args.Username))
+		return fmt.Errorf("%s with username '%s' %w", args.DataType, args.Username, ErrNotFound)
 	}
-	return UpdateAuthMap(m.KubernetesClient, authData, configMap)
+	authData.SetOwner(args.DataType, args.Username, "")
+	return nil
 }
 
-// Upsert updates or inserts a mapRole or mapUser item into the auth map.
-func (m *Mapper) Upsert(args *Arguments) error {
+// Upsert updates or inserts a mapRole or mapUser item into the auth map, with
+// its principal ARN normalized.
+func (m *Mapper) Upsert(args *Arguments) (err error) {
 	args.Validate()
+	if err := args.normalize(); err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(args.context(), "Mapper.Upsert", trace.WithAttributes(args.attributes(UpsertOperation)...))
+	defer func() { endSpan(span, err) }()
+	args = args.withContext(ctx)
 	if args.WithRetries {
 		return WithRetry(m.upsertAuth, args)
 	}
@@ -99,10 +147,27 @@ func (m *Mapper) Upsert(args *Arguments) error {
 }
 
 func (m *Mapper) upsertAuth(args *Arguments) error {
-	authData, configMap, err := ReadAuthMap(m.KubernetesClient)
+	authData, configMap, err := ReadAuthMapWithContext(args.context(), m.KubernetesClient)
 	if err != nil {
 		return err
 	}
+	before := auditEntries(authData)
+
+	if err := upsertAuthData(&authData, args, m.Owner); err != nil {
+		return err
+	}
+	return m.updateAuthMap(UpsertOperation, args, authData, configMap, before)
+}
+
+// upsertAuthData updates or inserts the mapRole or mapUser of args into
+// authData, owned by owner when set.
+func upsertAuthData(authData *AwsAuthData, args *Arguments, owner string) error {
+	if err := checkOwner(authData, args, owner); err != nil {
+		return err
+	}
+	if owner != "" {
+		authData.SetOwner(args.DataType, args.Username, owner)
+	}
 
 	if args.DataType == MapRoleData {
 		mapRole := NewMapRole(args.RoleARN, args.Username, args.Groups)
@@ -125,8 +190,35 @@ func (m *Mapper) upsertAuth(args *Arguments) error {
 		}
 		authData.SetMapUsers(newMap)
 	}
+	return nil
+}
 
-	return UpdateAuthMap(m.KubernetesClient, authData, configMap)
+// updateAuthMap updates the auth map, and audits its changes from the items
+// it had before.
+func (m *Mapper) updateAuthMap(operation OperationType, args *Arguments, authData AwsAuthData, configMap *kcorev1.ConfigMap, before map[auditKeyType]AuditEntry) error {
+	size, err := writeAuthMap(args.context(), m.KubernetesClient, authData, configMap)
+	if err != nil {
+		return err
+	}
+	m.Size.Observe(size)
+	audit := args.Audit
+	if audit == nil {
+		audit = m.Audit
+	}
+	if audit == nil {
+		return nil
+	}
+	changes := diffAuditEntries(before, auditEntries(authData))
+	if len(changes) == 0 {
+		return nil
+	}
+	audit(&AuditRecord{
+		Time:      time.Now(),
+		Operation: operation,
+		Username:  args.Username,
+		Changes:   changes,
+	})
+	return nil
 }
 
 func upsertRole(authMaps []*MapRole, resource *MapRole) ([]*MapRole, bool) {
@@ -191,6 +283,17 @@ type Arguments struct {
 	MinRetryTime  time.Duration
 	MaxRetryTime  time.Duration
 	MaxRetryCount int
+
+	// AccessPolicies are only supported by the EKS access entries backend.
+	AccessPolicies []AccessPolicy
+
+	// Context carries the trace of the operation, defaulting to the
+	// background context.
+	Context context.Context
+
+	// Audit, if set, is called with a record of the changes made by the
+	// operation, in place of the Audit of the Mapper.
+	Audit func(record *AuditRecord)
 }
 
 // Validate validates if all Arguments fields are valid.
@@ -227,6 +330,7 @@ type OperationType string
 const (
 	UpsertOperation OperationType = "upsert"
 	RemoveOperation OperationType = "remove"
+	PruneOperation  OperationType = "prune"
 )
 
 // DataType indicates the auth map management scope.
@@ -71,6 +71,7 @@ func TestMapper_RemoveNotFound(t *testing.T) {
 		Username:      "system:node:{{EC2PrivateDNSName}}-na",
 	})
 	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(IsNotFound(err)).To(gomega.BeTrue())
 
 	err = mapper.Remove(&Arguments{
 		OperationType: RemoveOperation,
@@ -79,6 +80,7 @@ func TestMapper_RemoveNotFound(t *testing.T) {
 		UserARN:       "doesn't matter",
 	})
 	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(IsNotFound(err)).To(gomega.BeTrue())
 
 	auth, _, err := ReadAuthMap(client)
 	g.Expect(err).NotTo(gomega.HaveOccurred())
@@ -296,3 +298,69 @@ func TestMapper_UpsertWithRetries(t *testing.T) {
 	g.Expect(auth.MapUsers[0].Username).To(gomega.Equal("admin"))
 	g.Expect(auth.MapUsers[0].Groups).To(gomega.Equal([]string{"system:some-role"}))
 }
+
+func TestMapper_UpsertNormalizesARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := fake.NewSimpleClientset()
+	mapper := NewMapper(client, true)
+	createMockConfigMap(client)
+
+	err := mapper.Upsert(&Arguments{
+		OperationType: UpsertOperation,
+		DataType:      MapRoleData,
+		RoleARN:       "arn:aws:sts::00000000000:assumed-role/admin/alice",
+		Username:      "admin",
+		Groups:        []string{"system:masters"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	err = mapper.Upsert(&Arguments{
+		OperationType: UpsertOperation,
+		DataType:      MapRoleData,
+		RoleARN:       testARNs["user-2"],
+		Username:      "user-2",
+	})
+	g.Expect(IsInvalidARN(err)).To(gomega.BeTrue())
+
+	auth, _, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	var roleARNs []string
+	for _, mapRole := range auth.MapRoles {
+		if mapRole.Username == "admin" {
+			roleARNs = append(roleARNs, mapRole.RoleARN)
+		}
+	}
+	g.Expect(roleARNs).To(gomega.Equal([]string{"arn:aws:iam::00000000000:role/admin"}))
+}
+
+func TestMapper_UpsertRewritesARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	for _, existingARN := range []string{
+		"arn:aws:iam::00000000000:role/teams/admin",
+		"arn:aws:sts::00000000000:assumed-role/admin/alice",
+	} {
+		client := fake.NewSimpleClientset()
+		createMockConfigMap(client)
+		authData, cm, err := ReadAuthMap(client)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		authData.MapRoles = append(authData.MapRoles, NewMapRole(existingARN, "admin", []string{"system:masters"}))
+		g.Expect(UpdateAuthMap(client, authData, cm)).To(gomega.Succeed())
+
+		// The entry written before ARNs were normalized is rewritten in place.
+		mapper := NewMapper(client, true)
+		err = mapper.Upsert(&Arguments{
+			OperationType: UpsertOperation,
+			DataType:      MapRoleData,
+			RoleARN:       "arn:aws:iam::00000000000:role/admin",
+			Username:      "admin",
+			Groups:        []string{"system:masters"},
+		})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		auth, _, err := ReadAuthMap(client)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(auth.MapRoles).To(gomega.HaveLen(2))
+		g.Expect(auth.MapRoles[1]).To(gomega.Equal(NewMapRole("arn:aws:iam::00000000000:role/admin", "admin", []string{"system:masters"})))
+	}
+}
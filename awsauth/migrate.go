@@ -0,0 +1,189 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MigrationOptions are the options of a migration of the aws-auth ConfigMap
+// to EKS access entries.
+type MigrationOptions struct {
+	// DryRun only reports the entries that would be migrated.
+	DryRun bool
+
+	// RemoveBatchSize is the number of migrated entries whose parity has been
+	// verified to remove from the aws-auth ConfigMap. None are removed if zero,
+	// so entries may be removed in stages by repeating the migration.
+	RemoveBatchSize int
+}
+
+// MigrationEntry is an entry of the aws-auth ConfigMap in a MigrationReport.
+type MigrationEntry struct {
+	DataType DataType `json:"dataType"`
+	ARN      string   `json:"arn"`
+	Username string   `json:"username,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+
+	// Reason explains why the entry could not be migrated.
+	Reason string `json:"reason,omitempty"`
+}
+
+// MigrationReport is the result of a migration of the aws-auth ConfigMap to
+// EKS access entries.
+type MigrationReport struct {
+	// Migrated are the entries with an access entry of the same username and groups.
+	Migrated []MigrationEntry `json:"migrated"`
+
+	// Unrepresentable are the entries that cannot be represented by an access entry.
+	Unrepresentable []MigrationEntry `json:"unrepresentable"`
+
+	// Failed are the entries whose access entry could not be created, or
+	// differs from the entry.
+	Failed []MigrationEntry `json:"failed"`
+
+	// Removed are the migrated entries removed from the aws-auth ConfigMap.
+	Removed []MigrationEntry `json:"removed"`
+}
+
+// String summarizes the report.
+func (r *MigrationReport) String() string {
+	return fmt.Sprintf("%d migrated, %d unrepresentable, %d failed, %d removed",
+		len(r.Migrated), len(r.Unrepresentable), len(r.Failed), len(r.Removed))
+}
+
+// Migrate creates an access entry for each entry of the aws-auth ConfigMap
+// that can be represented by one, verifies that every access entry has the
+// same username and groups as its entry, and removes up to
+// opts.RemoveBatchSize verified entries from the ConfigMap. Existing access
+// entries are never modified.
+func Migrate(ctx context.Context, kubeClient kubernetes.Interface, backend *EKSBackend, opts MigrationOptions) (*MigrationReport, error) {
+	authData, configMap, err := ReadAuthMapWithContext(ctx, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []MigrationEntry
+	for _, mapRole := range authData.MapRoles {
+		entries = append(entries, MigrationEntry{DataType: MapRoleData, ARN: mapRole.RoleARN, Username: mapRole.Username, Groups: mapRole.Groups})
+	}
+	for _, mapUser := range authData.MapUsers {
+		entries = append(entries, MigrationEntry{DataType: MapUserData, ARN: mapUser.UserARN, Username: mapUser.Username, Groups: mapUser.Groups})
+	}
+
+	report := &MigrationReport{}
+	for _, entry := range entries {
+		if entry.Reason = unrepresentableReason(entry); entry.Reason != "" {
+			report.Unrepresentable = append(report.Unrepresentable, entry)
+			continue
+		}
+		if entry.Reason = migrateEntry(ctx, backend, entry, opts.DryRun); entry.Reason != "" {
+			report.Failed = append(report.Failed, entry)
+			continue
+		}
+		report.Migrated = append(report.Migrated, entry)
+	}
+	if opts.DryRun || opts.RemoveBatchSize <= 0 || len(report.Migrated) == 0 {
+		return report, nil
+	}
+
+	// Remove a batch of migrated entries from the ConfigMap in a single update.
+	removed := report.Migrated
+	if len(removed) > opts.RemoveBatchSize {
+		removed = removed[:opts.RemoveBatchSize]
+	}
+	isRemoved := map[string]bool{}
+	key := func(dataType DataType, arn, username string) string {
+		return strings.Join([]string{string(dataType), arn, username}, "\n")
+	}
+	for _, entry := range removed {
+		isRemoved[key(entry.DataType, entry.ARN, entry.Username)] = true
+	}
+	var mapRoles []*MapRole
+	for _, mapRole := range authData.MapRoles {
+		if !isRemoved[key(MapRoleData, mapRole.RoleARN, mapRole.Username)] {
+			mapRoles = append(mapRoles, mapRole)
+		}
+	}
+	var mapUsers []*MapUser
+	for _, mapUser := range authData.MapUsers {
+		if !isRemoved[key(MapUserData, mapUser.UserARN, mapUser.Username)] {
+			mapUsers = append(mapUsers, mapUser)
+		}
+	}
+	authData.SetMapRoles(mapRoles)
+	authData.SetMapUsers(mapUsers)
+	if err := UpdateAuthMap(kubeClient, authData, configMap); err != nil {
+		return report, err
+	}
+	report.Removed = removed
+	return report, nil
+}
+
+// unrepresentableReason returns why an entry cannot be represented by a
+// STANDARD access entry, if it cannot.
+func unrepresentableReason(entry MigrationEntry) string {
+	if strings.Contains(entry.Username, "{{") {
+		return "templated usernames cannot be represented by access entries"
+	}
+	for _, group := range entry.Groups {
+		if group == "system:nodes" || group == "system:bootstrappers" {
+			return "node roles need an EC2_LINUX or EC2_WINDOWS access entry"
+		}
+	}
+	for _, group := range entry.Groups {
+		if strings.HasPrefix(group, "system:") {
+			return fmt.Sprintf("group %s cannot be assigned by access entries, associate an access policy instead", group)
+		}
+	}
+	return ""
+}
+
+// migrateEntry creates the access entry of an entry if it has none, and
+// returns why its access entry differs from it, if it does.
+func migrateEntry(ctx context.Context, backend *EKSBackend, entry MigrationEntry, dryRun bool) string {
+	accessEntry, err := backend.describeAccessEntry(ctx, entry.ARN)
+	if err != nil {
+		return err.Error()
+	}
+	if accessEntry == nil {
+		if dryRun {
+			return ""
+		}
+		if err := backend.createAccessEntry(ctx, entry.ARN, entry.Username, entry.Groups); err != nil {
+			return err.Error()
+		}
+		backend.record(entry.DataType, entry.Username, entry.ARN)
+		if accessEntry, err = backend.describeAccessEntry(ctx, entry.ARN); err != nil {
+			return err.Error()
+		}
+		if accessEntry == nil {
+			return "access entry not found after creation"
+		}
+	}
+	if username := aws.StringValue(accessEntry.Username); entry.Username != "" && username != entry.Username {
+		return fmt.Sprintf("access entry has username %s", username)
+	}
+	if groups := aws.StringValueSlice(accessEntry.KubernetesGroups); !equalGroups(groups, entry.Groups) {
+		return fmt.Sprintf("access entry has groups %s", strings.Join(groups, ", "))
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigrate(t *testing.T) {
+	g := gomega.NewWithT(t)
+	backend, eks := newTestEKSBackend(t, g)
+	client := fake.NewSimpleClientset()
+	authData, configMap, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData.SetMapRoles([]*MapRole{
+		NewMapRole(testARNs["node-1"], "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"}),
+		NewMapRole("arn:aws:iam::00000000000:role/admin", "admin", []string{"system:masters"}),
+		NewMapRole("arn:aws:iam::00000000000:role/ops", "ops", []string{"ops"}),
+		NewMapRole("arn:aws:iam::00000000000:role/dev", "dev", []string{"dev"}),
+	})
+	authData.SetMapUsers([]*MapUser{
+		NewMapUser(testARNs["user-1"], "user-1", []string{"ops"}),
+	})
+	g.Expect(UpdateAuthMap(client, authData, configMap)).To(gomega.Succeed())
+	eks.entries["arn:aws:iam::00000000000:role/dev"] = &fakeAccessEntry{
+		PrincipalArn:     "arn:aws:iam::00000000000:role/dev",
+		Username:         "dev",
+		KubernetesGroups: []string{"admins"},
+	}
+
+	// Dry runs only report the entries that would be migrated.
+	report, err := Migrate(context.Background(), client, backend, MigrationOptions{DryRun: true, RemoveBatchSize: 1})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(report.String()).To(gomega.Equal("2 migrated, 2 unrepresentable, 1 failed, 0 removed"))
+	g.Expect(eks.entries).To(gomega.HaveLen(1))
+
+	report, err = Migrate(context.Background(), client, backend, MigrationOptions{RemoveBatchSize: 1})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(report.String()).To(gomega.Equal("2 migrated, 2 unrepresentable, 1 failed, 1 removed"))
+	g.Expect(report.Unrepresentable[0].Reason).To(gomega.ContainSubstring("templated usernames"))
+	g.Expect(report.Unrepresentable[1].Reason).To(gomega.ContainSubstring("system:masters"))
+	g.Expect(report.Failed[0].ARN).To(gomega.Equal("arn:aws:iam::00000000000:role/dev"))
+	g.Expect(report.Failed[0].Reason).To(gomega.Equal("access entry has groups admins"))
+	g.Expect(report.Removed[0].ARN).To(gomega.Equal("arn:aws:iam::00000000000:role/ops"))
+	g.Expect(eks.entries).To(gomega.HaveLen(3))
+	g.Expect(eks.entries[testARNs["user-1"]].Username).To(gomega.Equal("user-1"))
+
+	// Conflicting access entries are left alone.
+	g.Expect(eks.entries["arn:aws:iam::00000000000:role/dev"].KubernetesGroups).To(gomega.Equal([]string{"admins"}))
+
+	// Repeated migrations remove the remaining migrated entries in stages.
+	report, err = Migrate(context.Background(), client, backend, MigrationOptions{RemoveBatchSize: 1})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(report.String()).To(gomega.Equal("1 migrated, 2 unrepresentable, 1 failed, 1 removed"))
+	authData, _, err = ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.MapRoles).To(gomega.HaveLen(3))
+	g.Expect(authData.MapUsers).To(gomega.BeEmpty())
+}
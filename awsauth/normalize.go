@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// ErrInvalidARN indicates the ARN of a mapRole or mapUser is malformed, or
+// names the wrong type of principal.
+var ErrInvalidARN = errors.New("invalid principal ARN")
+
+// IsInvalidARN returns true if err indicates the ARN of a mapRole or mapUser
+// is invalid.
+func IsInvalidARN(err error) bool {
+	return errors.Is(err, ErrInvalidARN)
+}
+
+// NormalizeARN returns the principal ARN of a mapRole or mapUser in the form
+// the AWS IAM authenticator matches, with a message describing the rewrite if
+// it was changed. Role paths are removed and assumed-role session ARNs are
+// rewritten to their role ARN. User ARNs in mapRoles and role ARNs in
+// mapUsers are rejected.
+func NormalizeARN(dataType DataType, principalARN string) (string, string, error) {
+	parsed, err := arn.Parse(principalARN)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidARN, err)
+	}
+	if dataType == MapRoleData && !parsed.IsRole() {
+		return "", "", fmt.Errorf("%w: %s is not a role ARN", ErrInvalidARN, principalARN)
+	}
+	if dataType == MapUserData && !parsed.IsUser() {
+		return "", "", fmt.Errorf("%w: %s is not a user ARN", ErrInvalidARN, principalARN)
+	}
+	normalized := parsed.Canonical().String()
+	if normalized == principalARN {
+		return normalized, "", nil
+	}
+	return normalized, fmt.Sprintf("rewrote %s to %s", principalARN, normalized), nil
+}
+
+// normalize normalizes the principal ARN of the mapRole or mapUser upserted.
+func (args *Arguments) normalize() error {
+	principalARN := &args.RoleARN
+	if args.DataType == MapUserData {
+		principalARN = &args.UserARN
+	}
+	normalized, rewrite, err := NormalizeARN(args.DataType, *principalARN)
+	if err != nil {
+		return err
+	}
+	if rewrite != "" {
+		log.Printf("%s with username '%s' %s\n", args.DataType, args.Username, rewrite)
+	}
+	*principalARN = normalized
+	return nil
+}
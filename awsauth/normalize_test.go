@@ -0,0 +1,53 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestNormalizeARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	normalized, rewrite, err := NormalizeARN(MapRoleData, "arn:aws:iam::123456789012:role/admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(normalized).To(gomega.Equal("arn:aws:iam::123456789012:role/admin"))
+	g.Expect(rewrite).To(gomega.BeEmpty())
+
+	normalized, rewrite, err = NormalizeARN(MapRoleData, "arn:aws:iam::123456789012:role/team/path/admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(normalized).To(gomega.Equal("arn:aws:iam::123456789012:role/admin"))
+	g.Expect(rewrite).To(gomega.Equal("rewrote arn:aws:iam::123456789012:role/team/path/admin to arn:aws:iam::123456789012:role/admin"))
+
+	normalized, _, err = NormalizeARN(MapRoleData, "arn:aws:sts::123456789012:assumed-role/admin/alice")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(normalized).To(gomega.Equal("arn:aws:iam::123456789012:role/admin"))
+
+	// User paths are part of the ARNs the authenticator matches.
+	normalized, rewrite, err = NormalizeARN(MapUserData, "arn:aws:iam::123456789012:user/team/alice")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(normalized).To(gomega.Equal("arn:aws:iam::123456789012:user/team/alice"))
+	g.Expect(rewrite).To(gomega.BeEmpty())
+
+	_, _, err = NormalizeARN(MapRoleData, "arn:aws:iam::123456789012:user/alice")
+	g.Expect(err).To(gomega.MatchError("invalid principal ARN: arn:aws:iam::123456789012:user/alice is not a role ARN"))
+	_, _, err = NormalizeARN(MapUserData, "arn:aws:sts::123456789012:assumed-role/admin/alice")
+	g.Expect(err).To(gomega.MatchError("invalid principal ARN: arn:aws:sts::123456789012:assumed-role/admin/alice is not a user ARN"))
+	_, _, err = NormalizeARN(MapRoleData, "admin")
+	g.Expect(IsInvalidARN(err)).To(gomega.BeTrue())
+}
@@ -0,0 +1,105 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	kcorev1 "k8s.io/api/core/v1"
+)
+
+// OwnersAnnotation is the annotation of the aws-auth ConfigMap recording the
+// operator instance owning each of its entries, as a JSON object keyed by
+// "<dataType>/<username>".
+const OwnersAnnotation = "aws-auth.samba.tv/owners"
+
+// ErrOwnedElsewhere indicates a mapRole or mapUser is owned by another
+// operator instance.
+var ErrOwnedElsewhere = errors.New("owned by another operator instance")
+
+// IsOwnedElsewhere returns true if err indicates a mapRole or mapUser is owned
+// by another operator instance.
+func IsOwnedElsewhere(err error) bool {
+	return errors.Is(err, ErrOwnedElsewhere)
+}
+
+func ownerKey(dataType DataType, username string) string {
+	return string(dataType) + "/" + username
+}
+
+// Owner returns the operator instance owning the mapRole or mapUser keyed by
+// username, if any.
+func (m *AwsAuthData) Owner(dataType DataType, username string) string {
+	return m.Owners[ownerKey(dataType, username)]
+}
+
+// SetOwner sets the operator instance owning the mapRole or mapUser keyed by
+// username, removing its owner if empty.
+func (m *AwsAuthData) SetOwner(dataType DataType, username, owner string) {
+	if owner == "" {
+		delete(m.Owners, ownerKey(dataType, username))
+		return
+	}
+	if m.Owners == nil {
+		m.Owners = map[string]string{}
+	}
+	m.Owners[ownerKey(dataType, username)] = owner
+}
+
+// checkOwner returns an error satisfying IsOwnedElsewhere if the mapRole or
+// mapUser of args is owned by an operator instance other than owner. Entries
+// are not owned by anyone without an owner.
+func checkOwner(authData *AwsAuthData, args *Arguments, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	if current := authData.Owner(args.DataType, args.Username); current != "" && current != owner {
+		return fmt.Errorf("%s with username '%s' is %w %s", args.DataType, args.Username, ErrOwnedElsewhere, current)
+	}
+	return nil
+}
+
+// readOwners returns the owners recorded in the annotation of cm.
+func readOwners(cm *kcorev1.ConfigMap) (map[string]string, error) {
+	value, ok := cm.Annotations[OwnersAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var owners map[string]string
+	if err := json.Unmarshal([]byte(value), &owners); err != nil {
+		return nil, fmt.Errorf("parsing %s annotation: %w", OwnersAnnotation, err)
+	}
+	return owners, nil
+}
+
+// writeOwners records owners in the annotation of cm, removing it if empty.
+func writeOwners(cm *kcorev1.ConfigMap, owners map[string]string) error {
+	if len(owners) == 0 {
+		delete(cm.Annotations, OwnersAnnotation)
+		return nil
+	}
+	value, err := json.Marshal(owners)
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[OwnersAnnotation] = string(value)
+	return nil
+}
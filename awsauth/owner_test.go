@@ -0,0 +1,82 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMapper_Owner(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	teamA := NewMapper(client, true)
+	teamA.Owner = "team-a"
+	teamB := NewMapper(client, true)
+	teamB.Owner = "team-b"
+	upsert := func(mapper *Mapper, groups ...string) error {
+		return mapper.Upsert(&Arguments{
+			DataType: MapRoleData,
+			RoleARN:  testARNs["node-2"],
+			Username: "node-2",
+			Groups:   groups,
+		})
+	}
+	remove := func(mapper *Mapper) error {
+		return mapper.Remove(&Arguments{DataType: MapRoleData, Username: "node-2"})
+	}
+	annotations := func() map[string]string {
+		cm, err := client.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), ConfigMapName, apismetav1.GetOptions{})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return cm.Annotations
+	}
+
+	g.Expect(upsert(teamA, "system:nodes")).To(gomega.Succeed())
+	g.Expect(annotations()).To(gomega.HaveKeyWithValue(OwnersAnnotation, `{"mapRole/node-2":"team-a"}`))
+
+	// Instances neither update nor remove the entries of other instances.
+	err := upsert(teamB, "system:masters")
+	g.Expect(IsOwnedElsewhere(err)).To(gomega.BeTrue())
+	g.Expect(err.Error()).To(gomega.Equal("mapRole with username 'node-2' is owned by another operator instance team-a"))
+	g.Expect(IsNotFound(remove(teamB))).To(gomega.BeTrue())
+	authData, _, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.MapRoles).To(gomega.HaveLen(2))
+	g.Expect(authData.MapRoles[1].Groups).To(gomega.Equal([]string{"system:nodes"}))
+	g.Expect(authData.Owner(MapRoleData, "node-2")).To(gomega.Equal("team-a"))
+
+	g.Expect(remove(teamA)).To(gomega.Succeed())
+	g.Expect(annotations()).NotTo(gomega.HaveKey(OwnersAnnotation))
+
+	// Entries without an owner are taken over by the instance updating them.
+	g.Expect(teamB.Upsert(&Arguments{
+		DataType: MapUserData,
+		UserARN:  testARNs["user-1"],
+		Username: "admin",
+		Groups:   []string{"system:masters"},
+	})).To(gomega.Succeed())
+	g.Expect(annotations()).To(gomega.HaveKeyWithValue(OwnersAnnotation, `{"mapUser/admin":"team-b"}`))
+
+	// Instances without a name ignore ownership.
+	g.Expect(NewMapper(client, true).Remove(&Arguments{DataType: MapUserData, Username: "admin"})).To(gomega.Succeed())
+	g.Expect(annotations()).NotTo(gomega.HaveKey(OwnersAnnotation))
+}
@@ -0,0 +1,219 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v2"
+	kcorev1 "k8s.io/api/core/v1"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
+)
+
+// PruneCandidatesAnnotation is the annotation of the aws-auth ConfigMap
+// listing the entries an operator in authoritative mode will prune, as a JSON
+// array of PruneCandidate.
+const PruneCandidatesAnnotation = "aws-auth.samba.tv/prune-candidates"
+
+// Entry is a mapRoles or mapUsers item of the auth map.
+type Entry struct {
+	DataType DataType `json:"dataType"`
+	Username string   `json:"username"`
+	ARN      string   `json:"arn"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Entries returns the mapRoles and mapUsers items of the auth map.
+func (m *AwsAuthData) Entries() []Entry {
+	entries := make([]Entry, 0, len(m.MapRoles)+len(m.MapUsers))
+	for _, mapRole := range m.MapRoles {
+		entries = append(entries, Entry{DataType: MapRoleData, Username: mapRole.Username, ARN: mapRole.RoleARN, Groups: mapRole.Groups})
+	}
+	for _, mapUser := range m.MapUsers {
+		entries = append(entries, Entry{DataType: MapUserData, Username: mapUser.Username, ARN: mapUser.UserARN, Groups: mapUser.Groups})
+	}
+	return entries
+}
+
+// sameEntry returns whether a and b are the same item of the auth map, with
+// the same data type, username and principal ARN.
+func sameEntry(a, b Entry) bool {
+	return a.DataType == b.DataType && a.Username == b.Username && a.ARN == b.ARN
+}
+
+// PruneCandidate is an entry of the auth map declared by no mapping, which an
+// operator in authoritative mode prunes once it has been undeclared since
+// Since for its grace period, at PruneAfter.
+type PruneCandidate struct {
+	Entry
+	Since      time.Time `json:"since"`
+	PruneAfter time.Time `json:"pruneAfter"`
+}
+
+// ReadPruneCandidates returns the prune candidates recorded in the annotation
+// of cm.
+func ReadPruneCandidates(cm *kcorev1.ConfigMap) ([]PruneCandidate, error) {
+	value, ok := cm.Annotations[PruneCandidatesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var candidates []PruneCandidate
+	if err := json.Unmarshal([]byte(value), &candidates); err != nil {
+		return nil, fmt.Errorf("parsing %s annotation: %w", PruneCandidatesAnnotation, err)
+	}
+	return candidates, nil
+}
+
+// WritePruneCandidates records the prune candidates in the annotation of the
+// aws-auth ConfigMap, removing it if there are none. The annotation is
+// patched, so that it never conflicts with updates of the entries.
+func WritePruneCandidates(ctx context.Context, k kubernetes.Interface, candidates []PruneCandidate) error {
+	var value interface{}
+	if len(candidates) > 0 {
+		encoded, err := json.Marshal(candidates)
+		if err != nil {
+			return err
+		}
+		value = string(encoded)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{PruneCandidatesAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k.CoreV1().ConfigMaps(ConfigMapNamespace).Patch(ctx, ConfigMapName, types.MergePatchType, patch, apismetav1.PatchOptions{})
+	return err
+}
+
+// Prune removes the entries from the auth map, matching them by data type,
+// username and principal ARN so that other entries sharing their username are
+// kept. Entries owned by an operator instance other than the Mapper's are
+// never removed. It returns the entries removed.
+func (m *Mapper) Prune(ctx context.Context, entries []Entry) (pruned []Entry, err error) {
+	ctx, span := tracer.Start(ctx, "Mapper.Prune", trace.WithAttributes(tracing.OperationKey.String(string(PruneOperation))))
+	defer func() { endSpan(span, err) }()
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pruned = nil
+		authData, configMap, err := ReadAuthMapWithContext(ctx, m.KubernetesClient)
+		if err != nil {
+			return err
+		}
+		prunes := func(entry Entry) bool {
+			if owner := authData.Owner(entry.DataType, entry.Username); owner != "" && owner != m.Owner {
+				return false
+			}
+			for _, e := range entries {
+				if sameEntry(e, entry) {
+					pruned = append(pruned, entry)
+					return true
+				}
+			}
+			return false
+		}
+		var mapRoles []*MapRole
+		for _, mapRole := range authData.MapRoles {
+			if !prunes(Entry{DataType: MapRoleData, Username: mapRole.Username, ARN: mapRole.RoleARN, Groups: mapRole.Groups}) {
+				mapRoles = append(mapRoles, mapRole)
+			}
+		}
+		var mapUsers []*MapUser
+		for _, mapUser := range authData.MapUsers {
+			if !prunes(Entry{DataType: MapUserData, Username: mapUser.Username, ARN: mapUser.UserARN, Groups: mapUser.Groups}) {
+				mapUsers = append(mapUsers, mapUser)
+			}
+		}
+		if len(pruned) == 0 {
+			return nil
+		}
+		authData.SetMapRoles(mapRoles)
+		authData.SetMapUsers(mapUsers)
+
+		// Release the ownership of the usernames no longer mapped.
+		remaining := map[auditKeyType]bool{}
+		for _, entry := range authData.Entries() {
+			remaining[auditKeyType{entry.DataType, entry.Username}] = true
+		}
+		for _, entry := range pruned {
+			if !remaining[auditKeyType{entry.DataType, entry.Username}] {
+				authData.SetOwner(entry.DataType, entry.Username, "")
+			}
+		}
+
+		size, err := writeAuthMap(ctx, m.KubernetesClient, authData, configMap)
+		if err != nil {
+			return err
+		}
+		m.Size.Observe(size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m.Audit != nil {
+		now := time.Now()
+		for _, entry := range pruned {
+			m.Audit(&AuditRecord{
+				Time:      now,
+				Operation: PruneOperation,
+				Username:  entry.Username,
+				Changes: []AuditChange{{
+					DataType: entry.DataType,
+					Username: entry.Username,
+					Before:   &AuditEntry{ARN: entry.ARN, Groups: entry.Groups},
+				}},
+			})
+		}
+	}
+	return pruned, nil
+}
+
+// LoadBaseline loads the protected baseline of an operator in authoritative
+// mode from a YAML file with mapRoles and mapUsers lists, formatted as those of
+// the aws-auth ConfigMap. Their principal ARNs are normalized.
+func LoadBaseline(path string) (AwsAuthData, error) {
+	var baseline AwsAuthData
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return baseline, err
+	}
+	if err := yaml.UnmarshalStrict(data, &baseline); err != nil {
+		return baseline, fmt.Errorf("parsing baseline %s: %w", path, err)
+	}
+	for _, mapRole := range baseline.MapRoles {
+		if mapRole.RoleARN, _, err = NormalizeARN(MapRoleData, mapRole.RoleARN); err != nil {
+			return baseline, fmt.Errorf("parsing baseline %s: %w", path, err)
+		}
+	}
+	for _, mapUser := range baseline.MapUsers {
+		if mapUser.UserARN, _, err = NormalizeARN(MapUserData, mapUser.UserARN); err != nil {
+			return baseline, fmt.Errorf("parsing baseline %s: %w", path, err)
+		}
+	}
+	return baseline, nil
+}
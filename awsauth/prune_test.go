@@ -0,0 +1,139 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMapper_Prune(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	authData, cm, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData.SetMapRoles(append(authData.MapRoles,
+		NewMapRole(testARNs["node-2"], "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"})))
+	authData.SetMapUsers(append(authData.MapUsers, NewMapUser(testARNs["user-2"], "user-2", []string{"team-b"})))
+	authData.SetOwner(MapUserData, "user-2", "team-b")
+	g.Expect(UpdateAuthMap(client, authData, cm)).To(gomega.Succeed())
+
+	mapper := NewMapper(client, false)
+	var records []*AuditRecord
+	mapper.Audit = func(record *AuditRecord) { records = append(records, record) }
+	pruned, err := mapper.Prune(context.Background(), []Entry{
+		// Only the entry of node-2 is pruned, not that of node-1 sharing its username.
+		{DataType: MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", ARN: testARNs["node-2"]},
+		{DataType: MapUserData, Username: "admin", ARN: testARNs["user-1"]},
+		// Entries owned by other operator instances are kept.
+		{DataType: MapUserData, Username: "user-2", ARN: testARNs["user-2"]},
+		// Entries no longer present are ignored.
+		{DataType: MapRoleData, Username: "gone", ARN: testARNs["node-1"]},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(pruned).To(gomega.Equal([]Entry{
+		{DataType: MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", ARN: testARNs["node-2"], Groups: []string{"system:bootstrappers", "system:nodes"}},
+		{DataType: MapUserData, Username: "admin", ARN: testARNs["user-1"], Groups: []string{"system:masters"}},
+	}))
+
+	authData, _, err = ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.Entries()).To(gomega.Equal([]Entry{
+		{DataType: MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", ARN: testARNs["node-1"], Groups: []string{"system:bootstrappers", "system:nodes"}},
+		{DataType: MapUserData, Username: "user-2", ARN: testARNs["user-2"], Groups: []string{"team-b"}},
+	}))
+	g.Expect(authData.Owner(MapUserData, "user-2")).To(gomega.Equal("team-b"))
+
+	g.Expect(records).To(gomega.HaveLen(2))
+	g.Expect(records[0].Operation).To(gomega.Equal(PruneOperation))
+	g.Expect(records[0].Changes).To(gomega.Equal([]AuditChange{{
+		DataType: MapRoleData,
+		Username: "system:node:{{EC2PrivateDNSName}}",
+		Before:   &AuditEntry{ARN: testARNs["node-2"], Groups: []string{"system:bootstrappers", "system:nodes"}},
+	}}))
+
+	// Pruning nothing leaves the ConfigMap untouched.
+	pruned, err = mapper.Prune(context.Background(), nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(pruned).To(gomega.BeEmpty())
+	g.Expect(records).To(gomega.HaveLen(2))
+}
+
+func TestPruneCandidates(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	since := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	candidates := []PruneCandidate{{
+		Entry:      Entry{DataType: MapUserData, Username: "admin", ARN: testARNs["user-1"], Groups: []string{"system:masters"}},
+		Since:      since,
+		PruneAfter: since.Add(24 * time.Hour),
+	}}
+
+	g.Expect(WritePruneCandidates(context.Background(), client, candidates)).To(gomega.Succeed())
+	_, cm, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	read, err := ReadPruneCandidates(cm)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(read).To(gomega.Equal(candidates))
+
+	g.Expect(WritePruneCandidates(context.Background(), client, nil)).To(gomega.Succeed())
+	_, cm, err = ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cm.Annotations).NotTo(gomega.HaveKey(PruneCandidatesAnnotation))
+}
+
+func TestLoadBaseline(t *testing.T) {
+	g := gomega.NewWithT(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baseline.yaml")
+	g.Expect(os.WriteFile(path, []byte(`mapRoles:
+- rolearn: arn:aws:iam::00000000000:role/eks/node-1
+  username: system:node:{{EC2PrivateDNSName}}
+  groups:
+  - system:bootstrappers
+  - system:nodes
+mapUsers:
+- userarn: arn:aws:iam::00000000000:user/user-1
+  username: admin
+  groups:
+  - system:masters
+`), 0o600)).To(gomega.Succeed())
+
+	baseline, err := LoadBaseline(path)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(baseline.Entries()).To(gomega.Equal([]Entry{
+		{DataType: MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", ARN: testARNs["node-1"], Groups: []string{"system:bootstrappers", "system:nodes"}},
+		{DataType: MapUserData, Username: "admin", ARN: testARNs["user-1"], Groups: []string{"system:masters"}},
+	}))
+
+	g.Expect(os.WriteFile(path, []byte("mapRoles:\n- rolearn: arn:aws:iam::00000000000:user/user-1\n"), 0o600)).To(gomega.Succeed())
+	_, err = LoadBaseline(path)
+	g.Expect(IsInvalidARN(err)).To(gomega.BeTrue())
+
+	g.Expect(os.WriteFile(path, []byte("mapRole: []\n"), 0o600)).To(gomega.Succeed())
+	_, err = LoadBaseline(path)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
@@ -0,0 +1,289 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+	kcorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+)
+
+// BackupConfigMapName is the name of the ConfigMap in ConfigMapNamespace
+// preserving the raw data of a malformed aws-auth ConfigMap.
+const BackupConfigMapName = "aws-auth-quarantine"
+
+// Annotations of the backup ConfigMap.
+const (
+	QuarantinedAtAnnotation   = "aws-auth.samba.tv/quarantined-at"
+	QuarantineErrorAnnotation = "aws-auth.samba.tv/quarantine-error"
+)
+
+// DefaultQuarantineInterval is the default interval at which a
+// QuarantineMonitor checks the auth map.
+const DefaultQuarantineInterval = time.Minute
+
+// ErrMalformed indicates the data of the aws-auth ConfigMap cannot be parsed
+// completely, so that it must not be rewritten.
+var ErrMalformed = errors.New("malformed aws-auth data")
+
+// IsMalformed returns true if err indicates the data of the aws-auth
+// ConfigMap is malformed.
+func IsMalformed(err error) bool {
+	return errors.Is(err, ErrMalformed)
+}
+
+// MalformedError locates the error in malformed aws-auth data: the line of
+// the YAML syntax or type error in the value of Key, or else the 1-based index
+// of the invalid Entry.
+type MalformedError struct {
+	Key    string
+	Line   int
+	Entry  int
+	Reason string
+}
+
+func (e *MalformedError) Error() string {
+	switch {
+	case e.Line > 0:
+		return fmt.Sprintf("%s: %s line %d: %s", ErrMalformed, e.Key, e.Line, e.Reason)
+	case e.Entry > 0:
+		return fmt.Sprintf("%s: %s entry %d: %s", ErrMalformed, e.Key, e.Entry, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrMalformed, e.Key, e.Reason)
+}
+
+// Is returns whether target is ErrMalformed.
+func (e *MalformedError) Is(target error) bool {
+	return target == ErrMalformed
+}
+
+// yamlLine matches the line number of yaml.v2 errors.
+var yamlLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+// parseAuthData parses the mapRoles or mapUsers value of the aws-auth
+// ConfigMap into out, rejecting unknown fields, which would be lost when it
+// is rewritten, with a MalformedError.
+func parseAuthData(key, value string, out interface{}) error {
+	err := yaml.UnmarshalStrict([]byte(value), out)
+	if err == nil {
+		return nil
+	}
+	malformed := &MalformedError{Key: key, Reason: err.Error()}
+	if match := yamlLine.FindStringSubmatch(err.Error()); match != nil {
+		malformed.Line, _ = strconv.Atoi(match[1])
+		malformed.Reason = match[2]
+	}
+	return malformed
+}
+
+// validateAuthData returns a MalformedError if an entry of the auth map has
+// no principal ARN.
+func validateAuthData(authData *AwsAuthData) error {
+	for i, mapRole := range authData.MapRoles {
+		if mapRole == nil || mapRole.RoleARN == "" {
+			return &MalformedError{Key: "mapRoles", Entry: i + 1, Reason: "rolearn is missing"}
+		}
+	}
+	for i, mapUser := range authData.MapUsers {
+		if mapUser == nil || mapUser.UserARN == "" {
+			return &MalformedError{Key: "mapUsers", Entry: i + 1, Reason: "userarn is missing"}
+		}
+	}
+	return nil
+}
+
+// BackupAuthMap preserves the raw data of the aws-auth ConfigMap cm in the
+// BackupConfigMapName ConfigMap, annotated with the reason it was backed up.
+// It returns whether the backup was written, as it is left unchanged if it
+// already holds the same data.
+func BackupAuthMap(ctx context.Context, k kubernetes.Interface, cm *kcorev1.ConfigMap, reason error) (bool, error) {
+	var written bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		written = false
+		backup, err := k.CoreV1().ConfigMaps(ConfigMapNamespace).Get(ctx, BackupConfigMapName, apismetav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists := err == nil
+		if exists && reflect.DeepEqual(backup.Data, cm.Data) && reflect.DeepEqual(backup.BinaryData, cm.BinaryData) {
+			return nil
+		}
+		if !exists {
+			backup = &kcorev1.ConfigMap{ObjectMeta: apismetav1.ObjectMeta{Name: BackupConfigMapName, Namespace: ConfigMapNamespace}}
+		}
+		backup.Data = cm.Data
+		backup.BinaryData = cm.BinaryData
+		if backup.Annotations == nil {
+			backup.Annotations = map[string]string{}
+		}
+		backup.Annotations[QuarantinedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		backup.Annotations[QuarantineErrorAnnotation] = reason.Error()
+		if exists {
+			_, err = k.CoreV1().ConfigMaps(ConfigMapNamespace).Update(ctx, backup, apismetav1.UpdateOptions{})
+		} else {
+			_, err = k.CoreV1().ConfigMaps(ConfigMapNamespace).Create(ctx, backup, apismetav1.CreateOptions{})
+		}
+		written = err == nil
+		return err
+	})
+	return written, err
+}
+
+var (
+	quarantinedDesc = prometheus.NewDesc("aws_auth_configmap_quarantined",
+		"Whether the aws-auth ConfigMap is malformed, and all writes to it are refused.", nil, nil)
+	malformedDesc = prometheus.NewDesc("aws_auth_configmap_malformed_info",
+		"The location of the error in the malformed aws-auth ConfigMap.", []string{"key", "line", "entry", "reason"}, nil)
+)
+
+// QuarantineMonitor checks the aws-auth ConfigMap every Interval. While its
+// data is malformed, all writes to it are refused, as the auth map cannot be
+// read; the monitor backs up its raw data, records a warning event on it
+// locating the error, and reports it as a prometheus.Collector.
+type QuarantineMonitor struct {
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	Recorder   record.EventRecorder
+
+	// Interval defaults to DefaultQuarantineInterval.
+	Interval time.Duration
+
+	mu        sync.Mutex
+	malformed *MalformedError
+}
+
+// Start checks the aws-auth ConfigMap every interval until ctx is done.
+func (q *QuarantineMonitor) Start(ctx context.Context) error {
+	interval := q.Interval
+	if interval <= 0 {
+		interval = DefaultQuarantineInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := q.Check(ctx); err != nil {
+			q.Log.Error(err, "failure checking aws-auth ConfigMap")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check reads the aws-auth ConfigMap, quarantining it if malformed and
+// releasing it once it is parsed again.
+func (q *QuarantineMonitor) Check(ctx context.Context) error {
+	_, cm, err := ReadAuthMapWithContext(ctx, q.KubeClient)
+	var malformed *MalformedError
+	if !errors.As(err, &malformed) {
+		if err != nil {
+			return err
+		}
+		q.mu.Lock()
+		released := q.malformed != nil
+		q.malformed = nil
+		q.mu.Unlock()
+		if released {
+			q.Log.Info("aws-auth ConfigMap is no longer malformed, releasing quarantine")
+			q.Recorder.Event(cm, kcorev1.EventTypeNormal, "QuarantineReleased", "aws-auth data is parsed again, writes are resumed")
+		}
+		return nil
+	}
+
+	q.mu.Lock()
+	changed := q.malformed == nil || *q.malformed != *malformed
+	q.malformed = malformed
+	q.mu.Unlock()
+	backedUp, err := BackupAuthMap(ctx, q.KubeClient, cm, malformed)
+	if err != nil {
+		return fmt.Errorf("failure backing up malformed aws-auth ConfigMap: %w", err)
+	}
+	if changed || backedUp {
+		q.Log.Error(malformed, "aws-auth ConfigMap is malformed, refusing all writes", "key", malformed.Key, "line", malformed.Line, "entry", malformed.Entry, "backup", ConfigMapNamespace+"/"+BackupConfigMapName)
+		q.Recorder.Eventf(cm, kcorev1.EventTypeWarning, "Quarantined", "%s; writes are refused, raw data backed up to %s/%s", malformed, ConfigMapNamespace, BackupConfigMapName)
+	}
+	return nil
+}
+
+// Malformed returns the error in the aws-auth ConfigMap while it is
+// quarantined, or nil.
+func (q *QuarantineMonitor) Malformed() *MalformedError {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.malformed
+}
+
+// Describe implements prometheus.Collector.
+func (q *QuarantineMonitor) Describe(ch chan<- *prometheus.Desc) {
+	ch <- quarantinedDesc
+	ch <- malformedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (q *QuarantineMonitor) Collect(ch chan<- prometheus.Metric) {
+	malformed := q.Malformed()
+	if malformed == nil {
+		ch <- prometheus.MustNewConstMetric(quarantinedDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(quarantinedDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(malformedDesc, prometheus.GaugeValue, 1,
+		malformed.Key, strconv.Itoa(malformed.Line), strconv.Itoa(malformed.Entry), malformed.Reason)
+}
+
+// RepairAuthMap replaces the entries of the aws-auth ConfigMap, malformed or
+// not, with those of authData, after backing up its raw data as
+// BackupAuthMap does. The owners and prune candidates recorded in the
+// ConfigMap are cleared along with the entries they describe.
+func RepairAuthMap(ctx context.Context, k kubernetes.Interface, authData AwsAuthData) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := k.CoreV1().ConfigMaps(ConfigMapNamespace).Get(ctx, ConfigMapName, apismetav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm, err = CreateAuthMapWithContext(ctx, k)
+		}
+		if err != nil {
+			return err
+		}
+		reason := errors.New("replaced by a repair")
+		if _, err := decodeAuthMap(cm); err != nil {
+			reason = err
+		}
+		if _, err := BackupAuthMap(ctx, k, cm, reason); err != nil {
+			return fmt.Errorf("failure backing up aws-auth ConfigMap: %w", err)
+		}
+		delete(cm.Annotations, PruneCandidatesAnnotation)
+		authData.Owners = nil
+		_, err = writeAuthMap(ctx, k, authData, cm)
+		return err
+	})
+}
@@ -0,0 +1,198 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kcorev1 "k8s.io/api/core/v1"
+	apismetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// createMalformedConfigMap creates an aws-auth ConfigMap whose mapRoles has a
+// YAML syntax error on line 3.
+func createMalformedConfigMap(g *gomega.WithT, client *fake.Clientset) {
+	_, err := client.CoreV1().ConfigMaps(ConfigMapNamespace).Create(context.Background(), &kcorev1.ConfigMap{
+		ObjectMeta: apismetav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+		Data: map[string]string{
+			"mapRoles": "- rolearn: arn:aws:iam::00000000000:role/node-1\n  username: node-1\n   groups: [system:nodes\n",
+			"mapUsers": "",
+		},
+	}, apismetav1.CreateOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
+func TestReadAuthMap_Malformed(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	tests := []struct {
+		data map[string]string
+		want MalformedError
+	}{
+		{
+			data: map[string]string{"mapRoles": "- rolearn: arn:aws:iam::00000000000:role/node-1\n  username: node-1\n   groups: [system:nodes\n"},
+			want: MalformedError{Key: "mapRoles", Line: 3, Reason: "mapping values are not allowed in this context"},
+		},
+		{
+			// Unknown fields, such as misspelled ones, would be lost if rewritten.
+			data: map[string]string{"mapUsers": "- userarn: arn:aws:iam::00000000000:user/user-1\n  username: admin\n  group:\n  - system:masters\n"},
+			want: MalformedError{Key: "mapUsers", Line: 3, Reason: "field group not found in type awsauth.MapUser"},
+		},
+		{
+			data: map[string]string{"mapRoles": "- username: node-1\n"},
+			want: MalformedError{Key: "mapRoles", Entry: 1, Reason: "rolearn is missing"},
+		},
+	}
+	for _, tt := range tests {
+		client := fake.NewSimpleClientset(&kcorev1.ConfigMap{
+			ObjectMeta: apismetav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+			Data:       tt.data,
+		})
+		authData, cm, err := ReadAuthMap(client)
+		g.Expect(IsMalformed(err)).To(gomega.BeTrue())
+		var malformed *MalformedError
+		g.Expect(errors.As(err, &malformed)).To(gomega.BeTrue())
+		g.Expect(*malformed).To(gomega.Equal(tt.want))
+		g.Expect(authData.Entries()).To(gomega.BeEmpty())
+		g.Expect(cm.Data).To(gomega.Equal(tt.data))
+	}
+	g.Expect((&MalformedError{Key: "mapRoles", Line: 3, Reason: "mapping values are not allowed in this context"}).Error()).
+		To(gomega.Equal("malformed aws-auth data: mapRoles line 3: mapping values are not allowed in this context"))
+}
+
+func TestMapper_Malformed(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := fake.NewSimpleClientset()
+	createMalformedConfigMap(g, client)
+	_, before, _ := ReadAuthMap(client)
+
+	// Writes are refused rather than rewriting partially parsed data.
+	mapper := NewMapper(client, false)
+	err := mapper.Upsert(&Arguments{DataType: MapUserData, UserARN: testARNs["user-2"], Username: "user-2", Groups: []string{"view"}})
+	g.Expect(IsMalformed(err)).To(gomega.BeTrue())
+	err = mapper.Remove(&Arguments{DataType: MapRoleData, Username: "node-1"})
+	g.Expect(IsMalformed(err)).To(gomega.BeTrue())
+
+	_, after, _ := ReadAuthMap(client)
+	g.Expect(after.Data).To(gomega.Equal(before.Data))
+}
+
+func TestBackupAuthMap(t *testing.T) {
+	g := gomega.NewWithT(t)
+	client := fake.NewSimpleClientset()
+	createMalformedConfigMap(g, client)
+	_, cm, err := ReadAuthMap(client)
+
+	written, err := BackupAuthMap(context.Background(), client, cm, err)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(written).To(gomega.BeTrue())
+	backup, err := client.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), BackupConfigMapName, apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(backup.Data).To(gomega.Equal(cm.Data))
+	g.Expect(backup.Annotations).To(gomega.HaveKeyWithValue(QuarantineErrorAnnotation, "malformed aws-auth data: mapRoles line 3: mapping values are not allowed in this context"))
+	g.Expect(backup.Annotations).To(gomega.HaveKey(QuarantinedAtAnnotation))
+
+	// The same data is not backed up again.
+	written, err = BackupAuthMap(context.Background(), client, cm, ErrMalformed)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(written).To(gomega.BeFalse())
+
+	cm.Data["mapUsers"] = "- userarn"
+	written, err = BackupAuthMap(context.Background(), client, cm, ErrMalformed)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(written).To(gomega.BeTrue())
+	backup, err = client.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), BackupConfigMapName, apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(backup.Data).To(gomega.HaveKeyWithValue("mapUsers", "- userarn"))
+}
+
+func TestQuarantineMonitor(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMalformedConfigMap(g, client)
+	recorder := record.NewFakeRecorder(10)
+	monitor := &QuarantineMonitor{KubeClient: client, Log: ctrllog.Log, Recorder: recorder}
+
+	g.Expect(monitor.Check(context.Background())).To(gomega.Succeed())
+	g.Expect(monitor.Malformed()).To(gomega.Equal(&MalformedError{Key: "mapRoles", Line: 3, Reason: "mapping values are not allowed in this context"}))
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.HavePrefix("Warning Quarantined malformed aws-auth data: mapRoles line 3:")))
+	_, err := client.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), BackupConfigMapName, apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	expected := `
+# HELP aws_auth_configmap_malformed_info The location of the error in the malformed aws-auth ConfigMap.
+# TYPE aws_auth_configmap_malformed_info gauge
+aws_auth_configmap_malformed_info{entry="0",key="mapRoles",line="3",reason="mapping values are not allowed in this context"} 1
+# HELP aws_auth_configmap_quarantined Whether the aws-auth ConfigMap is malformed, and all writes to it are refused.
+# TYPE aws_auth_configmap_quarantined gauge
+aws_auth_configmap_quarantined 1
+`
+	g.Expect(testutil.CollectAndCompare(monitor, strings.NewReader(expected))).To(gomega.Succeed())
+
+	// The same error is reported once.
+	g.Expect(monitor.Check(context.Background())).To(gomega.Succeed())
+	g.Expect(recorder.Events).NotTo(gomega.Receive())
+
+	// Repairing the ConfigMap releases the quarantine.
+	g.Expect(RepairAuthMap(context.Background(), client, AwsAuthData{
+		MapRoles: []*MapRole{NewMapRole(testARNs["node-1"], "node-1", []string{"system:nodes"})},
+	})).To(gomega.Succeed())
+	g.Expect(monitor.Check(context.Background())).To(gomega.Succeed())
+	g.Expect(monitor.Malformed()).To(gomega.BeNil())
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.HavePrefix("Normal QuarantineReleased")))
+	expected = `
+# HELP aws_auth_configmap_quarantined Whether the aws-auth ConfigMap is malformed, and all writes to it are refused.
+# TYPE aws_auth_configmap_quarantined gauge
+aws_auth_configmap_quarantined 0
+`
+	g.Expect(testutil.CollectAndCompare(monitor, strings.NewReader(expected))).To(gomega.Succeed())
+}
+
+func TestRepairAuthMap(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	authData, cm, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData.SetOwner(MapUserData, "admin", "team-a")
+	g.Expect(UpdateAuthMap(client, authData, cm)).To(gomega.Succeed())
+	g.Expect(WritePruneCandidates(context.Background(), client, []PruneCandidate{{Entry: Entry{DataType: MapUserData, Username: "admin", ARN: testARNs["user-1"]}}})).To(gomega.Succeed())
+	_, original, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(RepairAuthMap(context.Background(), client, AwsAuthData{
+		MapUsers: []*MapUser{NewMapUser(testARNs["user-2"], "user-2", []string{"view"})},
+	})).To(gomega.Succeed())
+	authData, cm, err = ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.Entries()).To(gomega.Equal([]Entry{{DataType: MapUserData, Username: "user-2", ARN: testARNs["user-2"], Groups: []string{"view"}}}))
+	g.Expect(cm.Annotations).NotTo(gomega.HaveKey(OwnersAnnotation))
+	g.Expect(cm.Annotations).NotTo(gomega.HaveKey(PruneCandidatesAnnotation))
+
+	backup, err := client.CoreV1().ConfigMaps(ConfigMapNamespace).Get(context.Background(), BackupConfigMapName, apismetav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(backup.Data).To(gomega.Equal(original.Data))
+	g.Expect(backup.Annotations).To(gomega.HaveKeyWithValue(QuarantineErrorAnnotation, "replaced by a repair"))
+}
@@ -21,6 +21,9 @@ import (
 
 	"github.com/jpillora/backoff"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
 )
 
 const (
@@ -29,7 +32,8 @@ const (
 )
 
 // WithRetry runs the passed operation function with its arguments and retries
-// on failures until success or max number of retry attempts have failed.
+// on failures until success or max number of retry attempts have failed. Each
+// attempt is traced in its own span.
 func WithRetry(fn func(*Arguments) error, args *Arguments) error {
 	var (
 		counter int
@@ -47,7 +51,10 @@ func WithRetry(fn func(*Arguments) error, args *Arguments) error {
 			break
 		}
 
-		if err = fn(args); err != nil {
+		ctx, span := tracer.Start(args.context(), "Attempt", trace.WithAttributes(tracing.RetryAttemptKey.Int(counter)))
+		err = fn(args.withContext(ctx))
+		endSpan(span, err)
+		if err != nil {
 			d := bkoff.Duration()
 			log.Printf("error: %v: will retry after %v", err, d)
 			time.Sleep(d)
@@ -17,15 +17,42 @@ limitations under the License.
 package awsauth
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
 )
 
 // ServiceConfig is the configuration for a Service object.
 type ServiceConfig struct {
+	// Backend stores the mappings, defaulting to the aws-auth ConfigMap of
+	// the cluster of KubeClient.
+	Backend Backend
+
+	// AuditSink, if set, receives a record of each change to the aws-auth
+	// ConfigMap, attributed to Trigger and Cluster.
+	AuditSink AuditSink
+	Trigger   *Trigger
+	Cluster   string
+
+	// Context carries the trace of the service operations, defaulting to the
+	// background context.
+	Context context.Context
+
+	// SizeMonitor, if set, tracks the size of the aws-auth ConfigMap as it is
+	// written.
+	SizeMonitor *SizeMonitor
+
+	// Owner, if set, is the operator instance owning the entries written to
+	// the aws-auth ConfigMap, which only removes the entries it owns.
+	Owner string
+
 	KubeClient    kubernetes.Interface
 	Log           logr.Logger
 	MaxRetryCount int
@@ -63,18 +90,59 @@ type impl struct {
 	cfg ServiceConfig
 }
 
-// UpsertMapRole upserts a MapRole into the configmap keyed by username.
-func (svc impl) UpsertMapRole(username string, mapRole MapRole) error {
+func (svc impl) backend() Backend {
+	if svc.cfg.Backend != nil {
+		return svc.cfg.Backend
+	}
 	mapper := NewMapper(svc.cfg.KubeClient, false)
-	err := mapper.Upsert(&Arguments{
-		DataType:      MapRoleData,
-		RoleARN:       mapRole.RoleARN,
-		Username:      username,
-		Groups:        mapRole.Groups,
-		WithRetries:   svc.cfg.WithRetries,
-		MaxRetryCount: svc.cfg.MaxRetryCount,
-		MaxRetryTime:  svc.cfg.MaxRetryTime,
-		MinRetryTime:  svc.cfg.MinRetryTime,
+	mapper.Size = svc.cfg.SizeMonitor
+	mapper.Owner = svc.cfg.Owner
+	return mapper
+}
+
+// auditor returns the audit hook of the service operations, if any.
+func (svc impl) auditor() func(*AuditRecord) {
+	if svc.cfg.AuditSink == nil {
+		return nil
+	}
+	return svc.audit
+}
+
+// startSpan starts the span of a service operation.
+func (svc impl) startSpan(name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := svc.cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, "Service."+name, trace.WithAttributes(attributes...))
+}
+
+// audit writes an audit record to the audit sink, logging any failure as the
+// change has already been made.
+func (svc impl) audit(record *AuditRecord) {
+	record.Cluster = svc.cfg.Cluster
+	record.Trigger = svc.cfg.Trigger
+	if err := svc.cfg.AuditSink.Write(context.Background(), record); err != nil {
+		svc.cfg.Log.Error(err, "failure writing audit record", "username", record.Username)
+	}
+}
+
+// UpsertMapRole upserts a MapRole into the configmap keyed by username.
+func (svc impl) UpsertMapRole(username string, mapRole MapRole) (err error) {
+	ctx, span := svc.startSpan("UpsertMapRole", tracing.UsernameKey.String(username), tracing.ARNKey.String(mapRole.RoleARN))
+	defer func() { endSpan(span, err) }()
+	err = svc.backend().Upsert(&Arguments{
+		Context:        ctx,
+		Audit:          svc.auditor(),
+		DataType:       MapRoleData,
+		RoleARN:        mapRole.RoleARN,
+		Username:       username,
+		Groups:         mapRole.Groups,
+		AccessPolicies: mapRole.AccessPolicies,
+		WithRetries:    svc.cfg.WithRetries,
+		MaxRetryCount:  svc.cfg.MaxRetryCount,
+		MaxRetryTime:   svc.cfg.MaxRetryTime,
+		MinRetryTime:   svc.cfg.MinRetryTime,
 	})
 	if err != nil {
 		svc.cfg.Log.Error(err, "failure to upsert mapRole", "username", username)
@@ -83,9 +151,12 @@ func (svc impl) UpsertMapRole(username string, mapRole MapRole) error {
 }
 
 // RemoveMapRole removes a MapRole from the configmap keyed by username.
-func (svc impl) RemoveMapRole(username string) error {
-	mapper := NewMapper(svc.cfg.KubeClient, false)
-	err := mapper.Remove(&Arguments{
+func (svc impl) RemoveMapRole(username string) (err error) {
+	ctx, span := svc.startSpan("RemoveMapRole", tracing.UsernameKey.String(username))
+	defer func() { endSpan(span, err) }()
+	err = svc.backend().Remove(&Arguments{
+		Context:       ctx,
+		Audit:         svc.auditor(),
 		DataType:      MapRoleData,
 		Username:      username,
 		WithRetries:   svc.cfg.WithRetries,
@@ -100,17 +171,21 @@ func (svc impl) RemoveMapRole(username string) error {
 }
 
 // UpsertMapUser upserts a MapUser into the configmap keyed by username.
-func (svc impl) UpsertMapUser(username string, mapUser MapUser) error {
-	mapper := NewMapper(svc.cfg.KubeClient, false)
-	err := mapper.Upsert(&Arguments{
-		DataType:      MapUserData,
-		UserARN:       mapUser.UserARN,
-		Username:      username,
-		Groups:        mapUser.Groups,
-		WithRetries:   svc.cfg.WithRetries,
-		MaxRetryCount: svc.cfg.MaxRetryCount,
-		MaxRetryTime:  svc.cfg.MaxRetryTime,
-		MinRetryTime:  svc.cfg.MinRetryTime,
+func (svc impl) UpsertMapUser(username string, mapUser MapUser) (err error) {
+	ctx, span := svc.startSpan("UpsertMapUser", tracing.UsernameKey.String(username), tracing.ARNKey.String(mapUser.UserARN))
+	defer func() { endSpan(span, err) }()
+	err = svc.backend().Upsert(&Arguments{
+		Context:        ctx,
+		Audit:          svc.auditor(),
+		DataType:       MapUserData,
+		UserARN:        mapUser.UserARN,
+		Username:       username,
+		Groups:         mapUser.Groups,
+		AccessPolicies: mapUser.AccessPolicies,
+		WithRetries:    svc.cfg.WithRetries,
+		MaxRetryCount:  svc.cfg.MaxRetryCount,
+		MaxRetryTime:   svc.cfg.MaxRetryTime,
+		MinRetryTime:   svc.cfg.MinRetryTime,
 	})
 	if err != nil {
 		svc.cfg.Log.Error(err, "failure to upsert mapUser", "username", username)
@@ -119,9 +194,12 @@ func (svc impl) UpsertMapUser(username string, mapUser MapUser) error {
 }
 
 // RemoveMapUser removes a MapUser from the configmap keyed by username.
-func (svc impl) RemoveMapUser(username string) error {
-	mapper := NewMapper(svc.cfg.KubeClient, false)
-	err := mapper.Remove(&Arguments{
+func (svc impl) RemoveMapUser(username string) (err error) {
+	ctx, span := svc.startSpan("RemoveMapUser", tracing.UsernameKey.String(username))
+	defer func() { endSpan(span, err) }()
+	err = svc.backend().Remove(&Arguments{
+		Context:       ctx,
+		Audit:         svc.auditor(),
 		DataType:      MapUserData,
 		Username:      username,
 		WithRetries:   svc.cfg.WithRetries,
@@ -0,0 +1,120 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MaxAuthMapSize is the size limit of the data of a ConfigMap, the total
+// length of its keys and values, enforced by the API server.
+const MaxAuthMapSize = 1024 * 1024
+
+// DefaultSizeWarningPercent is the default percentage of MaxAuthMapSize above
+// which a SizeMonitor warns of the size of the auth map.
+const DefaultSizeWarningPercent = 80
+
+// ErrTooLarge indicates a change would grow the auth map beyond MaxAuthMapSize.
+var ErrTooLarge = errors.New("exceeds the ConfigMap size limit")
+
+// IsTooLarge returns true if err indicates a change would grow the auth map
+// beyond MaxAuthMapSize.
+func IsTooLarge(err error) bool {
+	return errors.Is(err, ErrTooLarge)
+}
+
+// authMapSize returns the size of the data of a ConfigMap as counted against
+// MaxAuthMapSize.
+func authMapSize(data map[string]string, binaryData map[string][]byte) int {
+	var size int
+	for key, value := range data {
+		size += len(key) + len(value)
+	}
+	for key, value := range binaryData {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+var (
+	sizeDesc = prometheus.NewDesc("aws_auth_configmap_size_bytes",
+		"The size of the data of the aws-auth ConfigMap when last written.", nil, nil)
+	headroomDesc = prometheus.NewDesc("aws_auth_configmap_headroom_bytes",
+		"The number of bytes the data of the aws-auth ConfigMap can grow by before reaching its size limit.", nil, nil)
+	sizeLimitDesc = prometheus.NewDesc("aws_auth_configmap_size_limit_bytes",
+		"The size limit of the data of the aws-auth ConfigMap.", nil, nil)
+)
+
+// SizeMonitor tracks the size of the auth map as it is written, warning when
+// it exceeds WarningPercent of MaxAuthMapSize. It is a prometheus.Collector of
+// the size and headroom of the auth map. A nil SizeMonitor tracks nothing.
+type SizeMonitor struct {
+	WarningPercent int
+	Log            logr.Logger
+
+	mu       sync.Mutex
+	size     int
+	observed bool
+}
+
+// Observe records the size of the auth map just written.
+func (m *SizeMonitor) Observe(size int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.size, m.observed = size, true
+	m.mu.Unlock()
+
+	if m.WarningPercent > 0 && size*100 >= MaxAuthMapSize*m.WarningPercent && m.Log != nil {
+		m.Log.Info("aws-auth ConfigMap is nearing its size limit",
+			"size", size, "limit", MaxAuthMapSize, "headroom", MaxAuthMapSize-size)
+	}
+}
+
+// Headroom returns the number of bytes the auth map can grow by, and whether
+// its size has been observed yet.
+func (m *SizeMonitor) Headroom() (int, bool) {
+	if m == nil {
+		return 0, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MaxAuthMapSize - m.size, m.observed
+}
+
+// Describe implements prometheus.Collector.
+func (m *SizeMonitor) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sizeDesc
+	ch <- headroomDesc
+	ch <- sizeLimitDesc
+}
+
+// Collect implements prometheus.Collector, only collecting the size and
+// headroom of the auth map once observed.
+func (m *SizeMonitor) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(sizeLimitDesc, prometheus.GaugeValue, MaxAuthMapSize)
+	headroom, observed := m.Headroom()
+	if !observed {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(sizeDesc, prometheus.GaugeValue, float64(MaxAuthMapSize-headroom))
+	ch <- prometheus.MustNewConstMetric(headroomDesc, prometheus.GaugeValue, float64(headroom))
+}
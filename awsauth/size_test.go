@@ -0,0 +1,123 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// largeGroups returns groups rendering to about size bytes in the auth map.
+func largeGroups(size int) []string {
+	var groups []string
+	for i := 0; i < size/1024; i++ {
+		groups = append(groups, strings.Repeat("g", 1020))
+	}
+	return groups
+}
+
+func TestMapper_SizeLimit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	monitor := &SizeMonitor{WarningPercent: DefaultSizeWarningPercent}
+	mapper := NewMapper(client, true)
+	mapper.Size = monitor
+
+	_, observed := monitor.Headroom()
+	g.Expect(observed).To(gomega.BeFalse())
+
+	err := mapper.Upsert(&Arguments{
+		DataType: MapRoleData,
+		RoleARN:  testARNs["node-2"],
+		Username: "node-2",
+		Groups:   largeGroups(MaxAuthMapSize / 2),
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	headroom, observed := monitor.Headroom()
+	g.Expect(observed).To(gomega.BeTrue())
+	g.Expect(headroom).To(gomega.BeNumerically("~", MaxAuthMapSize/2, 4096))
+
+	// A change growing the auth map beyond its limit is refused.
+	actions := len(client.Actions())
+	err = mapper.Upsert(&Arguments{
+		DataType: MapUserData,
+		UserARN:  testARNs["user-2"],
+		Username: "user-2",
+		Groups:   largeGroups(MaxAuthMapSize / 2),
+	})
+	g.Expect(IsTooLarge(err)).To(gomega.BeTrue())
+	g.Expect(client.Actions()[actions:]).To(gomega.HaveLen(1))
+	g.Expect(client.Actions()[actions].GetVerb()).To(gomega.Equal("get"))
+	authData, _, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.MapUsers).To(gomega.HaveLen(1))
+
+	expected := fmt.Sprintf(`
+# HELP aws_auth_configmap_headroom_bytes The number of bytes the data of the aws-auth ConfigMap can grow by before reaching its size limit.
+# TYPE aws_auth_configmap_headroom_bytes gauge
+aws_auth_configmap_headroom_bytes %d
+`, headroom)
+	g.Expect(testutil.CollectAndCompare(monitor, strings.NewReader(expected), "aws_auth_configmap_headroom_bytes")).To(gomega.Succeed())
+}
+
+func TestBatcher_SizeLimit(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	batcher := NewBatcher(client, 0)
+
+	// A batch too large as a whole only refuses the changes growing the auth
+	// map beyond its limit.
+	operations := []*batchOperation{
+		{operation: UpsertOperation, args: &Arguments{DataType: MapRoleData, RoleARN: testARNs["node-2"], Username: "node-2", Groups: largeGroups(MaxAuthMapSize * 3 / 4)}},
+		{operation: UpsertOperation, args: &Arguments{DataType: MapUserData, UserARN: testARNs["user-2"], Username: "user-2", Groups: largeGroups(MaxAuthMapSize / 2)}},
+		{operation: RemoveOperation, args: &Arguments{DataType: MapUserData, Username: "admin"}},
+	}
+	results, _ := batcher.apply(operations)
+	g.Expect(results[0]).NotTo(gomega.HaveOccurred())
+	g.Expect(IsTooLarge(results[1])).To(gomega.BeTrue())
+	g.Expect(results[2]).NotTo(gomega.HaveOccurred())
+
+	authData, _, err := ReadAuthMap(client)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.MapRoles).To(gomega.HaveLen(2))
+	g.Expect(authData.MapUsers).To(gomega.BeEmpty())
+}
+
+func TestSizeMonitor_Collect(t *testing.T) {
+	g := gomega.NewWithT(t)
+	monitor := &SizeMonitor{}
+	g.Expect(testutil.CollectAndCount(monitor)).To(gomega.Equal(1))
+
+	monitor.Observe(1024)
+	g.Expect(testutil.CollectAndCount(monitor)).To(gomega.Equal(3))
+	headroom, observed := monitor.Headroom()
+	g.Expect(observed).To(gomega.BeTrue())
+	g.Expect(headroom).To(gomega.Equal(MaxAuthMapSize - 1024))
+
+	var nilMonitor *SizeMonitor
+	nilMonitor.Observe(1024)
+	_, observed = nilMonitor.Headroom()
+	g.Expect(observed).To(gomega.BeFalse())
+}
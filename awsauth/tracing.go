@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
+)
+
+var tracer = otel.Tracer("github.com/sambatv/aws-auth-operator/awsauth")
+
+// endSpan ends a span, recording err if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// context returns the context of the operation, defaulting to the background context.
+func (args *Arguments) context() context.Context {
+	if args.Context != nil {
+		return args.Context
+	}
+	return context.Background()
+}
+
+// attributes returns the span attributes of the operation.
+func (args *Arguments) attributes(operation OperationType) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		tracing.OperationKey.String(string(operation)),
+		tracing.DataTypeKey.String(string(args.DataType)),
+		tracing.UsernameKey.String(args.Username),
+	}
+	if arn := args.principalARN(); arn != "" {
+		attributes = append(attributes, tracing.ARNKey.String(arn))
+	}
+	return attributes
+}
+
+// principalARN returns the ARN of the principal of the operation, if any.
+func (args *Arguments) principalARN() string {
+	if args.DataType == MapUserData {
+		return args.UserARN
+	}
+	return args.RoleARN
+}
+
+// withContext returns a copy of the arguments with their context replaced.
+func (args *Arguments) withContext(ctx context.Context) *Arguments {
+	copied := *args
+	copied.Context = ctx
+	return &copied
+}
@@ -0,0 +1,90 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/sambatv/aws-auth-operator/tracing"
+)
+
+func TestService_Tracing(t *testing.T) {
+	g := gomega.NewWithT(t)
+	gomega.RegisterTestingT(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	client := fake.NewSimpleClientset()
+	createMockConfigMap(client)
+	// Fail the first update, so that it is retried.
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, pkgruntime.Object, error) {
+		updates++
+		if updates == 1 {
+			return true, nil, apierrors.NewServiceUnavailable("unavailable")
+		}
+		return false, nil, nil
+	})
+	svc, err := NewService(&ServiceConfig{
+		KubeClient:    client,
+		WithRetries:   true,
+		MaxRetryCount: 3,
+		MinRetryTime:  time.Millisecond,
+		MaxRetryTime:  time.Millisecond,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(svc.UpsertMapRole("node-2", MapRole{RoleARN: testARNs["node-2"]})).To(gomega.Succeed())
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	g.Expect(spans["Service.UpsertMapRole"]).To(gomega.HaveLen(1))
+	g.Expect(spans["Mapper.Upsert"]).To(gomega.HaveLen(1))
+	g.Expect(spans["Attempt"]).To(gomega.HaveLen(2))
+	g.Expect(spans["ConfigMap.Get"]).To(gomega.HaveLen(2))
+	g.Expect(spans["ConfigMap.Update"]).To(gomega.HaveLen(2))
+
+	service, mapper := spans["Service.UpsertMapRole"][0], spans["Mapper.Upsert"][0]
+	g.Expect(mapper.Parent().SpanID()).To(gomega.Equal(service.SpanContext().SpanID()))
+	g.Expect(mapper.Attributes()).To(gomega.ContainElements(
+		tracing.OperationKey.String("upsert"),
+		tracing.UsernameKey.String("node-2"),
+		tracing.ARNKey.String(testARNs["node-2"]),
+	))
+
+	for i, attempt := range spans["Attempt"] {
+		g.Expect(attempt.Parent().SpanID()).To(gomega.Equal(mapper.SpanContext().SpanID()))
+		g.Expect(attempt.Attributes()).To(gomega.ContainElement(tracing.RetryAttemptKey.Int(i)))
+		update := spans["ConfigMap.Update"][i]
+		g.Expect(update.Parent().SpanID()).To(gomega.Equal(attempt.SpanContext().SpanID()))
+	}
+	g.Expect(spans["Attempt"][0].Status().Code).To(gomega.Equal(codes.Error))
+	g.Expect(spans["ConfigMap.Update"][0].Status().Code).To(gomega.Equal(codes.Error))
+	g.Expect(spans["Attempt"][1].Status().Code).To(gomega.Equal(codes.Unset))
+	g.Expect(service.Attributes()).To(gomega.ContainElement(tracing.ARNKey.String(testARNs["node-2"])))
+}
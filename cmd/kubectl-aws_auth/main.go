@@ -0,0 +1,234 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-aws_auth is the kubectl aws-auth plugin, resolving who AWS
+// IAM principals are mapped to by the aws-auth ConfigMap and what they can do.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// to authenticate with the clusters of any kubeconfig.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1api "github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/plugin"
+)
+
+const usage = `Resolve who AWS IAM principals are mapped to by aws-auth and what they can do.
+
+Usage:
+  kubectl aws-auth whoami <arn> [flags]    Print the username, groups, source and RBAC access of a principal
+  kubectl aws-auth who-can <group> [flags] List every principal mapped to a group
+  kubectl aws-auth report [flags]          Report the groups, bound roles and owners of every principal
+  kubectl aws-auth prune-report [flags]    List the entries authoritative mode will prune
+  kubectl aws-auth repair [flags]          Back up a malformed aws-auth and rebuild it from the mappings
+
+Flags:
+`
+
+// checkFlags collects repeated --check flags.
+type checkFlags []plugin.Check
+
+func (c *checkFlags) String() string {
+	checks := make([]string, 0, len(*c))
+	for _, check := range *c {
+		checks = append(checks, check.String())
+	}
+	return strings.Join(checks, ",")
+}
+
+func (c *checkFlags) Set(value string) error {
+	check, err := plugin.ParseCheck(value)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, check)
+	return nil
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	var kubeconfig, kubecontext, namespace, output, baselinePath string
+	var repairOptions plugin.RepairOptions
+	var checks checkFlags
+	flags := flag.NewFlagSet("kubectl aws-auth", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	flags.StringVar(&kubecontext, "context", "", "The kubeconfig context to use.")
+	flags.StringVar(&namespace, "namespace", "", "The namespace whoami reviews access in, all namespaces if empty.")
+	flags.Var(&checks, "check", "An access whoami reviews, as <verb>:<resource>[.<group>][/<subresource>]. May be repeated.")
+	flags.StringVar(&baselinePath, "protected-baseline", "", "The YAML file listing the mapRoles and mapUsers repair writes along with those of the mappings.")
+	flags.BoolVar(&repairOptions.Force, "force", false, "Repair aws-auth even if it is not malformed, dropping the entries declared by no mapping.")
+	flags.BoolVar(&repairOptions.DryRun, "dry-run", false, "Only print the entries repair would rebuild aws-auth with.")
+	flags.StringVar(&output, "output", "", "The output format: text (default) or json for whoami, who-can, prune-report and repair, markdown (default), csv or json for report.")
+
+	// Accept flags anywhere among the command and its arguments.
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	var command, arg string
+	switch {
+	case len(positional) == 2 && (positional[0] == "whoami" || positional[0] == "who-can"),
+		len(positional) == 1 && (positional[0] == "prune-report" || positional[0] == "repair"):
+		command = positional[0]
+		if len(positional) == 2 {
+			arg = positional[1]
+		}
+		if output == "" {
+			output = "text"
+		}
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %q", output)
+		}
+	case len(positional) == 1 && positional[0] == "report":
+		command = positional[0]
+		if output == "" {
+			output = string(plugin.MarkdownReport)
+		}
+		if output != string(plugin.CSVReport) && output != string(plugin.JSONReport) && output != string(plugin.MarkdownReport) {
+			return fmt.Errorf("unsupported report format %q", output)
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("expected whoami <arn>, who-can <group>, report, prune-report or repair")
+	}
+
+	inspector, err := newInspector(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "who-can":
+		ids, err := inspector.WhoCan(ctx, arg)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return writeJSON(out, ids)
+		}
+		return plugin.PrintIdentities(out, ids)
+	case "report":
+		entries, err := inspector.Report(ctx)
+		if err != nil {
+			return err
+		}
+		return plugin.WriteReport(out, entries, plugin.ReportFormat(output))
+	case "prune-report":
+		candidates, err := inspector.PruneCandidates(ctx)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return writeJSON(out, candidates)
+		}
+		return plugin.PrintPruneCandidates(out, candidates)
+	case "repair":
+		if baselinePath != "" {
+			if repairOptions.Baseline, err = awsauth.LoadBaseline(baselinePath); err != nil {
+				return err
+			}
+		}
+		result, err := inspector.Repair(ctx, repairOptions)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return writeJSON(out, result)
+		}
+		return plugin.PrintRepairResult(out, result, repairOptions.DryRun)
+	}
+
+	id, err := inspector.WhoAmI(ctx, arg)
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		checks = plugin.DefaultChecks
+	}
+	access, err := inspector.Access(ctx, id, namespace, checks)
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return writeJSON(out, struct {
+			*plugin.Identity
+			Access []plugin.AccessResult `json:"access"`
+		}{id, access})
+	}
+	return plugin.PrintIdentity(out, id, access)
+}
+
+// newInspector returns an inspector of the cluster of the kubeconfig context.
+func newInspector(kubeconfig, kubecontext string) (*plugin.Inspector, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	k, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scheme := pkgruntime.NewScheme()
+	if err := v1beta1api.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.Inspector{Kubernetes: k, Client: c}, nil
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// accessWindow is the evaluation of a mapping's notBefore and expiresAt
+// times at a point in time.
+type accessWindow struct {
+	// Reason is empty when the mapping is active, otherwise it is the
+	// condition reason the mapping is inactive.
+	Reason string
+
+	// Message describes the state of the window for humans.
+	Message string
+
+	// RequeueAfter is the duration until the next window transition, or zero
+	// if there is none.
+	RequeueAfter time.Duration
+}
+
+// Active returns true if the mapping should be present in aws-auth.
+func (w accessWindow) Active() bool {
+	return w.Reason == ""
+}
+
+// NextTransitionTime returns the time of the next window transition after
+// now, or nil if there is none.
+func (w accessWindow) NextTransitionTime(now time.Time) *metav1.Time {
+	if w.RequeueAfter <= 0 {
+		return nil
+	}
+	t := metav1.NewTime(now.Add(w.RequeueAfter).Truncate(time.Second))
+	return &t
+}
+
+// evalAccessWindow evaluates the access window bounded by notBefore and
+// expiresAt and restricted by schedule at now. Any of these may be nil.
+func evalAccessWindow(now time.Time, notBefore, expiresAt *metav1.Time, schedule *v1beta1.AccessSchedule) accessWindow {
+	if expiresAt != nil && !now.Before(expiresAt.Time) {
+		return accessWindow{
+			Reason:  v1beta1.ReasonExpired,
+			Message: fmt.Sprintf("access expired at %s", expiresAt.UTC().Format(time.RFC3339)),
+		}
+	}
+	if notBefore != nil && now.Before(notBefore.Time) {
+		return accessWindow{
+			Reason:       v1beta1.ReasonNotYetValid,
+			Message:      fmt.Sprintf("access begins at %s", notBefore.UTC().Format(time.RFC3339)),
+			RequeueAfter: notBefore.Sub(now),
+		}
+	}
+
+	var window accessWindow
+	if schedule != nil {
+		open, next, err := evalAccessSchedule(now, schedule)
+		if err != nil {
+			return accessWindow{
+				Reason:  v1beta1.ReasonInvalidSchedule,
+				Message: err.Error(),
+			}
+		}
+		if !open {
+			window.Reason = v1beta1.ReasonOutsideSchedule
+			window.Message = fmt.Sprintf("access window opens at %s", next.UTC().Format(time.RFC3339))
+		}
+		window.RequeueAfter = next.Sub(now)
+	}
+	if expiresAt != nil {
+		if untilExpiry := expiresAt.Sub(now); window.RequeueAfter == 0 || untilExpiry < window.RequeueAfter {
+			window.RequeueAfter = untilExpiry
+		}
+	}
+	return window
+}
+
+// evalAccessSchedule returns whether an access window of schedule is open at
+// now, and the time the window next opens or closes.
+//
+// A window is open when the end expression fires before the start expression
+// does, as the window must have been opened by an earlier start.
+func evalAccessSchedule(now time.Time, schedule *v1beta1.AccessSchedule) (bool, time.Time, error) {
+	loc := time.UTC
+	if schedule.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(schedule.TimeZone); err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid schedule time zone: %w", err)
+		}
+	}
+	start, err := cron.ParseStandard(schedule.Start)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid schedule start: %w", err)
+	}
+	end, err := cron.ParseStandard(schedule.End)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid schedule end: %w", err)
+	}
+
+	local := now.In(loc)
+	nextStart, nextEnd := start.Next(local), end.Next(local)
+	if nextStart.IsZero() || nextEnd.IsZero() {
+		return false, time.Time{}, fmt.Errorf("schedule never fires")
+	}
+	if nextEnd.Before(nextStart) {
+		return true, nextEnd, nil
+	}
+	return false, nextStart, nil
+}
+
+// setNextTransitionTime sets the next transition time in field, returning
+// true if it changed.
+func setNextTransitionTime(field **metav1.Time, t *metav1.Time) bool {
+	if *field == nil && t == nil {
+		return false
+	}
+	if *field != nil && t != nil && (*field).Unix() == t.Unix() {
+		return false
+	}
+	*field = t
+	return true
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestEvalAccessWindow(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := metav1.NewTime(now.Add(-time.Hour))
+	after := metav1.NewTime(now.Add(time.Hour))
+
+	window := evalAccessWindow(now, nil, nil, nil)
+	g.Expect(window.Active()).To(gomega.BeTrue())
+	g.Expect(window.RequeueAfter).To(gomega.BeZero())
+
+	window = evalAccessWindow(now, &before, &after, nil)
+	g.Expect(window.Active()).To(gomega.BeTrue())
+	g.Expect(window.RequeueAfter).To(gomega.Equal(time.Hour))
+
+	window = evalAccessWindow(now, &after, nil, nil)
+	g.Expect(window.Active()).To(gomega.BeFalse())
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonNotYetValid))
+	g.Expect(window.RequeueAfter).To(gomega.Equal(time.Hour))
+
+	window = evalAccessWindow(now, nil, &before, nil)
+	g.Expect(window.Active()).To(gomega.BeFalse())
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonExpired))
+	g.Expect(window.RequeueAfter).To(gomega.BeZero())
+
+	nowTime := metav1.NewTime(now)
+	window = evalAccessWindow(now, &nowTime, &nowTime, nil)
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonExpired))
+}
+
+func TestEvalAccessWindowSchedule(t *testing.T) {
+	g := gomega.NewWithT(t)
+	schedule := &v1beta1.AccessSchedule{
+		Start:    "0 9 * * MON-FRI",
+		End:      "0 17 * * MON-FRI",
+		TimeZone: "America/New_York",
+	}
+
+	// Tuesday at 10:00 in New York is inside the window, which closes at 17:00.
+	now := time.Date(2021, 6, 1, 14, 0, 0, 0, time.UTC)
+	window := evalAccessWindow(now, nil, nil, schedule)
+	g.Expect(window.Active()).To(gomega.BeTrue())
+	g.Expect(window.RequeueAfter).To(gomega.Equal(7 * time.Hour))
+
+	// Tuesday at 18:00 in New York is outside the window, which opens Wednesday at 09:00.
+	now = time.Date(2021, 6, 1, 22, 0, 0, 0, time.UTC)
+	window = evalAccessWindow(now, nil, nil, schedule)
+	g.Expect(window.Active()).To(gomega.BeFalse())
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonOutsideSchedule))
+	g.Expect(window.RequeueAfter).To(gomega.Equal(15 * time.Hour))
+	g.Expect(window.NextTransitionTime(now).Time.Equal(time.Date(2021, 6, 2, 13, 0, 0, 0, time.UTC))).To(gomega.BeTrue())
+
+	// Expiry before the window closes requeues at expiry.
+	expiresAt := metav1.NewTime(time.Date(2021, 6, 1, 15, 0, 0, 0, time.UTC))
+	now = time.Date(2021, 6, 1, 14, 0, 0, 0, time.UTC)
+	window = evalAccessWindow(now, nil, &expiresAt, schedule)
+	g.Expect(window.Active()).To(gomega.BeTrue())
+	g.Expect(window.RequeueAfter).To(gomega.Equal(time.Hour))
+
+	window = evalAccessWindow(now, nil, nil, &v1beta1.AccessSchedule{Start: "bogus", End: "0 17 * * *"})
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonInvalidSchedule))
+	g.Expect(window.RequeueAfter).To(gomega.BeZero())
+
+	window = evalAccessWindow(now, nil, nil, &v1beta1.AccessSchedule{Start: "0 9 * * *", End: "0 17 * * *", TimeZone: "Nowhere/Special"})
+	g.Expect(window.Reason).To(gomega.Equal(v1beta1.ReasonInvalidSchedule))
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// approvalRequests returns a handler.MapFunc enqueuing the mapping of kind
+// named by an AccessApproval.
+func approvalRequests(kind string) handler.MapFunc {
+	return func(obj ctrlclient.Object) []reconcile.Request {
+		approval, ok := obj.(*v1beta1.AccessApproval)
+		if !ok || approval.Spec.Kind != kind {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: approval.Spec.Namespace, Name: approval.Spec.Name}}}
+	}
+}
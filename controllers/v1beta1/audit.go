@@ -0,0 +1,53 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"bytes"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// requester returns the identity that requested the current spec of an
+// object: the identity recorded by the creator admission webhook, or else the
+// field manager that last changed its spec.
+func requester(obj metav1.Object) string {
+	annotations := obj.GetAnnotations()
+	if requestedBy := annotations[v1beta1.RequestedByAnnotation]; requestedBy != "" {
+		return requestedBy
+	}
+	if createdBy := annotations[v1beta1.CreatedByAnnotation]; createdBy != "" {
+		return createdBy
+	}
+	var latest *metav1.ManagedFieldsEntry
+	managedFields := obj.GetManagedFields()
+	for i := range managedFields {
+		entry := &managedFields[i]
+		if entry.FieldsV1 == nil || !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:spec"`)) {
+			continue
+		}
+		if latest == nil || entry.Time != nil && (latest.Time == nil || !entry.Time.Before(latest.Time)) {
+			latest = entry
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.Manager
+}
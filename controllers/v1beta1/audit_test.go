@@ -0,0 +1,51 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestRequester(t *testing.T) {
+	g := gomega.NewWithT(t)
+	earlier := metav1.NewTime(time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(earlier.Add(time.Hour))
+	spec := &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:groups":{}}}`)}
+	status := &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:conditions":{}}}`)}
+
+	mapRole := &v1beta1.MapRole{}
+	g.Expect(requester(mapRole)).To(gomega.BeEmpty())
+
+	mapRole.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-create", Time: &earlier, FieldsV1: spec},
+		{Manager: "kubectl-edit", Time: &later, FieldsV1: spec},
+		{Manager: "manager", Time: &later, FieldsV1: status},
+	}
+	g.Expect(requester(mapRole)).To(gomega.Equal("kubectl-edit"))
+
+	mapRole.Annotations = map[string]string{v1beta1.CreatedByAnnotation: "alice"}
+	g.Expect(requester(mapRole)).To(gomega.Equal("alice"))
+
+	mapRole.Annotations[v1beta1.RequestedByAnnotation] = "bob"
+	g.Expect(requester(mapRole)).To(gomega.Equal("bob"))
+}
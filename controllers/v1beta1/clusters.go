@@ -0,0 +1,188 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/hub"
+)
+
+// hubResyncPeriod is how often mappings synced to managed clusters are
+// resynced, picking up newly registered clusters and external changes.
+const hubResyncPeriod = 5 * time.Minute
+
+// clusterService is the aws-auth service of a cluster a mapping is synced to.
+type clusterService struct {
+	// name is the name of the managed cluster, or empty for the local cluster.
+	name string
+	svc  awsauth.Service
+	err  error
+}
+
+// hubClusterServices returns the aws-auth services of the managed clusters
+// selected by selector, and of those previously synced that no longer are. A
+// nil selector selects no clusters. Their changes are audited to audit, if
+// set, attributed to trigger.
+func hubClusterServices(ctx context.Context, registry *hub.Registry, selector *metav1.LabelSelector, previous []v1beta1.ClusterStatus, audit awsauth.AuditSink, trigger *awsauth.Trigger, log logr.Logger) (selected, stale []clusterService, err error) {
+	labelSelector := labels.Nothing()
+	if selector != nil {
+		if labelSelector, err = metav1.LabelSelectorAsSelector(selector); err != nil {
+			return nil, nil, err
+		}
+	}
+	clusters, err := registry.Clusters(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	wasSynced := map[string]bool{}
+	for _, status := range previous {
+		wasSynced[status.Name] = true
+	}
+	for i := range clusters {
+		if clusters[i].Matches(labelSelector) {
+			selected = append(selected, newClusterService(ctx, &clusters[i], audit, trigger, log))
+		} else if wasSynced[clusters[i].Name] {
+			stale = append(stale, newClusterService(ctx, &clusters[i], audit, trigger, log))
+		}
+	}
+	return selected, stale, nil
+}
+
+// allHubClusterServices returns the aws-auth services of every managed cluster.
+func allHubClusterServices(ctx context.Context, registry *hub.Registry, audit awsauth.AuditSink, trigger *awsauth.Trigger, log logr.Logger) ([]clusterService, error) {
+	clusters, err := registry.Clusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]clusterService, 0, len(clusters))
+	for i := range clusters {
+		services = append(services, newClusterService(ctx, &clusters[i], audit, trigger, log))
+	}
+	return services, nil
+}
+
+func newClusterService(ctx context.Context, cluster *hub.Cluster, audit awsauth.AuditSink, trigger *awsauth.Trigger, log logr.Logger) clusterService {
+	if cluster.Err != nil {
+		return clusterService{name: cluster.Name, err: cluster.Err}
+	}
+	svc, err := awsauth.NewService(&awsauth.ServiceConfig{
+		Backend:    cluster.Backend,
+		AuditSink:  audit,
+		Trigger:    trigger,
+		Cluster:    cluster.Name,
+		Context:    ctx,
+		KubeClient: cluster.KubeClient,
+		Log:        log.WithValues("cluster", cluster.Name),
+	})
+	return clusterService{name: cluster.Name, svc: svc, err: err}
+}
+
+// syncClusters applies a change to the selected clusters and removes the
+// mapping from the stale ones. It returns the status of each selected managed
+// cluster and of each stale one the mapping could not be removed from, and
+// the aggregated errors.
+func syncClusters(selected, stale []clusterService, apply, remove func(awsauth.Service) error) ([]v1beta1.ClusterStatus, error) {
+	var statuses []v1beta1.ClusterStatus
+	var errs []error
+	sync := func(cs clusterService, fn func(awsauth.Service) error, keepSynced bool) {
+		err := cs.err
+		if err == nil {
+			err = fn(cs.svc)
+		}
+		if err != nil {
+			name := cs.name
+			if name == "" {
+				name = "local"
+			}
+			errs = append(errs, fmt.Errorf("cluster %s: %w", name, err))
+		}
+		if cs.name != "" && (keepSynced || err != nil) {
+			status := v1beta1.ClusterStatus{Name: cs.name, Synced: err == nil}
+			if err != nil {
+				status.Message = err.Error()
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	for _, cs := range selected {
+		sync(cs, apply, true)
+	}
+	for _, cs := range stale {
+		sync(cs, remove, false)
+	}
+	return statuses, kerrors.NewAggregate(errs)
+}
+
+// setClusterStatuses sets the cluster statuses of a mapping, returning
+// whether they changed.
+func setClusterStatuses(field *[]v1beta1.ClusterStatus, statuses []v1beta1.ClusterStatus) bool {
+	if len(*field) == 0 && len(statuses) == 0 || equality.Semantic.DeepEqual(*field, statuses) {
+		return false
+	}
+	*field = statuses
+	return true
+}
+
+// removeMapRole returns a function removing the MapRole keyed by username
+// from an aws-auth service, if present.
+func removeMapRole(username string) func(awsauth.Service) error {
+	return func(svc awsauth.Service) error {
+		if err := svc.RemoveMapRole(username); err != nil && !awsauth.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+// removeMapUser returns a function removing the MapUser keyed by username
+// from an aws-auth service, if present.
+func removeMapUser(username string) func(awsauth.Service) error {
+	return func(svc awsauth.Service) error {
+		if err := svc.RemoveMapUser(username); err != nil && !awsauth.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+// accessPolicies returns the EKS access policies of a mapping.
+func accessPolicies(policies []v1beta1.AccessPolicy) []awsauth.AccessPolicy {
+	var converted []awsauth.AccessPolicy
+	for _, policy := range policies {
+		converted = append(converted, awsauth.AccessPolicy{PolicyARN: policy.PolicyARN, Namespaces: policy.Namespaces})
+	}
+	return converted
+}
+
+// minRequeueAfter returns the shortest non-zero duration.
+func minRequeueAfter(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
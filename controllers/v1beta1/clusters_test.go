@@ -0,0 +1,117 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/gomega"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/hub"
+)
+
+func TestSyncClusters(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	scheme := pkgruntime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(gomega.Succeed())
+	var secrets []ctrlclient.Object
+	clients := map[string]*fake.Clientset{}
+	for _, name := range []string{"dev", "prod-eu", "prod-us"} {
+		env := "prod"
+		if name == "dev" {
+			env = "dev"
+		}
+		clients[name] = fake.NewSimpleClientset()
+		secrets = append(secrets, &kcorev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "hub", Name: name, Labels: map[string]string{hub.ClusterLabel: "true", "env": env}},
+			Data:       map[string][]byte{hub.KubeconfigKey: []byte(name)},
+		})
+	}
+	registry := &hub.Registry{
+		Reader:    ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(secrets...).Build(),
+		Namespace: "hub",
+		NewClient: func(kubeconfig []byte) (kubernetes.Interface, error) {
+			if string(kubeconfig) == "prod-eu" {
+				return nil, errors.New("unreachable")
+			}
+			return clients[string(kubeconfig)], nil
+		},
+	}
+	upsert := func(svc awsauth.Service) error {
+		return svc.UpsertMapRole("admin", awsauth.MapRole{RoleARN: "arn:aws:iam::123456789012:role/admin"})
+	}
+	mapRoles := func(name string) int {
+		auth, _, err := awsauth.ReadAuthMap(clients[name])
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return len(auth.MapRoles)
+	}
+
+	// Mappings are synced to every selected cluster, reporting failures per cluster.
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	selected, stale, err := hubClusterServices(ctx, registry, selector, nil, nil, nil, logr.Discard())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(selected).To(gomega.HaveLen(2))
+	g.Expect(stale).To(gomega.BeEmpty())
+	statuses, err := syncClusters(selected, stale, upsert, removeMapRole("admin"))
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("cluster prod-eu: unreachable")))
+	g.Expect(statuses).To(gomega.Equal([]v1beta1.ClusterStatus{
+		{Name: "prod-eu", Synced: false, Message: "unreachable"},
+		{Name: "prod-us", Synced: true},
+	}))
+	g.Expect(mapRoles("prod-us")).To(gomega.Equal(1))
+
+	// Clusters no longer selected have the mapping removed.
+	selector.MatchLabels["env"] = "dev"
+	statuses = []v1beta1.ClusterStatus{{Name: "prod-us", Synced: true}}
+	selected, stale, err = hubClusterServices(ctx, registry, selector, statuses, nil, nil, logr.Discard())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(selected).To(gomega.HaveLen(1))
+	g.Expect(stale).To(gomega.HaveLen(1))
+	statuses, err = syncClusters(selected, stale, upsert, removeMapRole("admin"))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(statuses).To(gomega.Equal([]v1beta1.ClusterStatus{{Name: "dev", Synced: true}}))
+	g.Expect(mapRoles("dev")).To(gomega.Equal(1))
+	g.Expect(mapRoles("prod-us")).To(gomega.Equal(0))
+
+	// A nil selector selects no clusters.
+	selected, stale, err = hubClusterServices(ctx, registry, nil, statuses, nil, nil, logr.Discard())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(selected).To(gomega.BeEmpty())
+	g.Expect(stale).To(gomega.HaveLen(1))
+}
+
+func TestMinRequeueAfter(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(minRequeueAfter(0, time.Minute)).To(gomega.Equal(time.Minute))
+	g.Expect(minRequeueAfter(time.Hour, time.Minute)).To(gomega.Equal(time.Minute))
+	g.Expect(minRequeueAfter(time.Second, 0)).To(gomega.Equal(time.Second))
+}
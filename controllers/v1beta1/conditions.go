@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// setCondition sets the condition of conditionType in conditions, returning
+// true if it changed.
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	existing := meta.FindStatusCondition(*conditions, conditionType)
+	changed := existing == nil || existing.Status != status || existing.Reason != reason ||
+		existing.Message != message || existing.ObservedGeneration != generation
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	return changed
+}
+
+// syncedMessage returns the message of the Active condition of a mapping
+// present in aws-auth, describing any rewrite of its ARN.
+func syncedMessage(rewrite string) string {
+	if rewrite == "" {
+		return "mapping is present in aws-auth"
+	}
+	return "mapping is present in aws-auth, " + rewrite
+}
+
+// syncFailedReason returns the reason of the Active condition of a mapping
+// that could not be synced to aws-auth because of err.
+func syncFailedReason(err error) string {
+	if awsauth.IsTooLarge(err) {
+		return v1beta1.ReasonAuthMapTooLarge
+	}
+	if awsauth.IsMalformed(err) {
+		return v1beta1.ReasonAuthMapMalformed
+	}
+	return v1beta1.ReasonSyncFailed
+}
+
+// setAuthMapHeadroom sets the aws-auth ConfigMap headroom of a mapping to the
+// one last observed by monitor, if any, returning true if it changed.
+func setAuthMapHeadroom(field **int64, monitor *awsauth.SizeMonitor) bool {
+	headroom, observed := monitor.Headroom()
+	if !observed || *field != nil && **field == int64(headroom) {
+		return false
+	}
+	value := int64(headroom)
+	*field = &value
+	return true
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+func TestSetCondition(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var conditions []metav1.Condition
+
+	g.Expect(setCondition(&conditions, 1, v1beta1.ConditionActive, metav1.ConditionTrue, v1beta1.ReasonSynced, "synced")).To(gomega.BeTrue())
+	g.Expect(setCondition(&conditions, 1, v1beta1.ConditionActive, metav1.ConditionTrue, v1beta1.ReasonSynced, "synced")).To(gomega.BeFalse())
+	g.Expect(setCondition(&conditions, 1, v1beta1.ConditionActive, metav1.ConditionFalse, v1beta1.ReasonExpired, "expired")).To(gomega.BeTrue())
+	g.Expect(setCondition(&conditions, 1, v1beta1.ConditionApproved, metav1.ConditionTrue, v1beta1.ReasonApproved, "approved")).To(gomega.BeTrue())
+	g.Expect(conditions).To(gomega.HaveLen(2))
+	g.Expect(conditions[0].Reason).To(gomega.Equal(v1beta1.ReasonExpired))
+}
+
+func TestSyncFailedReason(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(syncFailedReason(errors.New("conflict"))).To(gomega.Equal(v1beta1.ReasonSyncFailed))
+	g.Expect(syncFailedReason(fmt.Errorf("cluster local: %w", awsauth.ErrTooLarge))).To(gomega.Equal(v1beta1.ReasonAuthMapTooLarge))
+	g.Expect(syncFailedReason(&awsauth.MalformedError{Key: "mapRoles", Line: 3})).To(gomega.Equal(v1beta1.ReasonAuthMapMalformed))
+}
+
+func TestSetAuthMapHeadroom(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var headroom *int64
+	monitor := &awsauth.SizeMonitor{}
+
+	// Nothing is reported until the aws-auth ConfigMap has been written.
+	g.Expect(setAuthMapHeadroom(&headroom, nil)).To(gomega.BeFalse())
+	g.Expect(setAuthMapHeadroom(&headroom, monitor)).To(gomega.BeFalse())
+	g.Expect(headroom).To(gomega.BeNil())
+
+	monitor.Observe(1024)
+	g.Expect(setAuthMapHeadroom(&headroom, monitor)).To(gomega.BeTrue())
+	g.Expect(*headroom).To(gomega.Equal(int64(awsauth.MaxAuthMapSize - 1024)))
+	g.Expect(setAuthMapHeadroom(&headroom, monitor)).To(gomega.BeFalse())
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// ConflictPolicy decides which of the mappings of the same IAM principal or
+// Kubernetes username is written to aws-auth.
+type ConflictPolicy string
+
+const (
+	// RejectNewerPolicy keeps the mapping already present in aws-auth, or the
+	// oldest if none is, and rejects the mappings conflicting with it since.
+	RejectNewerPolicy ConflictPolicy = "reject-newer"
+
+	// OldestWinsPolicy writes the oldest mapping, displacing any newer one
+	// already present in aws-auth.
+	OldestWinsPolicy ConflictPolicy = "oldest-wins"
+
+	// MergeGroupsPolicy writes the groups of every mapping of the same IAM
+	// principal to the entry of the oldest of them. Username collisions, such
+	// as between a MapRole and a MapUser, cannot be merged, and are resolved
+	// as by OldestWinsPolicy.
+	MergeGroupsPolicy ConflictPolicy = "merge-groups"
+)
+
+// conflictParty is a mapping as a party to conflicts.
+type conflictParty struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Username is the username of the mapping in aws-auth.
+	Username string
+
+	// ARN is the normalized ARN of the IAM principal of the mapping.
+	ARN    string
+	Groups []string
+
+	Created metav1.Time
+
+	// Active is whether the mapping was last reported present in aws-auth.
+	Active bool
+
+	// Gated is whether the mapping is kept out of aws-auth regardless of its
+	// conflicts, by its access window, approval, groups or principal, so that
+	// it cannot win them.
+	Gated bool
+}
+
+// String returns the kind, namespace if any, and name of the party.
+func (p conflictParty) String() string {
+	if p.Namespace != "" {
+		return p.Kind + "/" + p.Namespace + "/" + p.Name
+	}
+	return p.Kind + "/" + p.Name
+}
+
+// is returns true if p and other are the same mapping.
+func (p conflictParty) is(other conflictParty) bool {
+	return p.Kind == other.Kind && p.Namespace == other.Namespace && p.Name == other.Name
+}
+
+// sameARN returns true if p and other map the same IAM principal.
+func (p conflictParty) sameARN(other conflictParty) bool {
+	return p.ARN != "" && p.ARN == other.ARN
+}
+
+// conflictsWith returns true if p and other are different mappings of the
+// same IAM principal, or of the same username in aws-auth.
+func (p conflictParty) conflictsWith(other conflictParty) bool {
+	return !p.is(other) && (p.sameARN(other) || p.Username == other.Username)
+}
+
+// olderThan returns true if p was created before other, ordering by kind and
+// name if they were created at the same time.
+func (p conflictParty) olderThan(other conflictParty) bool {
+	if !p.Created.Equal(&other.Created) {
+		return p.Created.Before(&other.Created)
+	}
+	if p.Kind != other.Kind {
+		return p.Kind < other.Kind
+	}
+	if p.Namespace != other.Namespace {
+		return p.Namespace < other.Namespace
+	}
+	return p.Name < other.Name
+}
+
+// mapRoleParty returns a MapRole as a conflict party.
+func mapRoleParty(mapRole *v1beta1.MapRole) conflictParty {
+	window := evalAccessWindow(time.Now(), mapRole.Spec.NotBefore, mapRole.Spec.ExpiresAt, mapRole.Spec.Schedule)
+	return newConflictParty("MapRole", &mapRole.ObjectMeta, mapRole.Name, awsauth.MapRoleData, mapRole.Spec.RoleARN, mapRole.Spec.Groups, window, mapRole.Status.Conditions)
+}
+
+// mapUserParty returns a MapUser as a conflict party.
+func mapUserParty(mapUser *v1beta1.MapUser) conflictParty {
+	window := evalAccessWindow(time.Now(), mapUser.Spec.NotBefore, mapUser.Spec.ExpiresAt, mapUser.Spec.Schedule)
+	return newConflictParty("MapUser", &mapUser.ObjectMeta, mapUser.Name, awsauth.MapUserData, mapUser.Spec.UserARN, mapUser.Spec.Groups, window, mapUser.Status.Conditions)
+}
+
+// namespacedMapRoleParty returns a NamespacedMapRole as a conflict party.
+func namespacedMapRoleParty(mapRole *v1beta1.NamespacedMapRole) conflictParty {
+	return newConflictParty("NamespacedMapRole", &mapRole.ObjectMeta, mapRole.Username(), awsauth.MapRoleData, mapRole.Spec.RoleARN, mapRole.Spec.Groups, accessWindow{}, mapRole.Status.Conditions)
+}
+
+// permissionSetMappingParty returns a PermissionSetMapping mapping roleARN,
+// the role last resolved for its permission set, as a conflict party.
+func permissionSetMappingParty(mapping *v1beta1.PermissionSetMapping, roleARN string) conflictParty {
+	return newConflictParty("PermissionSetMapping", &mapping.ObjectMeta, mapping.Username(), awsauth.MapRoleData, roleARN, mapping.Spec.Groups, accessWindow{}, mapping.Status.Conditions)
+}
+
+// gateConditions are the conditions that keep a mapping out of aws-auth
+// whatever its conflicts while false.
+var gateConditions = []string{v1beta1.ConditionApproved, v1beta1.ConditionValid, v1beta1.ConditionAllowed, v1beta1.ConditionVerified}
+
+func newConflictParty(kind string, obj *metav1.ObjectMeta, username string, dataType awsauth.DataType, principalARN string, groups []string, window accessWindow, conditions []metav1.Condition) conflictParty {
+	// Mappings of invalid ARNs are never written, so cannot conflict by ARN.
+	normalized, _, err := awsauth.NormalizeARN(dataType, principalARN)
+	if err != nil {
+		normalized = ""
+	}
+	party := conflictParty{
+		Kind:      kind,
+		Namespace: obj.Namespace,
+		Name:      obj.Name,
+		Username:  username,
+		ARN:       normalized,
+		Groups:    groups,
+		Created:   obj.CreationTimestamp,
+		Active:    meta.IsStatusConditionTrue(conditions, v1beta1.ConditionActive),
+	}
+	// A mapping present in aws-auth is a party whatever its conditions last
+	// reported, as they may be left over from checks no longer required.
+	if !party.Active {
+		party.Gated = window.Reason != ""
+		for _, conditionType := range gateConditions {
+			party.Gated = party.Gated || meta.IsStatusConditionFalse(conditions, conditionType)
+		}
+	}
+	return party
+}
+
+// listConflictParties returns the mappings of every kind not being deleted as
+// conflict parties.
+func listConflictParties(ctx context.Context, c ctrlclient.Reader) ([]conflictParty, error) {
+	var mapRoles v1beta1.MapRoleList
+	if err := c.List(ctx, &mapRoles); err != nil {
+		return nil, err
+	}
+	var mapUsers v1beta1.MapUserList
+	if err := c.List(ctx, &mapUsers); err != nil {
+		return nil, err
+	}
+	var namespacedMapRoles v1beta1.NamespacedMapRoleList
+	if err := c.List(ctx, &namespacedMapRoles); err != nil {
+		return nil, err
+	}
+	var permissionSetMappings v1beta1.PermissionSetMappingList
+	if err := c.List(ctx, &permissionSetMappings); err != nil {
+		return nil, err
+	}
+	parties := make([]conflictParty, 0, len(mapRoles.Items)+len(mapUsers.Items)+len(namespacedMapRoles.Items)+len(permissionSetMappings.Items))
+	for i := range mapRoles.Items {
+		if mapRoles.Items[i].DeletionTimestamp == nil {
+			parties = append(parties, mapRoleParty(&mapRoles.Items[i]))
+		}
+	}
+	for i := range mapUsers.Items {
+		if mapUsers.Items[i].DeletionTimestamp == nil {
+			parties = append(parties, mapUserParty(&mapUsers.Items[i]))
+		}
+	}
+	for i := range namespacedMapRoles.Items {
+		if namespacedMapRoles.Items[i].DeletionTimestamp == nil {
+			parties = append(parties, namespacedMapRoleParty(&namespacedMapRoles.Items[i]))
+		}
+	}
+	for i := range permissionSetMappings.Items {
+		mapping := &permissionSetMappings.Items[i]
+		if mapping.DeletionTimestamp == nil {
+			parties = append(parties, permissionSetMappingParty(mapping, mapping.Status.RoleARN))
+		}
+	}
+	return parties, nil
+}
+
+// conflictResolution is the outcome of the conflicts of a mapping.
+type conflictResolution struct {
+	// Reason and Message of the Conflict condition of the mapping, with the
+	// NoConflict reason if it has none.
+	Reason  string
+	Message string
+
+	// Rejected keeps the mapping out of aws-auth.
+	Rejected bool
+
+	// Groups are the groups the mapping is written to aws-auth with.
+	Groups []string
+}
+
+// Conflicting returns true if the mapping conflicts with any other.
+func (r conflictResolution) Conflicting() bool {
+	return r.Reason != v1beta1.ReasonNoConflict
+}
+
+// resolveConflicts resolves the conflicts of self with the other parties
+// according to policy, defaulting to RejectNewerPolicy. Gated parties are
+// ignored, so that a mapping kept out of aws-auth, such as an expired one,
+// does not keep the others out with it.
+func resolveConflicts(self conflictParty, parties []conflictParty, policy ConflictPolicy) conflictResolution {
+	var peers []conflictParty
+	for _, party := range parties {
+		if self.conflictsWith(party) && !party.Gated {
+			peers = append(peers, party)
+		}
+	}
+	if len(peers) == 0 {
+		return conflictResolution{
+			Reason:  v1beta1.ReasonNoConflict,
+			Message: "no other mapping has the same IAM principal or username",
+			Groups:  self.Groups,
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].olderThan(peers[j]) })
+
+	var descriptions []string
+	winner := self
+	for _, peer := range peers {
+		if peer.sameARN(self) {
+			descriptions = append(descriptions, fmt.Sprintf("%s has the same ARN %s", peer, peer.ARN))
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("%s has the same username %s", peer, peer.Username))
+		}
+		// The mapping present in aws-auth keeps it under RejectNewerPolicy.
+		if policy != OldestWinsPolicy && policy != MergeGroupsPolicy && peer.Active != winner.Active {
+			if peer.Active {
+				winner = peer
+			}
+			continue
+		}
+		if peer.olderThan(winner) {
+			winner = peer
+		}
+	}
+	message := strings.Join(descriptions, "; ")
+
+	mergeable := func(party conflictParty) bool {
+		return policy == MergeGroupsPolicy && party.sameARN(self)
+	}
+	if !winner.is(self) {
+		reason := v1beta1.ReasonConflictRejected
+		if mergeable(winner) {
+			reason = v1beta1.ReasonGroupsMerged
+			message += fmt.Sprintf(", groups merged into %s", winner)
+		} else {
+			message += fmt.Sprintf(", kept out of aws-auth in favor of %s", winner)
+		}
+		return conflictResolution{Reason: reason, Message: message, Rejected: true}
+	}
+
+	resolution := conflictResolution{
+		Reason:  v1beta1.ReasonConflictWon,
+		Message: message + ", written to aws-auth in their place",
+		Groups:  self.Groups,
+	}
+	for _, peer := range peers {
+		if mergeable(peer) {
+			resolution.Reason = v1beta1.ReasonGroupsMerged
+			resolution.Message = message + ", groups merged into this mapping"
+			resolution.Groups = mergeGroups(resolution.Groups, peer.Groups)
+		}
+	}
+	return resolution
+}
+
+// mergeGroups returns the groups of a followed by those of b not in a.
+func mergeGroups(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, group := range b {
+		found := false
+		for _, existing := range merged {
+			if existing == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, group)
+		}
+	}
+	return merged
+}
+
+// setConflictCondition sets the Conflict condition of a mapping from its
+// resolution, returning true if it changed.
+func setConflictCondition(conditions *[]metav1.Condition, generation int64, resolution conflictResolution) bool {
+	status := metav1.ConditionFalse
+	if resolution.Conflicting() {
+		status = metav1.ConditionTrue
+	}
+	return setCondition(conditions, generation, v1beta1.ConditionConflict, status, resolution.Reason, resolution.Message)
+}
+
+// conflictRequests returns a handler.MapFunc enqueuing the objects of kind
+// conflicting with a changed mapping, so that their conflicts are resolved
+// again.
+func conflictRequests(c ctrlclient.Reader, kind string) handler.MapFunc {
+	return func(obj ctrlclient.Object) []reconcile.Request {
+		var changed conflictParty
+		switch obj := obj.(type) {
+		case *v1beta1.MapRole:
+			changed = mapRoleParty(obj)
+		case *v1beta1.MapUser:
+			changed = mapUserParty(obj)
+		case *v1beta1.NamespacedMapRole:
+			changed = namespacedMapRoleParty(obj)
+		case *v1beta1.PermissionSetMapping:
+			changed = permissionSetMappingParty(obj, obj.Status.RoleARN)
+		default:
+			return nil
+		}
+		parties, err := listConflictParties(context.Background(), c)
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, party := range parties {
+			if party.Kind == kind && changed.conflictsWith(party) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: party.Namespace, Name: party.Name}})
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+const conflictRoleARN = "arn:aws:iam::123456789012:role/admin"
+
+func conflictTime(minutes int) metav1.Time {
+	return metav1.NewTime(time.Date(2021, 6, 1, 0, minutes, 0, 0, time.UTC))
+}
+
+func TestResolveConflicts(t *testing.T) {
+	g := gomega.NewWithT(t)
+	older := conflictParty{Kind: "MapRole", Name: "admin", Username: "admin", ARN: conflictRoleARN, Groups: []string{"system:masters"}, Created: conflictTime(0)}
+	newer := conflictParty{Kind: "MapRole", Name: "ops", Username: "ops", ARN: conflictRoleARN, Groups: []string{"ops", "system:masters"}, Created: conflictTime(1), Active: true}
+	user := conflictParty{Kind: "MapUser", Name: "ops", Username: "ops", ARN: "arn:aws:iam::123456789012:user/ops", Created: conflictTime(2)}
+	other := conflictParty{Kind: "MapRole", Name: "view", Username: "view", ARN: "arn:aws:iam::123456789012:role/view", Created: conflictTime(3)}
+	parties := []conflictParty{older, newer, user, other}
+
+	resolution := resolveConflicts(other, parties, RejectNewerPolicy)
+	g.Expect(resolution.Conflicting()).To(gomega.BeFalse())
+	g.Expect(resolution.Rejected).To(gomega.BeFalse())
+
+	// The mapping present in aws-auth keeps it under the reject-newer policy.
+	resolution = resolveConflicts(older, parties, RejectNewerPolicy)
+	g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonConflictRejected))
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+	g.Expect(resolution.Message).To(gomega.Equal("MapRole/ops has the same ARN " + conflictRoleARN + ", kept out of aws-auth in favor of MapRole/ops"))
+	resolution = resolveConflicts(newer, parties, RejectNewerPolicy)
+	g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonConflictWon))
+	g.Expect(resolution.Rejected).To(gomega.BeFalse())
+	g.Expect(resolution.Groups).To(gomega.Equal(newer.Groups))
+	g.Expect(resolveConflicts(user, parties, RejectNewerPolicy).Rejected).To(gomega.BeTrue())
+
+	// The oldest mapping displaces it under the oldest-wins policy.
+	g.Expect(resolveConflicts(older, parties, OldestWinsPolicy).Rejected).To(gomega.BeFalse())
+	resolution = resolveConflicts(newer, parties, OldestWinsPolicy)
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+	g.Expect(resolution.Message).To(gomega.Equal("MapRole/admin has the same ARN " + conflictRoleARN + "; MapUser/ops has the same username ops, kept out of aws-auth in favor of MapRole/admin"))
+
+	// The groups of the same principal are merged into the oldest mapping
+	// under the merge-groups policy.
+	resolution = resolveConflicts(older, parties, MergeGroupsPolicy)
+	g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonGroupsMerged))
+	g.Expect(resolution.Rejected).To(gomega.BeFalse())
+	g.Expect(resolution.Groups).To(gomega.Equal([]string{"system:masters", "ops"}))
+	resolution = resolveConflicts(newer, parties, MergeGroupsPolicy)
+	g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonGroupsMerged))
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+
+	// Username collisions cannot be merged.
+	resolution = resolveConflicts(user, parties, MergeGroupsPolicy)
+	g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonConflictRejected))
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+}
+
+func TestSetConflictCondition(t *testing.T) {
+	g := gomega.NewWithT(t)
+	var conditions []metav1.Condition
+	g.Expect(setConflictCondition(&conditions, 1, conflictResolution{Reason: v1beta1.ReasonNoConflict})).To(gomega.BeTrue())
+	g.Expect(conditions[0].Status).To(gomega.Equal(metav1.ConditionFalse))
+	g.Expect(setConflictCondition(&conditions, 1, conflictResolution{Reason: v1beta1.ReasonConflictWon})).To(gomega.BeTrue())
+	g.Expect(conditions[0].Status).To(gomega.Equal(metav1.ConditionTrue))
+}
+
+func TestConflictRequests(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	admin := &v1beta1.MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+		Spec:       v1beta1.MapRoleSpec{RoleARN: conflictRoleARN},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		admin,
+		&v1beta1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops"},
+			Spec:       v1beta1.MapRoleSpec{RoleARN: conflictRoleARN},
+		},
+		&v1beta1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "view"},
+			Spec:       v1beta1.MapRoleSpec{RoleARN: "arn:aws:iam::123456789012:role/view"},
+		},
+		&v1beta1.MapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+			Spec:       v1beta1.MapUserSpec{UserARN: "arn:aws:iam::123456789012:user/admin"},
+		},
+	).Build()
+
+	g.Expect(conflictRequests(c, "MapRole")(admin)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Name: "ops"}}}))
+	g.Expect(conflictRequests(c, "MapUser")(admin)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Name: "admin"}}}))
+}
+
+func TestConflicts_AllKinds(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	admin := &v1beta1.MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin", CreationTimestamp: conflictTime(0)},
+		Spec:       v1beta1.MapRoleSpec{RoleARN: conflictRoleARN, Groups: []string{"system:masters"}},
+	}
+	namespaced := &v1beta1.NamespacedMapRole{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "admin", CreationTimestamp: conflictTime(1)},
+		Spec:       v1beta1.NamespacedMapRoleSpec{RoleARN: conflictRoleARN, Groups: []string{"team-a-devs"}},
+	}
+	permissionSet := &v1beta1.PermissionSetMapping{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins", CreationTimestamp: conflictTime(2)},
+		Spec:       v1beta1.PermissionSetMappingSpec{AccountID: "123456789012", PermissionSetName: "AdministratorAccess"},
+		Status:     v1beta1.PermissionSetMappingStatus{RoleARN: conflictRoleARN},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(admin, namespaced, permissionSet).Build()
+
+	parties, err := listConflictParties(context.Background(), c)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(parties).To(gomega.HaveLen(3))
+
+	// Mappings of other kinds of the same role conflict with the MapRole.
+	resolution := resolveConflicts(namespacedMapRoleParty(namespaced), parties, OldestWinsPolicy)
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+	g.Expect(resolution.Message).To(gomega.Equal("MapRole/admin has the same ARN " + conflictRoleARN + "; PermissionSetMapping/admins has the same ARN " + conflictRoleARN + ", kept out of aws-auth in favor of MapRole/admin"))
+	g.Expect(resolveConflicts(permissionSetMappingParty(permissionSet, conflictRoleARN), parties, OldestWinsPolicy).Rejected).To(gomega.BeTrue())
+	resolution = resolveConflicts(mapRoleParty(admin), parties, MergeGroupsPolicy)
+	g.Expect(resolution.Rejected).To(gomega.BeFalse())
+	g.Expect(resolution.Groups).To(gomega.Equal([]string{"system:masters", "team-a-devs"}))
+
+	// The objects of each kind conflicting with a changed mapping are enqueued.
+	g.Expect(conflictRequests(c, "NamespacedMapRole")(admin)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "admin"}}}))
+	g.Expect(conflictRequests(c, "PermissionSetMapping")(namespaced)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Name: "admins"}}}))
+	g.Expect(conflictRequests(c, "MapRole")(permissionSet)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Name: "admin"}}}))
+}
+
+func TestConflicts_Gated(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	expiresAt := metav1.NewTime(time.Now().Add(-time.Hour))
+	expired := &v1beta1.MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "expired", CreationTimestamp: conflictTime(0)},
+		Spec:       v1beta1.MapRoleSpec{RoleARN: conflictRoleARN, ExpiresAt: &expiresAt},
+	}
+	pending := &v1beta1.MapUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "valid", CreationTimestamp: conflictTime(1)},
+		Spec:       v1beta1.MapUserSpec{UserARN: "arn:aws:iam::123456789012:user/valid"},
+		Status: v1beta1.MapUserStatus{Conditions: []metav1.Condition{
+			{Type: v1beta1.ConditionApproved, Status: metav1.ConditionFalse, Reason: v1beta1.ReasonPendingApproval},
+		}},
+	}
+	valid := &v1beta1.MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "valid", CreationTimestamp: conflictTime(2)},
+		Spec:       v1beta1.MapRoleSpec{RoleARN: conflictRoleARN},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(expired, pending, valid).Build()
+
+	parties, err := listConflictParties(context.Background(), c)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(parties).To(gomega.HaveLen(3))
+
+	// The older expired MapRole and pending MapUser do not keep the newer
+	// valid MapRole out of aws-auth.
+	for _, policy := range []ConflictPolicy{RejectNewerPolicy, OldestWinsPolicy, MergeGroupsPolicy} {
+		resolution := resolveConflicts(mapRoleParty(valid), parties, policy)
+		g.Expect(resolution.Reason).To(gomega.Equal(v1beta1.ReasonNoConflict), string(policy))
+		g.Expect(resolution.Rejected).To(gomega.BeFalse(), string(policy))
+	}
+	// Changes to gated mappings still enqueue the mappings they conflict with.
+	g.Expect(conflictRequests(c, "MapRole")(expired)).To(gomega.Equal([]reconcile.Request{{NamespacedName: types.NamespacedName{Name: "valid"}}}))
+
+	// A mapping present in aws-auth remains a party whatever its conditions.
+	pending.Status.Conditions = append(pending.Status.Conditions, metav1.Condition{Type: v1beta1.ConditionActive, Status: metav1.ConditionTrue, Reason: v1beta1.ReasonSynced})
+	g.Expect(mapUserParty(pending).Gated).To(gomega.BeFalse())
+	resolution := resolveConflicts(mapRoleParty(valid), []conflictParty{mapRoleParty(expired), mapUserParty(pending)}, OldestWinsPolicy)
+	g.Expect(resolution.Rejected).To(gomega.BeTrue())
+	g.Expect(resolution.Message).To(gomega.Equal("MapUser/valid has the same username valid, kept out of aws-auth in favor of MapUser/valid"))
+}
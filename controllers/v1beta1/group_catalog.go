@@ -0,0 +1,81 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// resolveAuthGroups returns the names of the AuthGroup objects cataloging
+// groups, and a message naming the groups not cataloged by any of them.
+func resolveAuthGroups(ctx context.Context, c ctrlclient.Reader, groups []string) ([]string, string, error) {
+	var authGroups v1beta1.AuthGroupList
+	if err := c.List(ctx, &authGroups); err != nil {
+		return nil, "", err
+	}
+	catalog, unknown := authGroups.Resolve(groups)
+	if len(unknown) == 0 {
+		return catalog, "", nil
+	}
+	return catalog, fmt.Sprintf("groups not cataloged by any AuthGroup: %s", strings.Join(unknown, ", ")), nil
+}
+
+// setAuthGroups sets the AuthGroup names in a mapping's status, returning
+// whether they changed.
+func setAuthGroups(field *[]string, names []string) bool {
+	if len(*field) == 0 && len(names) == 0 || reflect.DeepEqual(*field, names) {
+		return false
+	}
+	*field = names
+	return true
+}
+
+// listRequests returns a handler.MapFunc enqueuing every object in the list
+// returned by newList, as a change to a shared object may affect any of them.
+func listRequests(c ctrlclient.Reader, newList func() ctrlclient.ObjectList) handler.MapFunc {
+	return func(_ ctrlclient.Object) []reconcile.Request {
+		list := newList()
+		if err := c.List(context.Background(), list); err != nil {
+			return nil
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(items))
+		for _, item := range items {
+			if obj, ok := item.(ctrlclient.Object); ok {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: obj.GetNamespace(),
+					Name:      obj.GetName(),
+				}})
+			}
+		}
+		return requests
+	}
+}
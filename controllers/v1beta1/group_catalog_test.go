@@ -0,0 +1,64 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestResolveAuthGroups(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1beta1.AuthGroup{ObjectMeta: metav1.ObjectMeta{Name: "masters"}, Spec: v1beta1.AuthGroupSpec{Group: "system:masters"}},
+		&v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"}},
+		&v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "ops"}},
+	).Build()
+
+	catalog, unknown, err := resolveAuthGroups(context.Background(), c, []string{"system:masters"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(catalog).To(gomega.Equal([]string{"masters"}))
+	g.Expect(unknown).To(gomega.BeEmpty())
+
+	catalog, unknown, err = resolveAuthGroups(context.Background(), c, []string{"system:master", "ops"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(catalog).To(gomega.BeEmpty())
+	g.Expect(unknown).To(gomega.Equal("groups not cataloged by any AuthGroup: system:master, ops"))
+
+	var status []string
+	g.Expect(setAuthGroups(&status, nil)).To(gomega.BeFalse())
+	g.Expect(setAuthGroups(&status, []string{"masters"})).To(gomega.BeTrue())
+	g.Expect(setAuthGroups(&status, []string{"masters"})).To(gomega.BeFalse())
+
+	requests := listRequests(c, func() ctrlclient.ObjectList { return &v1beta1.MapRoleList{} })(nil)
+	g.Expect(requests).To(gomega.ConsistOf(
+		reconcile.Request{NamespacedName: types.NamespacedName{Name: "admin"}},
+		reconcile.Request{NamespacedName: types.NamespacedName{Name: "ops"}},
+	))
+}
@@ -18,30 +18,104 @@ package v1beta1
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
+	kcorev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/sambatv/aws-auth-operator/allowlist"
 	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
 	"github.com/sambatv/aws-auth-operator/awsauth"
-	"github.com/sambatv/aws-auth-operator/kube"
+	"github.com/sambatv/aws-auth-operator/health"
+	"github.com/sambatv/aws-auth-operator/hub"
+	"github.com/sambatv/aws-auth-operator/principal"
 )
 
 // MapRoleReconciler reconciles a MapRole object
 type MapRoleReconciler struct {
 	ctrlclient.Client
-	Log    logr.Logger
-	Scheme *pkgruntime.Scheme
+	Log      logr.Logger
+	Scheme   *pkgruntime.Scheme
+	Recorder record.EventRecorder
+
+	// Approval, if set, keeps MapRole objects out of aws-auth until approved.
+	Approval *approval.Checker
+
+	// RequireCatalogedGroups keeps MapRole objects assigning groups not
+	// cataloged by an AuthGroup out of aws-auth.
+	RequireCatalogedGroups bool
+
+	// ConflictPolicy decides which of the MapRole and the mappings it conflicts
+	// with is written to aws-auth, defaulting to RejectNewerPolicy.
+	ConflictPolicy ConflictPolicy
+
+	// Backend stores the mappings of the local cluster, defaulting to its
+	// aws-auth ConfigMap.
+	Backend awsauth.Backend
+
+	// AuditSink, if set, receives a record of each change made to aws-auth.
+	AuditSink awsauth.AuditSink
+
+	// SizeMonitor, if set, tracks the size of the local aws-auth ConfigMap,
+	// whose headroom is reported in the MapRole status.
+	SizeMonitor *awsauth.SizeMonitor
+
+	// Selector, if set, limits the objects reconciled by this operator
+	// instance, leaving the others to the instances selecting them.
+	Selector labels.Selector
+
+	// Owner, if set, is the operator instance owning the aws-auth entries of
+	// the selected objects, which only removes the entries it owns.
+	Owner string
+
+	// Progress, if set, tracks the reconciles in flight for the liveness check.
+	Progress *health.Progress
+
+	// MaxConcurrentReconciles is the number of objects reconciled at once,
+	// defaulting to one.
+	MaxConcurrentReconciles int
+
+	// Hub, if set, syncs MapRole objects with a cluster selector to the
+	// managed clusters it selects instead of the local cluster.
+	Hub *hub.Registry
+
+	// BindableClusterRoles lists the ClusterRoles that the spec.rbac of MapRole
+	// objects may bind. Bindings of other ClusterRoles are refused.
+	BindableClusterRoles []string
+
+	// Verifier, if set, keeps MapRole objects out of aws-auth unless their IAM
+	// principal exists with the unique ID it had when they were approved.
+	Verifier principal.Verifier
+
+	// Allowlist, if set, keeps MapRole objects out of aws-auth unless their IAM
+	// principal is in an allowed AWS partition and account.
+	Allowlist *allowlist.Allowlist
 }
 
-//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
 //+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list,namespace=system
 //+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=maproles,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=maproles/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=maproles/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=accessapprovals,verbs=get;list;watch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=authgroups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings;rolebindings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=bind,resourceNames=admin;edit;view
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -49,21 +123,31 @@ type MapRoleReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *MapRoleReconciler) Reconcile(ctx context.Context, req ctrlruntime.Request) (ctrlruntime.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "MapRole", req)
+	defer span.End()
+
 	mapRoleName := req.NamespacedName.Name
 
 	log := r.Log.WithValues("MapRole", mapRoleName)
 	log.Info("reconciling MapRole...")
 
-	kubeClient, err := kube.GetClient()
+	kubeClient, err := getKubeClient(ctx)
 	if err != nil {
 		log.Error(err, "failure getting kube client")
 		return ctrlruntime.Result{}, err
 	}
 
-	// Get a new aws auth service object.
+	// Get a new aws auth service object, attributing its changes to the MapRole.
+	trigger := &awsauth.Trigger{Kind: "MapRole", Name: req.Name}
 	awsauthSvc, err := awsauth.NewService(&awsauth.ServiceConfig{
-		KubeClient: kubeClient,
-		Log:        r.Log,
+		Backend:     r.Backend,
+		AuditSink:   r.AuditSink,
+		Trigger:     trigger,
+		Context:     ctx,
+		SizeMonitor: r.SizeMonitor,
+		Owner:       r.Owner,
+		KubeClient:  kubeClient,
+		Log:         r.Log,
 	})
 	if err != nil {
 		log.Error(err, "failure creating new aws auth service")
@@ -80,6 +164,17 @@ func (r *MapRoleReconciler) Reconcile(ctx context.Context, req ctrlruntime.Reque
 			return ctrlruntime.Result{}, err
 		}
 
+		// Remove the MapRole from every managed cluster, as the clusters it selected are no longer known.
+		if r.Hub != nil {
+			services, err := allHubClusterServices(ctx, r.Hub, r.AuditSink, trigger, r.Log)
+			if err == nil {
+				_, err = syncClusters(nil, services, nil, removeMapRole(mapRoleName))
+			}
+			if err != nil {
+				log.Error(err, "failure removing MapRole from managed clusters")
+			}
+		}
+
 		if err := awsauthSvc.RemoveMapRole(mapRoleName); err != nil {
 			log.Error(err, "error removing mapRole data in aws-auth configmap")
 			return ctrlruntime.Result{}, nil
@@ -88,21 +183,266 @@ func (r *MapRoleReconciler) Reconcile(ctx context.Context, req ctrlruntime.Reque
 		return ctrlruntime.Result{}, nil
 	}
 
+	// Leave the MapRole to the operator instance selecting it, releasing any entry this instance owns for it.
+	if !selects(r.Selector, &mapRole) {
+		if err := awsauthSvc.RemoveMapRole(mapRoleName); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing unselected MapRole data in aws-auth configmap")
+			return ctrlruntime.Result{}, err
+		}
+		log.Info("MapRole is not selected by this instance")
+		return ctrlruntime.Result{}, nil
+	}
+	trigger.Requester = requester(&mapRole)
+
+	statusChanged := false
+	now := time.Now()
+	window := evalAccessWindow(now, mapRole.Spec.NotBefore, mapRole.Spec.ExpiresAt, mapRole.Spec.Schedule)
+	// Remember the expiry before the checks below replace the window, so that an expired MapRole is deleted whatever else keeps it out of aws-auth.
+	deleteExpired := window.Reason == v1beta1.ReasonExpired && mapRole.Spec.DeleteOnExpiry
+	expiredMessage := window.Message
+	// Normalize the role ARN to the form the authenticator matches, keeping the MapRole out of aws-auth below if it is invalid.
+	roleARN, rewrite, arnErr := awsauth.NormalizeARN(awsauth.MapRoleData, mapRole.Spec.RoleARN)
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap until it has been approved, if required.
+	approved := r.Approval == nil
+	var approvalID string
+	if r.Approval != nil {
+		result, err := r.Approval.Check(ctx, approval.Mapping{
+			Kind:        "MapRole",
+			Name:        mapRole.Name,
+			ARN:         mapRole.Spec.RoleARN,
+			Groups:      mapRole.Spec.Groups,
+			RBAC:        mapRole.Spec.RBAC,
+			CreatedBy:   mapRole.Annotations[v1beta1.CreatedByAnnotation],
+			RequestedBy: mapRole.Annotations[v1beta1.RequestedByAnnotation],
+			Annotations: mapRole.Annotations,
+		})
+		if err != nil {
+			log.Error(err, "failure checking MapRole approval")
+			return ctrlruntime.Result{}, err
+		}
+		approved = result.Approved
+		approvalID = result.ID
+		if result.Approved {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionApproved, metav1.ConditionTrue, v1beta1.ReasonApproved, result.Message) || statusChanged
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionApproved, metav1.ConditionFalse, v1beta1.ReasonPendingApproval, result.Message) || statusChanged
+			window = accessWindow{Reason: v1beta1.ReasonPendingApproval, Message: result.Message}
+		}
+		if mapRole.Status.ApprovedBy != result.ApprovedBy {
+			mapRole.Status.ApprovedBy = result.ApprovedBy
+			statusChanged = true
+		}
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap if it assigns uncataloged groups, if required.
+	authGroups, unknownGroups, err := resolveAuthGroups(ctx, r.Client, mapRole.Spec.Groups)
+	if err != nil {
+		log.Error(err, "failure resolving MapRole AuthGroups")
+		return ctrlruntime.Result{}, err
+	}
+	statusChanged = setAuthGroups(&mapRole.Status.AuthGroups, authGroups) || statusChanged
+	if r.RequireCatalogedGroups {
+		if unknownGroups != "" {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionValid, metav1.ConditionFalse, v1beta1.ReasonUnknownGroups, unknownGroups) || statusChanged
+			window = accessWindow{Reason: v1beta1.ReasonUnknownGroups, Message: unknownGroups}
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionValid, metav1.ConditionTrue, v1beta1.ReasonGroupsCataloged, "all groups are cataloged") || statusChanged
+		}
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap unless its IAM principal is allowlisted, if restricted.
+	if r.Allowlist != nil {
+		if err := r.Allowlist.Check(mapRole.Spec.RoleARN, mapRole.Spec.Groups); err != nil {
+			if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionAllowed, metav1.ConditionFalse, v1beta1.ReasonPrincipalNotAllowed, err.Error()) {
+				r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, v1beta1.ReasonPrincipalNotAllowed, err.Error())
+				statusChanged = true
+			}
+			window = accessWindow{Reason: v1beta1.ReasonPrincipalNotAllowed, Message: err.Error()}
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionAllowed, metav1.ConditionTrue, v1beta1.ReasonPrincipalAllowed, "principal is allowed") || statusChanged
+		}
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap unless its IAM principal is the one it was approved for, if verified.
+	if r.Verifier != nil && arnErr == nil {
+		check, err := verifyPrincipal(ctx, r.Verifier, roleARN, mapRole.Status.Principal, approved, approvalID)
+		if err != nil {
+			log.Error(err, "failure verifying MapRole IAM principal")
+			return ctrlruntime.Result{}, err
+		}
+		statusChanged = setPrincipal(&mapRole.Status.Principal, check.Principal) || statusChanged
+		if check.Verified {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionVerified, metav1.ConditionTrue, check.Reason, check.Message) || statusChanged
+		} else {
+			if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionVerified, metav1.ConditionFalse, check.Reason, check.Message) {
+				r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, check.Reason, check.Message)
+				statusChanged = true
+			}
+			window = accessWindow{Reason: check.Reason, Message: check.Message}
+		}
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap if it loses a conflict with another mapping of its IAM principal or username.
+	groups := mapRole.Spec.Groups
+	if arnErr == nil {
+		parties, err := listConflictParties(ctx, r.Client)
+		if err != nil {
+			log.Error(err, "failure listing MapRole conflicts")
+			return ctrlruntime.Result{}, err
+		}
+		resolution := resolveConflicts(mapRoleParty(&mapRole), parties, r.ConflictPolicy)
+		if setConflictCondition(&mapRole.Status.Conditions, mapRole.Generation, resolution) {
+			if resolution.Conflicting() {
+				r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, resolution.Reason, resolution.Message)
+			}
+			statusChanged = true
+		}
+		if resolution.Rejected {
+			window = accessWindow{Reason: resolution.Reason, Message: resolution.Message}
+		} else {
+			groups = resolution.Groups
+		}
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap if its ARN is invalid.
+	if arnErr != nil {
+		window = accessWindow{Reason: v1beta1.ReasonInvalidARN, Message: arnErr.Error()}
+	}
+
+	// Sync the MapRole to the managed clusters it selects in hub mode, and to the local cluster otherwise.
+	selected, stale := []clusterService{{svc: awsauthSvc}}, []clusterService(nil)
+	hubMode := r.Hub != nil && mapRole.Spec.ClusterSelector != nil
+	requeueAfter := window.RequeueAfter
+	if r.Hub != nil && (hubMode || len(mapRole.Status.Clusters) > 0) {
+		hubSelected, hubStale, err := hubClusterServices(ctx, r.Hub, mapRole.Spec.ClusterSelector, mapRole.Status.Clusters, r.AuditSink, trigger, r.Log)
+		if err != nil {
+			log.Error(err, "failure listing MapRole managed clusters")
+			return ctrlruntime.Result{}, err
+		}
+		stale = hubStale
+		if hubMode {
+			// Remove the entry synced to the local cluster before the MapRole selected managed clusters.
+			selected, stale = hubSelected, append(stale, clusterService{svc: awsauthSvc})
+			requeueAfter = minRequeueAfter(requeueAfter, hubResyncPeriod)
+		}
+	}
+	if r.Verifier != nil {
+		requeueAfter = minRequeueAfter(requeueAfter, principalResyncPeriod)
+	}
+
+	// Keep the MapRole out of the kube-system:aws-auth ConfigMap outside of its access window.
+	statusChanged = setNextTransitionTime(&mapRole.Status.NextTransitionTime, window.NextTransitionTime(now)) || statusChanged
+	if !window.Active() {
+		statuses, err := syncClusters(selected, stale, removeMapRole(mapRole.Name), removeMapRole(mapRole.Name))
+		statusChanged = setClusterStatuses(&mapRole.Status.Clusters, statuses) || statusChanged
+		if err != nil {
+			log.Error(err, "error removing inactive MapRole from aws-auth")
+			if statusChanged {
+				if err := r.Status().Update(ctx, &mapRole); err != nil {
+					log.Error(err, "failure updating MapRole status")
+				}
+			}
+			return ctrlruntime.Result{}, err
+		}
+		if err := syncRBACBindings(ctx, r.Client, r.Scheme, "MapRole", &mapRole, nil, nil); err != nil {
+			log.Error(err, "failure removing inactive MapRole RBAC bindings")
+			return ctrlruntime.Result{}, err
+		}
+		if deleteExpired {
+			r.Recorder.Event(&mapRole, kcorev1.EventTypeNormal, "Deleted", expiredMessage)
+			if err := r.Delete(ctx, &mapRole); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "failure deleting expired MapRole")
+				return ctrlruntime.Result{}, err
+			}
+			log.Info("deleted expired MapRole")
+			return ctrlruntime.Result{}, nil
+		}
+		if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionActive, metav1.ConditionFalse, window.Reason, window.Message) {
+			r.Recorder.Event(&mapRole, kcorev1.EventTypeNormal, window.Reason, window.Message)
+			statusChanged = true
+		}
+		if statusChanged {
+			if err := r.Status().Update(ctx, &mapRole); err != nil {
+				log.Error(err, "failure updating MapRole status")
+				return ctrlruntime.Result{}, err
+			}
+		}
+		log.Info("MapRole is inactive", "reason", window.Reason)
+		return ctrlruntime.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	// Ensure that any changes are synced to the kube-system:aws-auth ConfigMap.
-	if err := awsauthSvc.UpsertMapRole(mapRole.Name, awsauth.MapRole{
-		RoleARN: mapRole.Spec.RoleARN,
-		Groups:  mapRole.Spec.Groups,
-	}); err != nil {
+	statuses, err := syncClusters(selected, stale, func(svc awsauth.Service) error {
+		return svc.UpsertMapRole(mapRole.Name, awsauth.MapRole{
+			RoleARN:        roleARN,
+			Groups:         groups,
+			AccessPolicies: accessPolicies(mapRole.Spec.AccessPolicies),
+		})
+	}, removeMapRole(mapRole.Name))
+	statusChanged = setClusterStatuses(&mapRole.Status.Clusters, statuses) || statusChanged
+	if err != nil {
 		log.Error(err, "error upserting MapRole in aws-auth")
+		reason := syncFailedReason(err)
+		if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionActive, metav1.ConditionFalse, reason, err.Error()) {
+			r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, reason, err.Error())
+			statusChanged = true
+		}
+		if statusChanged {
+			if err := r.Status().Update(ctx, &mapRole); err != nil {
+				log.Error(err, "failure updating MapRole status")
+			}
+		}
 		return ctrlruntime.Result{}, err
 	}
 	log.Info("upserted MapRole")
-	return ctrlruntime.Result{}, nil
+	if !hubMode {
+		statusChanged = setAuthMapHeadroom(&mapRole.Status.AuthMapHeadroom, r.SizeMonitor) || statusChanged
+	}
+
+	// Ensure that the RBAC bindings declared by the MapRole exist for its groups, in the local cluster only.
+	bindings, subjects := mapRole.Spec.RBAC, rbacSubjects(mapRole.Name, mapRole.Spec.Groups)
+	if hubMode {
+		bindings = nil
+	}
+	bindings, refusedErr := bindableRBAC(r.BindableClusterRoles, bindings)
+	if err := syncRBACBindings(ctx, r.Client, r.Scheme, "MapRole", &mapRole, bindings, subjects); err != nil {
+		log.Error(err, "failure syncing MapRole RBAC bindings")
+		r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, "RBACFailed", err.Error())
+		return ctrlruntime.Result{}, err
+	}
+	if refusedErr != nil {
+		log.Error(refusedErr, "refused MapRole RBAC bindings")
+		r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, "RBACFailed", refusedErr.Error())
+		return ctrlruntime.Result{}, refusedErr
+	}
+
+	if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionActive, metav1.ConditionTrue, v1beta1.ReasonSynced, syncedMessage(rewrite)) {
+		r.Recorder.Event(&mapRole, kcorev1.EventTypeNormal, v1beta1.ReasonSynced, syncedMessage(rewrite))
+		statusChanged = true
+	}
+	if statusChanged {
+		if err := r.Status().Update(ctx, &mapRole); err != nil {
+			log.Error(err, "failure updating MapRole status")
+			return ctrlruntime.Result{}, err
+		}
+	}
+	return ctrlruntime.Result{RequeueAfter: requeueAfter}, nil
 }
 
 // SetupWithManager sets up the controller with the Mapper.
 func (r *MapRoleReconciler) SetupWithManager(mgr ctrlruntime.Manager) error {
 	return ctrlruntime.NewControllerManagedBy(mgr).
-		For(&v1beta1.MapRole{}).
-		Complete(r)
+		For(&v1beta1.MapRole{}, builder.WithPredicates(selectorPredicate(r.Selector))).
+		Owns(&rbacv1.ClusterRoleBinding{}).
+		Owns(&rbacv1.RoleBinding{}).
+		Watches(&source.Kind{Type: &v1beta1.MapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "MapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.MapUser{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "MapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.NamespacedMapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "MapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.PermissionSetMapping{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "MapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.AccessApproval{}}, handler.EnqueueRequestsFromMapFunc(approvalRequests("MapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.AuthGroup{}}, handler.EnqueueRequestsFromMapFunc(listRequests(r.Client, func() ctrlclient.ObjectList {
+			return &v1beta1.MapRoleList{}
+		}))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r.Progress.Reconciler("MapRole", r))
 }
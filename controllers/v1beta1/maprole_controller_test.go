@@ -18,16 +18,29 @@ package v1beta1
 
 import (
 	"context"
+	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	kcorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	kscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/hub"
 )
 
 const (
@@ -110,3 +123,90 @@ var _ = Describe("MapRole controller", func() {
 		//})
 	})
 })
+
+func TestMapRoleReconciler_ClusterSelector(t *testing.T) {
+	g := NewWithT(t)
+	local, managed := kubefake.NewSimpleClientset(), kubefake.NewSimpleClientset()
+	useKubeClient(t, local)
+	_, err := awsauth.CreateAuthMap(local)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(kscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1beta1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&kcorev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "hub", Name: "prod", Labels: map[string]string{hub.ClusterLabel: "true", "env": "prod"}},
+			Data:       map[string][]byte{hub.KubeconfigKey: []byte("prod")},
+		},
+		&v1beta1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops"},
+			Spec:       v1beta1.MapRoleSpec{RoleARN: opsRoleARN, Groups: []string{"system:masters"}},
+		},
+	).Build()
+	reconciler := &MapRoleReconciler{
+		Client:   c,
+		Log:      ctrllog.Log,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Hub: &hub.Registry{
+			Reader:    c,
+			Namespace: "hub",
+			NewClient: func([]byte) (kubernetes.Interface, error) { return managed, nil },
+		},
+	}
+	reconcile := func() {
+		_, err := reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: types.NamespacedName{Name: "ops"}})
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	usernames := func(k kubernetes.Interface) []string {
+		authData, _, err := awsauth.ReadAuthMap(k)
+		g.Expect(err).NotTo(HaveOccurred())
+		var usernames []string
+		for _, entry := range authData.Entries() {
+			usernames = append(usernames, entry.Username)
+		}
+		return usernames
+	}
+
+	reconcile()
+	g.Expect(usernames(local)).To(Equal([]string{"ops"}))
+
+	// A MapRole gaining a cluster selector moves from the local cluster to the selected ones.
+	var mapRole v1beta1.MapRole
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Name: "ops"}, &mapRole)).To(Succeed())
+	mapRole.Spec.ClusterSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	g.Expect(c.Update(context.Background(), &mapRole)).To(Succeed())
+	reconcile()
+	g.Expect(usernames(local)).To(BeEmpty())
+	g.Expect(usernames(managed)).To(Equal([]string{"ops"}))
+}
+
+func TestMapRoleReconciler_DeleteOnExpiry(t *testing.T) {
+	g := NewWithT(t)
+	k := kubefake.NewSimpleClientset()
+	useKubeClient(t, k)
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(kscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1beta1.AddToScheme(scheme)).To(Succeed())
+	expiresAt := metav1.NewTime(time.Now().Add(-time.Hour))
+	// The MapRole expired while still waiting for approval.
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1beta1.MapRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", Annotations: map[string]string{v1beta1.CreatedByAnnotation: "alice"}},
+		Spec:       v1beta1.MapRoleSpec{RoleARN: opsRoleARN, Groups: []string{"system:masters"}, ExpiresAt: &expiresAt, DeleteOnExpiry: true},
+	}).Build()
+	reconciler := &MapRoleReconciler{
+		Client:   c,
+		Log:      ctrllog.Log,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Approval: &approval.Checker{Reader: c, TrustApprovalObjects: true},
+	}
+	_, err = reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: types.NamespacedName{Name: "ops"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	err = c.Get(context.Background(), types.NamespacedName{Name: "ops"}, &v1beta1.MapRole{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "%v", err)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"path"
+	"strings"
+
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// disallowedGroups returns the groups not allowed for the namespace by any of
+// the policies selecting it.
+func disallowedGroups(namespace *kcorev1.Namespace, policies []v1beta1.NamespaceMappingPolicy, groups []string) ([]string, error) {
+	var patterns []string
+	for _, policy := range policies {
+		selector := labels.Everything()
+		if policy.Spec.NamespaceSelector != nil {
+			var err error
+			if selector, err = metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector); err != nil {
+				return nil, err
+			}
+		}
+		if !selector.Matches(labels.Set(namespace.Labels)) {
+			continue
+		}
+		for _, pattern := range policy.Spec.AllowedGroups {
+			patterns = append(patterns, strings.ReplaceAll(pattern, v1beta1.NamespacePlaceholder, namespace.Name))
+		}
+	}
+
+	var disallowed []string
+	for _, group := range groups {
+		if !matchesAny(patterns, group) {
+			disallowed = append(disallowed, group)
+		}
+	}
+	return disallowed, nil
+}
+
+func matchesAny(patterns []string, group string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, group); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestDisallowedGroups(t *testing.T) {
+	g := gomega.NewWithT(t)
+	namespace := &kcorev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"tier": "prod"}},
+	}
+	policies := []v1beta1.NamespaceMappingPolicy{
+		{Spec: v1beta1.NamespaceMappingPolicySpec{AllowedGroups: []string{"{namespace}:*"}}},
+		{Spec: v1beta1.NamespaceMappingPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "dev"}},
+			AllowedGroups:     []string{"system:masters"},
+		}},
+	}
+
+	disallowed, err := disallowedGroups(namespace, policies, []string{"payments:viewers", "payments:editors"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(disallowed).To(gomega.BeEmpty())
+
+	disallowed, err = disallowedGroups(namespace, policies, []string{"payments:viewers", "billing:viewers", "system:masters"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(disallowed).To(gomega.Equal([]string{"billing:viewers", "system:masters"}))
+
+	namespace.Labels["tier"] = "dev"
+	disallowed, err = disallowedGroups(namespace, policies, []string{"system:masters"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(disallowed).To(gomega.BeEmpty())
+
+	disallowed, err = disallowedGroups(namespace, nil, []string{"payments:viewers"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(disallowed).To(gomega.Equal([]string{"payments:viewers"}))
+}
@@ -0,0 +1,402 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	kcorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/sambatv/aws-auth-operator/allowlist"
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/health"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+// NamespacedMapRoleReconciler reconciles a NamespacedMapRole object
+type NamespacedMapRoleReconciler struct {
+	ctrlclient.Client
+	Log      logr.Logger
+	Scheme   *pkgruntime.Scheme
+	Recorder record.EventRecorder
+
+	// Approval, if set, keeps NamespacedMapRole objects out of aws-auth until
+	// approved.
+	Approval *approval.Checker
+
+	// Backend stores the mappings of the local cluster, defaulting to its
+	// aws-auth ConfigMap.
+	Backend awsauth.Backend
+
+	// AuditSink, if set, receives a record of each change made to aws-auth.
+	AuditSink awsauth.AuditSink
+
+	// SizeMonitor, if set, tracks the size of the local aws-auth ConfigMap.
+	SizeMonitor *awsauth.SizeMonitor
+
+	// Selector, if set, limits the objects reconciled by this operator
+	// instance, leaving the others to the instances selecting them.
+	Selector labels.Selector
+
+	// Owner, if set, is the operator instance owning the aws-auth entries of
+	// the selected objects, which only removes the entries it owns.
+	Owner string
+
+	// Progress, if set, tracks the reconciles in flight for the liveness check.
+	Progress *health.Progress
+
+	// MaxConcurrentReconciles is the number of objects reconciled at once,
+	// defaulting to one.
+	MaxConcurrentReconciles int
+
+	// RequireCatalogedGroups keeps NamespacedMapRole objects assigning groups
+	// not cataloged by an AuthGroup out of aws-auth.
+	RequireCatalogedGroups bool
+
+	// Allowlist, if set, keeps NamespacedMapRole objects out of aws-auth
+	// unless their IAM role is in an allowed AWS partition and account.
+	Allowlist *allowlist.Allowlist
+
+	// Verifier, if set, keeps NamespacedMapRole objects out of aws-auth unless
+	// their IAM role exists with the unique ID it had when they were approved.
+	Verifier principal.Verifier
+
+	// ConflictPolicy decides which of the NamespacedMapRole and the mappings it
+	// conflicts with is written to aws-auth, defaulting to RejectNewerPolicy.
+	ConflictPolicy ConflictPolicy
+}
+
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=namespacedmaproles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=namespacedmaproles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=namespacedmaproles/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=namespacemappingpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=authgroups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=accessapprovals,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
+func (r *NamespacedMapRoleReconciler) Reconcile(ctx context.Context, req ctrlruntime.Request) (ctrlruntime.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "NamespacedMapRole", req)
+	defer span.End()
+
+	// NamespacedMapRole objects are keyed in aws-auth by their namespaced username.
+	username := v1beta1.NamespacedUsername(req.Namespace, req.Name)
+	log := r.Log.WithValues("NamespacedMapRole", req.NamespacedName)
+	log.Info("reconciling NamespacedMapRole...")
+
+	kubeClient, err := getKubeClient(ctx)
+	if err != nil {
+		log.Error(err, "failure getting kube client")
+		return ctrlruntime.Result{}, err
+	}
+
+	// Get a new aws auth service object, attributing its changes to the NamespacedMapRole.
+	trigger := &awsauth.Trigger{Kind: "NamespacedMapRole", Namespace: req.Namespace, Name: req.Name}
+	awsauthSvc, err := awsauth.NewService(&awsauth.ServiceConfig{
+		Backend:     r.Backend,
+		AuditSink:   r.AuditSink,
+		Trigger:     trigger,
+		Context:     ctx,
+		SizeMonitor: r.SizeMonitor,
+		Owner:       r.Owner,
+		KubeClient:  kubeClient,
+		Log:         r.Log,
+	})
+	if err != nil {
+		log.Error(err, "failure creating new aws auth service")
+		return ctrlruntime.Result{}, err
+	}
+
+	// Load the NamespacedMapRole object by namespace and name.
+	var mapRole v1beta1.NamespacedMapRole
+	if err := r.Get(ctx, req.NamespacedName, &mapRole); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "failure getting NamespacedMapRole")
+			return ctrlruntime.Result{}, err
+		}
+
+		if err := awsauthSvc.RemoveMapRole(username); err != nil {
+			log.Error(err, "failure removing NamespacedMapRole data in aws-auth configmap")
+			return ctrlruntime.Result{}, nil
+		}
+		log.Info("removed NamespacedMapRole data in aws-auth configmap")
+		return ctrlruntime.Result{}, nil
+	}
+
+	// Leave the NamespacedMapRole to the operator instance selecting it, releasing any entry this instance owns for it.
+	if !selects(r.Selector, &mapRole) {
+		if err := awsauthSvc.RemoveMapRole(username); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing unselected NamespacedMapRole data in aws-auth configmap")
+			return ctrlruntime.Result{}, err
+		}
+		log.Info("NamespacedMapRole is not selected by this instance")
+		return ctrlruntime.Result{}, nil
+	}
+	trigger.Requester = requester(&mapRole)
+	statusChanged := false
+
+	// Remove the entry written under a former username, such as the
+	// unprefixed "<namespace>:<name>".
+	if mapRole.Status.Username != "" && mapRole.Status.Username != username {
+		if err := awsauthSvc.RemoveMapRole(mapRole.Status.Username); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing former NamespacedMapRole username from aws-auth", "username", mapRole.Status.Username)
+			return ctrlruntime.Result{}, err
+		}
+	}
+	if mapRole.Status.Username != username {
+		mapRole.Status.Username = username
+		statusChanged = true
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth if it assigns groups not allowed for its namespace.
+	var namespace kcorev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: req.Namespace}, &namespace); err != nil {
+		log.Error(err, "failure getting NamespacedMapRole namespace")
+		return ctrlruntime.Result{}, err
+	}
+	var policies v1beta1.NamespaceMappingPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		log.Error(err, "failure listing NamespaceMappingPolicies")
+		return ctrlruntime.Result{}, err
+	}
+	disallowed, err := disallowedGroups(&namespace, policies.Items, mapRole.Spec.Groups)
+	if err != nil {
+		log.Error(err, "failure evaluating NamespaceMappingPolicies")
+		return ctrlruntime.Result{}, err
+	}
+	reason, message := "", ""
+	if len(disallowed) > 0 {
+		reason = v1beta1.ReasonPolicyViolation
+		message = fmt.Sprintf("groups not allowed in namespace %s: %s", req.Namespace, strings.Join(disallowed, ", "))
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth until it has been approved, if required.
+	approved := r.Approval == nil
+	var approvalID string
+	if r.Approval != nil {
+		result, err := r.Approval.Check(ctx, approval.Mapping{
+			Kind:        "NamespacedMapRole",
+			Namespace:   mapRole.Namespace,
+			Name:        mapRole.Name,
+			ARN:         mapRole.Spec.RoleARN,
+			Groups:      mapRole.Spec.Groups,
+			CreatedBy:   mapRole.Annotations[v1beta1.CreatedByAnnotation],
+			RequestedBy: mapRole.Annotations[v1beta1.RequestedByAnnotation],
+			Annotations: mapRole.Annotations,
+		})
+		if err != nil {
+			log.Error(err, "failure checking NamespacedMapRole approval")
+			return ctrlruntime.Result{}, err
+		}
+		approved = result.Approved
+		approvalID = result.ID
+		if result.Approved {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionApproved, metav1.ConditionTrue, v1beta1.ReasonApproved, result.Message) || statusChanged
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionApproved, metav1.ConditionFalse, v1beta1.ReasonPendingApproval, result.Message) || statusChanged
+			if reason == "" {
+				reason, message = v1beta1.ReasonPendingApproval, result.Message
+			}
+		}
+		if mapRole.Status.ApprovedBy != result.ApprovedBy {
+			mapRole.Status.ApprovedBy = result.ApprovedBy
+			statusChanged = true
+		}
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth if it assigns uncataloged groups, if required.
+	authGroups, unknownGroups, err := resolveAuthGroups(ctx, r.Client, mapRole.Spec.Groups)
+	if err != nil {
+		log.Error(err, "failure resolving NamespacedMapRole AuthGroups")
+		return ctrlruntime.Result{}, err
+	}
+	statusChanged = setAuthGroups(&mapRole.Status.AuthGroups, authGroups) || statusChanged
+	if r.RequireCatalogedGroups {
+		if unknownGroups != "" {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionValid, metav1.ConditionFalse, v1beta1.ReasonUnknownGroups, unknownGroups) || statusChanged
+			if reason == "" {
+				reason, message = v1beta1.ReasonUnknownGroups, unknownGroups
+			}
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionValid, metav1.ConditionTrue, v1beta1.ReasonGroupsCataloged, "all groups are cataloged") || statusChanged
+		}
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth if its IAM role is not allowlisted, if restricted.
+	if r.Allowlist != nil {
+		if err := r.Allowlist.Check(mapRole.Spec.RoleARN, mapRole.Spec.Groups); err != nil {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionAllowed, metav1.ConditionFalse, v1beta1.ReasonPrincipalNotAllowed, err.Error()) || statusChanged
+			if reason == "" {
+				reason, message = v1beta1.ReasonPrincipalNotAllowed, err.Error()
+			}
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionAllowed, metav1.ConditionTrue, v1beta1.ReasonPrincipalAllowed, "principal is allowed") || statusChanged
+		}
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth if its role ARN is invalid.
+	roleARN, rewrite, arnErr := awsauth.NormalizeARN(awsauth.MapRoleData, mapRole.Spec.RoleARN)
+	if arnErr != nil {
+		reason, message = v1beta1.ReasonInvalidARN, arnErr.Error()
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth unless its IAM role is the one it was approved for, if verified.
+	var requeueAfter time.Duration
+	if r.Verifier != nil && arnErr == nil {
+		check, err := verifyPrincipal(ctx, r.Verifier, roleARN, mapRole.Status.Principal, approved, approvalID)
+		if err != nil {
+			log.Error(err, "failure verifying NamespacedMapRole IAM principal")
+			return ctrlruntime.Result{}, err
+		}
+		statusChanged = setPrincipal(&mapRole.Status.Principal, check.Principal) || statusChanged
+		if check.Verified {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionVerified, metav1.ConditionTrue, check.Reason, check.Message) || statusChanged
+		} else {
+			statusChanged = setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionVerified, metav1.ConditionFalse, check.Reason, check.Message) || statusChanged
+			if reason == "" {
+				reason, message = check.Reason, check.Message
+			}
+		}
+		requeueAfter = principalResyncPeriod
+	}
+
+	// Keep the NamespacedMapRole out of aws-auth if it loses a conflict with another mapping of its IAM role or username.
+	groups := mapRole.Spec.Groups
+	if arnErr == nil {
+		parties, err := listConflictParties(ctx, r.Client)
+		if err != nil {
+			log.Error(err, "failure listing NamespacedMapRole conflicts")
+			return ctrlruntime.Result{}, err
+		}
+		resolution := resolveConflicts(namespacedMapRoleParty(&mapRole), parties, r.ConflictPolicy)
+		statusChanged = setConflictCondition(&mapRole.Status.Conditions, mapRole.Generation, resolution) || statusChanged
+		if resolution.Rejected {
+			if reason == "" {
+				reason, message = resolution.Reason, resolution.Message
+			}
+		} else {
+			groups = resolution.Groups
+		}
+	}
+
+	if reason != "" {
+		if err := awsauthSvc.RemoveMapRole(username); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing invalid NamespacedMapRole from aws-auth")
+			return ctrlruntime.Result{}, err
+		}
+		if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionActive, metav1.ConditionFalse, reason, message) {
+			r.Recorder.Event(&mapRole, kcorev1.EventTypeWarning, reason, message)
+			statusChanged = true
+		}
+		if statusChanged {
+			if err := r.Status().Update(ctx, &mapRole); err != nil {
+				log.Error(err, "failure updating NamespacedMapRole status")
+				return ctrlruntime.Result{}, err
+			}
+		}
+		log.Info("NamespacedMapRole is invalid", "reason", reason)
+		return ctrlruntime.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// Ensure that any changes are synced to the kube-system:aws-auth ConfigMap.
+	if err := awsauthSvc.UpsertMapRole(username, awsauth.MapRole{
+		RoleARN: roleARN,
+		Groups:  groups,
+	}); err != nil {
+		log.Error(err, "failure upserting NamespacedMapRole")
+		return ctrlruntime.Result{}, err
+	}
+	log.Info("upserted NamespacedMapRole")
+
+	if setCondition(&mapRole.Status.Conditions, mapRole.Generation, v1beta1.ConditionActive, metav1.ConditionTrue, v1beta1.ReasonSynced, syncedMessage(rewrite)) {
+		r.Recorder.Event(&mapRole, kcorev1.EventTypeNormal, v1beta1.ReasonSynced, syncedMessage(rewrite))
+		statusChanged = true
+	}
+	if statusChanged {
+		if err := r.Status().Update(ctx, &mapRole); err != nil {
+			log.Error(err, "failure updating NamespacedMapRole status")
+			return ctrlruntime.Result{}, err
+		}
+	}
+	return ctrlruntime.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// SetupWithManager sets up the controller with the Mapper.
+func (r *NamespacedMapRoleReconciler) SetupWithManager(mgr ctrlruntime.Manager) error {
+	return ctrlruntime.NewControllerManagedBy(mgr).
+		For(&v1beta1.NamespacedMapRole{}, builder.WithPredicates(selectorPredicate(r.Selector))).
+		Watches(&source.Kind{Type: &v1beta1.NamespaceMappingPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.allRequests)).
+		Watches(&source.Kind{Type: &v1beta1.AuthGroup{}}, handler.EnqueueRequestsFromMapFunc(r.allRequests)).
+		Watches(&source.Kind{Type: &v1beta1.AccessApproval{}}, handler.EnqueueRequestsFromMapFunc(approvalRequests("NamespacedMapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.MapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "NamespacedMapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.MapUser{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "NamespacedMapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.NamespacedMapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "NamespacedMapRole"))).
+		Watches(&source.Kind{Type: &v1beta1.PermissionSetMapping{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "NamespacedMapRole"))).
+		Watches(&source.Kind{Type: &kcorev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.namespaceRequests)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r.Progress.Reconciler("NamespacedMapRole", r))
+}
+
+// allRequests enqueues every NamespacedMapRole, as a policy or catalog change
+// may affect any of them.
+func (r *NamespacedMapRoleReconciler) allRequests(_ ctrlclient.Object) []reconcile.Request {
+	return r.listRequests()
+}
+
+// namespaceRequests enqueues the NamespacedMapRoles in a namespace, as a
+// change to its labels may change the policies selecting it.
+func (r *NamespacedMapRoleReconciler) namespaceRequests(obj ctrlclient.Object) []reconcile.Request {
+	return r.listRequests(ctrlclient.InNamespace(obj.GetName()))
+}
+
+func (r *NamespacedMapRoleReconciler) listRequests(opts ...ctrlclient.ListOption) []reconcile.Request {
+	var mapRoles v1beta1.NamespacedMapRoleList
+	if err := r.List(context.Background(), &mapRoles, opts...); err != nil {
+		r.Log.Error(err, "failure listing NamespacedMapRoles")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(mapRoles.Items))
+	for _, mapRole := range mapRoles.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: mapRole.Namespace,
+			Name:      mapRole.Name,
+		}})
+	}
+	return requests
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	kmetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	kscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/kube"
+)
+
+const (
+	NamespacedMapRoleNamespace = "default"
+	NamespacedMapRoleKind      = "NamespacedMapRole"
+	NamespacedMapRoleName      = "test-namespaced-role"
+	NamespacedMapRoleARN       = "arn:aws:iam::123456789012:role/test-namespaced-role"
+)
+
+var _ = Describe("NamespacedMapRole controller", func() {
+	Context("When managing NamespacedMapRole objects", func() {
+		It("Should add the NamespacedMapRole", func() {
+			By("Creating a new NamespacedMapRole with a Role ARN")
+			ctx := context.Background()
+			mapRole := &v1beta1.NamespacedMapRole{
+				TypeMeta: kmetav1.TypeMeta{
+					APIVersion: APIVersion,
+					Kind:       NamespacedMapRoleKind,
+				},
+				ObjectMeta: kmetav1.ObjectMeta{
+					Name:      NamespacedMapRoleName,
+					Namespace: NamespacedMapRoleNamespace,
+				},
+				Spec: v1beta1.NamespacedMapRoleSpec{
+					Groups:  []string{"default:viewers"},
+					RoleARN: NamespacedMapRoleARN,
+				},
+			}
+			Expect(k8sClient.Create(ctx, mapRole)).Should(Succeed())
+
+			lookupKey := ktypes.NamespacedName{Name: NamespacedMapRoleName, Namespace: NamespacedMapRoleNamespace}
+			created := &v1beta1.NamespacedMapRole{}
+
+			// We'll need to retry getting this newly created NamespacedMapRole, given that creation may not immediately happen.
+			Eventually(func() bool {
+				return k8sClient.Get(ctx, lookupKey, created) == nil
+			}, timeout, interval).Should(BeTrue())
+			Expect(created.Spec.RoleARN).Should(Equal(NamespacedMapRoleARN))
+			Expect(created.Username()).Should(Equal("namespace:default:" + NamespacedMapRoleName))
+		})
+	})
+})
+
+// useKubeClient makes reconcilers use k as the client of the local cluster
+// until the test ends.
+func useKubeClient(t *testing.T, k kubernetes.Interface) {
+	newKubeClient = func() (kubernetes.Interface, error) { return k, nil }
+	t.Cleanup(func() { newKubeClient = kube.GetClient })
+}
+
+func TestNamespacedMapRoleReconciler_FormerUsername(t *testing.T) {
+	g := NewWithT(t)
+	k := kubefake.NewSimpleClientset()
+	useKubeClient(t, k)
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(HaveOccurred())
+	authData, cm, err := awsauth.ReadAuthMap(k)
+	g.Expect(err).NotTo(HaveOccurred())
+	authData.SetMapRoles([]*awsauth.MapRole{
+		awsauth.NewMapRole(devRoleARN, "team-a:dev", []string{"team-a-devs"}),
+		awsauth.NewMapRole(opsRoleARN, "permission-set:admins", []string{"system:masters"}),
+	})
+	g.Expect(awsauth.UpdateAuthMap(k, authData, cm)).To(Succeed())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(kscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1beta1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&kcorev1.Namespace{ObjectMeta: kmetav1.ObjectMeta{Name: "team-a"}},
+		&kcorev1.Namespace{ObjectMeta: kmetav1.ObjectMeta{Name: "permission-set"}},
+		&v1beta1.NamespaceMappingPolicy{
+			ObjectMeta: kmetav1.ObjectMeta{Name: "teams"},
+			Spec:       v1beta1.NamespaceMappingPolicySpec{AllowedGroups: []string{v1beta1.NamespacePlaceholder + "-devs"}},
+		},
+		// Written before usernames were prefixed.
+		&v1beta1.NamespacedMapRole{
+			ObjectMeta: kmetav1.ObjectMeta{Namespace: "team-a", Name: "dev"},
+			Spec:       v1beta1.NamespacedMapRoleSpec{RoleARN: devRoleARN, Groups: []string{"team-a-devs"}},
+			Status:     v1beta1.NamespacedMapRoleStatus{Username: "team-a:dev"},
+		},
+		// Would have been mapped as the PermissionSetMapping admins.
+		&v1beta1.NamespacedMapRole{
+			ObjectMeta: kmetav1.ObjectMeta{Namespace: "permission-set", Name: "admins"},
+			Spec:       v1beta1.NamespacedMapRoleSpec{RoleARN: legacyRoleARN, Groups: []string{"permission-set-devs"}},
+		},
+	).Build()
+	reconciler := &NamespacedMapRoleReconciler{Client: c, Log: ctrllog.Log, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+	for _, key := range []ktypes.NamespacedName{{Namespace: "team-a", Name: "dev"}, {Namespace: "permission-set", Name: "admins"}} {
+		_, err := reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: key})
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	authData, _, err = awsauth.ReadAuthMap(k)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(authData.Entries()).To(ConsistOf(
+		awsauth.Entry{DataType: awsauth.MapRoleData, Username: "namespace:team-a:dev", ARN: devRoleARN, Groups: []string{"team-a-devs"}},
+		awsauth.Entry{DataType: awsauth.MapRoleData, Username: "namespace:permission-set:admins", ARN: legacyRoleARN, Groups: []string{"permission-set-devs"}},
+		awsauth.Entry{DataType: awsauth.MapRoleData, Username: "permission-set:admins", ARN: opsRoleARN, Groups: []string{"system:masters"}},
+	))
+
+	var mapRole v1beta1.NamespacedMapRole
+	g.Expect(c.Get(context.Background(), ktypes.NamespacedName{Namespace: "team-a", Name: "dev"}, &mapRole)).To(Succeed())
+	g.Expect(mapRole.Status.Username).To(Equal("namespace:team-a:dev"))
+}
+
+func TestNamespacedMapRoleReconciler_Approval(t *testing.T) {
+	g := NewWithT(t)
+	k := kubefake.NewSimpleClientset()
+	useKubeClient(t, k)
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(kscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(v1beta1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&kcorev1.Namespace{ObjectMeta: kmetav1.ObjectMeta{Name: "team-a"}},
+		&v1beta1.NamespaceMappingPolicy{
+			ObjectMeta: kmetav1.ObjectMeta{Name: "teams"},
+			Spec:       v1beta1.NamespaceMappingPolicySpec{AllowedGroups: []string{v1beta1.NamespacePlaceholder + "-devs"}},
+		},
+		&v1beta1.NamespacedMapRole{
+			ObjectMeta: kmetav1.ObjectMeta{Namespace: "team-a", Name: "dev", Annotations: map[string]string{
+				v1beta1.CreatedByAnnotation:   "alice",
+				v1beta1.RequestedByAnnotation: "alice",
+			}},
+			Spec: v1beta1.NamespacedMapRoleSpec{RoleARN: devRoleARN, Groups: []string{"team-a-devs"}},
+		},
+		// Approves a NamespacedMapRole of the same name in another namespace.
+		&v1beta1.AccessApproval{
+			ObjectMeta: kmetav1.ObjectMeta{Name: "team-b-dev", Annotations: map[string]string{v1beta1.RequestedByAnnotation: "bob"}},
+			Spec:       v1beta1.AccessApprovalSpec{Kind: "NamespacedMapRole", Namespace: "team-b", Name: "dev", ARN: devRoleARN, Groups: []string{"team-a-devs"}},
+		},
+	).Build()
+	reconciler := &NamespacedMapRoleReconciler{
+		Client:   c,
+		Log:      ctrllog.Log,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Approval: &approval.Checker{Reader: c, TrustApprovalObjects: true},
+	}
+	reconcile := func() []awsauth.Entry {
+		_, err := reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: ktypes.NamespacedName{Namespace: "team-a", Name: "dev"}})
+		g.Expect(err).NotTo(HaveOccurred())
+		authData, _, err := awsauth.ReadAuthMap(k)
+		g.Expect(err).NotTo(HaveOccurred())
+		return authData.Entries()
+	}
+
+	g.Expect(reconcile()).To(BeEmpty())
+	var mapRole v1beta1.NamespacedMapRole
+	g.Expect(c.Get(context.Background(), ktypes.NamespacedName{Namespace: "team-a", Name: "dev"}, &mapRole)).To(Succeed())
+	g.Expect(meta.IsStatusConditionFalse(mapRole.Status.Conditions, v1beta1.ConditionApproved)).To(BeTrue())
+
+	g.Expect(c.Create(context.Background(), &v1beta1.AccessApproval{
+		ObjectMeta: kmetav1.ObjectMeta{Name: "team-a-dev", Annotations: map[string]string{v1beta1.RequestedByAnnotation: "bob"}},
+		Spec:       v1beta1.AccessApprovalSpec{Kind: "NamespacedMapRole", Namespace: "team-a", Name: "dev", ARN: devRoleARN, Groups: []string{"team-a-devs"}},
+	})).To(Succeed())
+	g.Expect(reconcile()).To(ConsistOf(
+		awsauth.Entry{DataType: awsauth.MapRoleData, Username: "namespace:team-a:dev", ARN: devRoleARN, Groups: []string{"team-a-devs"}},
+	))
+	g.Expect(c.Get(context.Background(), ktypes.NamespacedName{Namespace: "team-a", Name: "dev"}, &mapRole)).To(Succeed())
+	g.Expect(mapRole.Status.ApprovedBy).To(Equal("bob"))
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+// permissionSetResyncPeriod is how often the roles of permission sets are
+// resolved again, following permission sets as they are reprovisioned.
+const permissionSetResyncPeriod = 10 * time.Minute
+
+// resolvePermissionSetRole returns the path-stripped ARN of the role currently
+// provisioned for the permission set of a PermissionSetMapping, or the reason
+// and message it could not be resolved for.
+func resolvePermissionSetRole(ctx context.Context, resolver principal.PermissionSetResolver, spec *v1beta1.PermissionSetMappingSpec) (string, string, string, error) {
+	roleARN, err := resolver.PermissionSetRoleARN(ctx, spec.AccountID, spec.PermissionSetName)
+	if errors.Is(err, principal.ErrNotFound) {
+		return "", v1beta1.ReasonPermissionSetNotFound, err.Error(), nil
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	normalized, _, err := awsauth.NormalizeARN(awsauth.MapRoleData, roleARN)
+	if err != nil {
+		return "", v1beta1.ReasonInvalidARN, err.Error(), nil
+	}
+	return normalized, "", "", nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+func TestResolvePermissionSetRole(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	spec := &v1beta1.PermissionSetMappingSpec{AccountID: "123456789012", PermissionSetName: "AdministratorAccess"}
+	resolver := principal.StaticRoles{
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_AdministratorAccess_0123456789abcdef",
+	}
+
+	roleARN, reason, _, err := resolvePermissionSetRole(ctx, resolver, spec)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(reason).To(gomega.BeEmpty())
+	g.Expect(roleARN).To(gomega.Equal("arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_0123456789abcdef"))
+
+	// A reprovisioned permission set is followed to its new role.
+	resolver[0] = "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_AdministratorAccess_fedcba9876543210"
+	roleARN, _, _, err = resolvePermissionSetRole(ctx, resolver, spec)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(roleARN).To(gomega.Equal("arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_fedcba9876543210"))
+
+	spec.PermissionSetName = "ReadOnly"
+	roleARN, reason, message, err := resolvePermissionSetRole(ctx, resolver, spec)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(roleARN).To(gomega.BeEmpty())
+	g.Expect(reason).To(gomega.Equal(v1beta1.ReasonPermissionSetNotFound))
+	g.Expect(message).To(gomega.ContainSubstring("no role provisioned for permission set ReadOnly in account 123456789012"))
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	kcorev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/sambatv/aws-auth-operator/allowlist"
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/health"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+// PermissionSetMappingReconciler reconciles a PermissionSetMapping object
+type PermissionSetMappingReconciler struct {
+	ctrlclient.Client
+	Log      logr.Logger
+	Scheme   *pkgruntime.Scheme
+	Recorder record.EventRecorder
+
+	// Approval, if set, keeps PermissionSetMapping objects out of aws-auth
+	// until the role currently provisioned for their permission set is
+	// approved.
+	Approval *approval.Checker
+
+	// RequireCatalogedGroups keeps PermissionSetMapping objects assigning
+	// groups not cataloged by an AuthGroup out of aws-auth.
+	RequireCatalogedGroups bool
+
+	// Backend stores the mappings of the local cluster, defaulting to its
+	// aws-auth ConfigMap.
+	Backend awsauth.Backend
+
+	// AuditSink, if set, receives a record of each change made to aws-auth.
+	AuditSink awsauth.AuditSink
+
+	// SizeMonitor, if set, tracks the size of the local aws-auth ConfigMap.
+	SizeMonitor *awsauth.SizeMonitor
+
+	// Selector, if set, limits the objects reconciled by this operator
+	// instance, leaving the others to the instances selecting them.
+	Selector labels.Selector
+
+	// Owner, if set, is the operator instance owning the aws-auth entries of
+	// the selected objects, which only removes the entries it owns.
+	Owner string
+
+	// Progress, if set, tracks the reconciles in flight for the liveness check.
+	Progress *health.Progress
+
+	// MaxConcurrentReconciles is the number of objects reconciled at once,
+	// defaulting to one.
+	MaxConcurrentReconciles int
+
+	// Resolver looks up the roles provisioned for permission sets.
+	Resolver principal.PermissionSetResolver
+
+	// Allowlist, if set, keeps PermissionSetMapping objects out of aws-auth
+	// unless their role is in an allowed AWS partition and account.
+	Allowlist *allowlist.Allowlist
+
+	// Verifier, if set, keeps PermissionSetMapping objects out of aws-auth
+	// unless their role exists with the unique ID it had when they were
+	// approved.
+	Verifier principal.Verifier
+
+	// ConflictPolicy decides which of the PermissionSetMapping and the mappings
+	// it conflicts with is written to aws-auth, defaulting to RejectNewerPolicy.
+	ConflictPolicy ConflictPolicy
+}
+
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=permissionsetmappings,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=permissionsetmappings/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=permissionsetmappings/finalizers,verbs=update
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=accessapprovals,verbs=get;list;watch
+//+kubebuilder:rbac:groups=aws-auth.samba.tv,resources=authgroups,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
+func (r *PermissionSetMappingReconciler) Reconcile(ctx context.Context, req ctrlruntime.Request) (ctrlruntime.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "PermissionSetMapping", req)
+	defer span.End()
+
+	log := r.Log.WithValues("PermissionSetMapping", req.Name)
+	log.Info("reconciling PermissionSetMapping...")
+
+	kubeClient, err := getKubeClient(ctx)
+	if err != nil {
+		log.Error(err, "failure getting kube client")
+		return ctrlruntime.Result{}, err
+	}
+
+	// Get a new aws auth service object, attributing its changes to the PermissionSetMapping.
+	trigger := &awsauth.Trigger{Kind: "PermissionSetMapping", Name: req.Name}
+	awsauthSvc, err := awsauth.NewService(&awsauth.ServiceConfig{
+		Backend:     r.Backend,
+		AuditSink:   r.AuditSink,
+		Trigger:     trigger,
+		Context:     ctx,
+		SizeMonitor: r.SizeMonitor,
+		Owner:       r.Owner,
+		KubeClient:  kubeClient,
+		Log:         r.Log,
+	})
+	if err != nil {
+		log.Error(err, "failure creating new aws auth service")
+		return ctrlruntime.Result{}, err
+	}
+
+	// Load the PermissionSetMapping object by name.
+	var mapping v1beta1.PermissionSetMapping
+	if err := r.Get(ctx, req.NamespacedName, &mapping); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "failure getting PermissionSetMapping")
+			return ctrlruntime.Result{}, err
+		}
+
+		mapping.Name = req.Name
+		if err := awsauthSvc.RemoveMapRole(mapping.Username()); err != nil {
+			log.Error(err, "failure removing PermissionSetMapping data in aws-auth configmap")
+			return ctrlruntime.Result{}, nil
+		}
+		log.Info("removed PermissionSetMapping data in aws-auth configmap")
+		return ctrlruntime.Result{}, nil
+	}
+
+	// Leave the PermissionSetMapping to the operator instance selecting it, releasing any entry this instance owns for it.
+	if !selects(r.Selector, &mapping) {
+		if err := awsauthSvc.RemoveMapRole(mapping.Username()); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing unselected PermissionSetMapping data in aws-auth configmap")
+			return ctrlruntime.Result{}, err
+		}
+		log.Info("PermissionSetMapping is not selected by this instance")
+		return ctrlruntime.Result{}, nil
+	}
+	trigger.Requester = requester(&mapping)
+	username := mapping.Username()
+	statusChanged := false
+	if mapping.Status.Username != username {
+		mapping.Status.Username = username
+		statusChanged = true
+	}
+
+	// Resolve the role currently provisioned for the permission set.
+	roleARN, reason, message, err := resolvePermissionSetRole(ctx, r.Resolver, &mapping.Spec)
+	if err != nil {
+		log.Error(err, "failure resolving PermissionSetMapping role")
+		return ctrlruntime.Result{}, err
+	}
+
+	// Keep the PermissionSetMapping out of aws-auth until its role has been approved, if required.
+	approved := r.Approval == nil
+	var approvalID string
+	if reason == "" && r.Approval != nil {
+		result, err := r.Approval.Check(ctx, approval.Mapping{
+			Kind:        "PermissionSetMapping",
+			Name:        mapping.Name,
+			ARN:         roleARN,
+			Groups:      mapping.Spec.Groups,
+			CreatedBy:   mapping.Annotations[v1beta1.CreatedByAnnotation],
+			RequestedBy: mapping.Annotations[v1beta1.RequestedByAnnotation],
+			Annotations: mapping.Annotations,
+		})
+		if err != nil {
+			log.Error(err, "failure checking PermissionSetMapping approval")
+			return ctrlruntime.Result{}, err
+		}
+		approved = result.Approved
+		approvalID = result.ID
+		if result.Approved {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionApproved, metav1.ConditionTrue, v1beta1.ReasonApproved, result.Message) || statusChanged
+		} else {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionApproved, metav1.ConditionFalse, v1beta1.ReasonPendingApproval, result.Message) || statusChanged
+			reason, message = v1beta1.ReasonPendingApproval, result.Message
+		}
+		if mapping.Status.ApprovedBy != result.ApprovedBy {
+			mapping.Status.ApprovedBy = result.ApprovedBy
+			statusChanged = true
+		}
+	}
+
+	// Keep the PermissionSetMapping out of aws-auth if it assigns uncataloged groups, if required.
+	authGroups, unknownGroups, err := resolveAuthGroups(ctx, r.Client, mapping.Spec.Groups)
+	if err != nil {
+		log.Error(err, "failure resolving PermissionSetMapping AuthGroups")
+		return ctrlruntime.Result{}, err
+	}
+	statusChanged = setAuthGroups(&mapping.Status.AuthGroups, authGroups) || statusChanged
+	if r.RequireCatalogedGroups {
+		if unknownGroups != "" {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionValid, metav1.ConditionFalse, v1beta1.ReasonUnknownGroups, unknownGroups) || statusChanged
+			if reason == "" {
+				reason, message = v1beta1.ReasonUnknownGroups, unknownGroups
+			}
+		} else {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionValid, metav1.ConditionTrue, v1beta1.ReasonGroupsCataloged, "all groups are cataloged") || statusChanged
+		}
+	}
+
+	// Keep the PermissionSetMapping out of aws-auth if its role is not allowlisted, if restricted.
+	if reason == "" && r.Allowlist != nil {
+		if err := r.Allowlist.Check(roleARN, mapping.Spec.Groups); err != nil {
+			reason, message = v1beta1.ReasonPrincipalNotAllowed, err.Error()
+		}
+	}
+
+	// Keep the PermissionSetMapping out of aws-auth unless its role is the one it was approved for, if verified.
+	if r.Verifier != nil && roleARN != "" {
+		check, err := verifyPrincipal(ctx, r.Verifier, roleARN, mapping.Status.Principal, approved, approvalID)
+		if err != nil {
+			log.Error(err, "failure verifying PermissionSetMapping role")
+			return ctrlruntime.Result{}, err
+		}
+		statusChanged = setPrincipal(&mapping.Status.Principal, check.Principal) || statusChanged
+		if check.Verified {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionVerified, metav1.ConditionTrue, check.Reason, check.Message) || statusChanged
+		} else {
+			statusChanged = setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionVerified, metav1.ConditionFalse, check.Reason, check.Message) || statusChanged
+			if reason == "" {
+				reason, message = check.Reason, check.Message
+			}
+		}
+	}
+
+	// Keep the PermissionSetMapping out of aws-auth if it loses a conflict with another mapping of its role or username.
+	groups := mapping.Spec.Groups
+	if roleARN != "" {
+		parties, err := listConflictParties(ctx, r.Client)
+		if err != nil {
+			log.Error(err, "failure listing PermissionSetMapping conflicts")
+			return ctrlruntime.Result{}, err
+		}
+		resolution := resolveConflicts(permissionSetMappingParty(&mapping, roleARN), parties, r.ConflictPolicy)
+		statusChanged = setConflictCondition(&mapping.Status.Conditions, mapping.Generation, resolution) || statusChanged
+		if resolution.Rejected {
+			if reason == "" {
+				reason, message = resolution.Reason, resolution.Message
+			}
+		} else {
+			groups = resolution.Groups
+		}
+	}
+
+	if reason != "" {
+		if err := awsauthSvc.RemoveMapRole(username); err != nil && !awsauth.IsNotFound(err) {
+			log.Error(err, "failure removing unresolved PermissionSetMapping from aws-auth")
+			return ctrlruntime.Result{}, err
+		}
+		// Keep the resolved role in the status, as approvals name it.
+		if mapping.Status.RoleARN != roleARN {
+			mapping.Status.RoleARN = roleARN
+			statusChanged = true
+		}
+		if setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionActive, metav1.ConditionFalse, reason, message) {
+			r.Recorder.Event(&mapping, kcorev1.EventTypeWarning, reason, message)
+			statusChanged = true
+		}
+		if statusChanged {
+			if err := r.Status().Update(ctx, &mapping); err != nil {
+				log.Error(err, "failure updating PermissionSetMapping status")
+				return ctrlruntime.Result{}, err
+			}
+		}
+		log.Info("PermissionSetMapping is inactive", "reason", reason)
+		return ctrlruntime.Result{RequeueAfter: permissionSetResyncPeriod}, nil
+	}
+
+	// Ensure that the current role is synced to the kube-system:aws-auth ConfigMap, replacing any earlier one.
+	if err := awsauthSvc.UpsertMapRole(username, awsauth.MapRole{
+		RoleARN: roleARN,
+		Groups:  groups,
+	}); err != nil {
+		log.Error(err, "failure upserting PermissionSetMapping")
+		return ctrlruntime.Result{}, err
+	}
+	log.Info("upserted PermissionSetMapping", "roleARN", roleARN)
+	if mapping.Status.RoleARN != roleARN {
+		if mapping.Status.RoleARN != "" {
+			r.Recorder.Event(&mapping, kcorev1.EventTypeNormal, "RoleChanged", fmt.Sprintf("permission set role changed from %s to %s", mapping.Status.RoleARN, roleARN))
+		}
+		mapping.Status.RoleARN = roleARN
+		statusChanged = true
+	}
+
+	if setCondition(&mapping.Status.Conditions, mapping.Generation, v1beta1.ConditionActive, metav1.ConditionTrue, v1beta1.ReasonSynced, "mapping is present in aws-auth") {
+		r.Recorder.Event(&mapping, kcorev1.EventTypeNormal, v1beta1.ReasonSynced, "mapping is present in aws-auth")
+		statusChanged = true
+	}
+	if statusChanged {
+		if err := r.Status().Update(ctx, &mapping); err != nil {
+			log.Error(err, "failure updating PermissionSetMapping status")
+			return ctrlruntime.Result{}, err
+		}
+	}
+	return ctrlruntime.Result{RequeueAfter: permissionSetResyncPeriod}, nil
+}
+
+// SetupWithManager sets up the controller with the Mapper.
+func (r *PermissionSetMappingReconciler) SetupWithManager(mgr ctrlruntime.Manager) error {
+	return ctrlruntime.NewControllerManagedBy(mgr).
+		For(&v1beta1.PermissionSetMapping{}, builder.WithPredicates(selectorPredicate(r.Selector))).
+		Watches(&source.Kind{Type: &v1beta1.AccessApproval{}}, handler.EnqueueRequestsFromMapFunc(approvalRequests("PermissionSetMapping"))).
+		Watches(&source.Kind{Type: &v1beta1.MapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "PermissionSetMapping"))).
+		Watches(&source.Kind{Type: &v1beta1.MapUser{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "PermissionSetMapping"))).
+		Watches(&source.Kind{Type: &v1beta1.NamespacedMapRole{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "PermissionSetMapping"))).
+		Watches(&source.Kind{Type: &v1beta1.PermissionSetMapping{}}, handler.EnqueueRequestsFromMapFunc(conflictRequests(r.Client, "PermissionSetMapping"))).
+		Watches(&source.Kind{Type: &v1beta1.AuthGroup{}}, handler.EnqueueRequestsFromMapFunc(listRequests(r.Client, func() ctrlclient.ObjectList {
+			return &v1beta1.PermissionSetMappingList{}
+		}))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r.Progress.Reconciler("PermissionSetMapping", r))
+}
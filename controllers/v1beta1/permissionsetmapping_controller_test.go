@@ -0,0 +1,148 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+func TestPermissionSetMappingReconciler_RoleChanged(t *testing.T) {
+	g := gomega.NewWithT(t)
+	k := kubefake.NewSimpleClientset()
+	useKubeClient(t, k)
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1beta1.PermissionSetMapping{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins"},
+		Spec:       v1beta1.PermissionSetMappingSpec{AccountID: "123456789012", PermissionSetName: "AdministratorAccess", Groups: []string{"system:masters"}},
+	}).Build()
+	resolver := principal.StaticRoles{
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_AdministratorAccess_0123456789abcdef",
+	}
+	reconciler := &PermissionSetMappingReconciler{Client: c, Log: ctrllog.Log, Scheme: scheme, Recorder: record.NewFakeRecorder(10), Resolver: resolver}
+	reconcile := func() []awsauth.Entry {
+		_, err := reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: types.NamespacedName{Name: "admins"}})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		authData, _, err := awsauth.ReadAuthMap(k)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return authData.Entries()
+	}
+
+	g.Expect(reconcile()).To(gomega.Equal([]awsauth.Entry{{
+		DataType: awsauth.MapRoleData,
+		Username: "permission-set:admins",
+		ARN:      "arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_0123456789abcdef",
+		Groups:   []string{"system:masters"},
+	}}))
+
+	// A reprovisioned permission set replaces the entry of its former role.
+	resolver[0] = "arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_AdministratorAccess_fedcba9876543210"
+	g.Expect(reconcile()).To(gomega.Equal([]awsauth.Entry{{
+		DataType: awsauth.MapRoleData,
+		Username: "permission-set:admins",
+		ARN:      "arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_fedcba9876543210",
+		Groups:   []string{"system:masters"},
+	}}))
+	var mapping v1beta1.PermissionSetMapping
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Name: "admins"}, &mapping)).To(gomega.Succeed())
+	g.Expect(mapping.Status.RoleARN).To(gomega.Equal("arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_fedcba9876543210"))
+}
+
+func TestPermissionSetMappingReconciler_Gates(t *testing.T) {
+	g := gomega.NewWithT(t)
+	k := kubefake.NewSimpleClientset()
+	useKubeClient(t, k)
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1beta1.PermissionSetMapping{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins", Annotations: map[string]string{
+			v1beta1.CreatedByAnnotation:   "alice",
+			v1beta1.RequestedByAnnotation: "alice",
+		}},
+		Spec: v1beta1.PermissionSetMappingSpec{AccountID: "123456789012", PermissionSetName: "AdministratorAccess", Groups: []string{"system:masters"}},
+	}).Build()
+	roleARN := "arn:aws:iam::123456789012:role/AWSReservedSSO_AdministratorAccess_0123456789abcdef"
+	reconciler := &PermissionSetMappingReconciler{
+		Client:                 c,
+		Log:                    ctrllog.Log,
+		Scheme:                 scheme,
+		Recorder:               record.NewFakeRecorder(10),
+		Resolver:               principal.StaticRoles{roleARN},
+		Approval:               &approval.Checker{Reader: c, TrustApprovalObjects: true},
+		RequireCatalogedGroups: true,
+	}
+	reconcile := func() (v1beta1.PermissionSetMapping, []awsauth.Entry) {
+		_, err := reconciler.Reconcile(context.Background(), ctrlruntime.Request{NamespacedName: types.NamespacedName{Name: "admins"}})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		var mapping v1beta1.PermissionSetMapping
+		g.Expect(c.Get(context.Background(), types.NamespacedName{Name: "admins"}, &mapping)).To(gomega.Succeed())
+		authData, _, err := awsauth.ReadAuthMap(k)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		return mapping, authData.Entries()
+	}
+
+	// The resolved role is kept out of aws-auth until approved, but shown for approvers.
+	mapping, entries := reconcile()
+	g.Expect(entries).To(gomega.BeEmpty())
+	g.Expect(mapping.Status.RoleARN).To(gomega.Equal(roleARN))
+	g.Expect(meta.FindStatusCondition(mapping.Status.Conditions, v1beta1.ConditionActive).Reason).To(gomega.Equal(v1beta1.ReasonPendingApproval))
+
+	g.Expect(c.Create(context.Background(), &v1beta1.AccessApproval{
+		ObjectMeta: metav1.ObjectMeta{Name: "admins", Annotations: map[string]string{v1beta1.RequestedByAnnotation: "bob"}},
+		Spec:       v1beta1.AccessApprovalSpec{Kind: "PermissionSetMapping", Name: "admins", ARN: roleARN, Groups: []string{"system:masters"}},
+	})).To(gomega.Succeed())
+	mapping, entries = reconcile()
+	g.Expect(entries).To(gomega.BeEmpty())
+	g.Expect(mapping.Status.ApprovedBy).To(gomega.Equal("bob"))
+	g.Expect(meta.FindStatusCondition(mapping.Status.Conditions, v1beta1.ConditionActive).Reason).To(gomega.Equal(v1beta1.ReasonUnknownGroups))
+
+	g.Expect(c.Create(context.Background(), &v1beta1.AuthGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-admins"},
+		Spec:       v1beta1.AuthGroupSpec{Group: "system:masters"},
+	})).To(gomega.Succeed())
+	mapping, entries = reconcile()
+	g.Expect(entries).To(gomega.Equal([]awsauth.Entry{{
+		DataType: awsauth.MapRoleData,
+		Username: "permission-set:admins",
+		ARN:      roleARN,
+		Groups:   []string{"system:masters"},
+	}}))
+	g.Expect(mapping.Status.AuthGroups).To(gomega.Equal([]string{"cluster-admins"}))
+}
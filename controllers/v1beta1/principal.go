@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+// principalResyncPeriod is how often the IAM principals of mappings are
+// verified again, detecting principals deleted or recreated since.
+const principalResyncPeriod = 10 * time.Minute
+
+// principalCheck is the outcome of verifying the IAM principal of a mapping.
+type principalCheck struct {
+	Verified  bool
+	Reason    string
+	Message   string
+	Principal *v1beta1.PrincipalStatus
+}
+
+// verifyPrincipal verifies that the IAM principal with arn exists and still has
+// the unique ID recorded for it. If approved is true, the unique ID is recorded
+// under approval, the ID of the approval granted if approvals are required,
+// unless one was recorded for arn under the same approval already. Otherwise
+// the recorded unique ID is forgotten, so that a principal recreated with the
+// same ARN is accepted by approving the mapping anew. Principals that cannot
+// be looked up, such as those of other accounts, are let through unverified.
+func verifyPrincipal(ctx context.Context, verifier principal.Verifier, arn string, recorded *v1beta1.PrincipalStatus, approved bool, approval string) (principalCheck, error) {
+	if recorded != nil && (recorded.ARN != arn || !approved) {
+		recorded = nil
+	}
+	// A new approval records the unique ID anew. Unique IDs recorded before
+	// approvals were identified are kept, and adopted by the current approval
+	// if they still match.
+	if recorded != nil && recorded.Approval != "" && recorded.Approval != approval {
+		recorded = nil
+	}
+	uniqueID, err := verifier.UniqueID(ctx, arn)
+	if errors.Is(err, principal.ErrUnverifiable) {
+		return principalCheck{Verified: true, Reason: v1beta1.ReasonPrincipalUnverifiable, Message: err.Error(), Principal: recorded}, nil
+	}
+	if errors.Is(err, principal.ErrNotFound) {
+		return principalCheck{Reason: v1beta1.ReasonPrincipalNotFound, Message: err.Error(), Principal: recorded}, nil
+	}
+	if err != nil {
+		return principalCheck{}, err
+	}
+	if recorded != nil && recorded.UniqueID != uniqueID {
+		return principalCheck{
+			Reason:    v1beta1.ReasonPrincipalChanged,
+			Message:   fmt.Sprintf("unique ID of %s changed from %s to %s since the mapping was approved", arn, recorded.UniqueID, uniqueID),
+			Principal: recorded,
+		}, nil
+	}
+	if (recorded == nil || recorded.Approval != approval) && approved {
+		recorded = &v1beta1.PrincipalStatus{ARN: arn, UniqueID: uniqueID, Approval: approval}
+	}
+	return principalCheck{
+		Verified:  true,
+		Reason:    v1beta1.ReasonPrincipalVerified,
+		Message:   fmt.Sprintf("%s exists with unique ID %s", arn, uniqueID),
+		Principal: recorded,
+	}, nil
+}
+
+// setPrincipal sets the recorded IAM principal in a mapping's status,
+// returning whether it changed.
+func setPrincipal(field **v1beta1.PrincipalStatus, p *v1beta1.PrincipalStatus) bool {
+	if reflect.DeepEqual(*field, p) {
+		return false
+	}
+	*field = p
+	return true
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/principal"
+)
+
+func TestVerifyPrincipal(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	arn := "arn:aws:iam::123456789012:role/admin"
+	verifier := principal.Static{arn: "AROAFIRST"}
+
+	// The unique ID is only recorded once the mapping is approved.
+	check, err := verifyPrincipal(ctx, verifier, arn, nil, false, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Principal).To(gomega.BeNil())
+
+	check, err = verifyPrincipal(ctx, verifier, arn, nil, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Reason).To(gomega.Equal(v1beta1.ReasonPrincipalVerified))
+	g.Expect(check.Principal).To(gomega.Equal(&v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROAFIRST", Approval: "first"}))
+	recorded := check.Principal
+
+	var status *v1beta1.PrincipalStatus
+	g.Expect(setPrincipal(&status, recorded)).To(gomega.BeTrue())
+	g.Expect(setPrincipal(&status, &v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROAFIRST", Approval: "first"})).To(gomega.BeFalse())
+
+	// A principal recreated with the same ARN is flagged.
+	verifier[arn] = "AROASECOND"
+	check, err = verifyPrincipal(ctx, verifier, arn, recorded, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeFalse())
+	g.Expect(check.Reason).To(gomega.Equal(v1beta1.ReasonPrincipalChanged))
+	g.Expect(check.Message).To(gomega.ContainSubstring("changed from AROAFIRST to AROASECOND"))
+	g.Expect(check.Principal).To(gomega.Equal(recorded))
+
+	// A principal that no longer exists is flagged.
+	delete(verifier, arn)
+	check, err = verifyPrincipal(ctx, verifier, arn, recorded, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeFalse())
+	g.Expect(check.Reason).To(gomega.Equal(v1beta1.ReasonPrincipalNotFound))
+
+	// Changing the mapping's ARN discards the principal recorded for the old one.
+	other := "arn:aws:iam::123456789012:role/other"
+	verifier[other] = "AROAOTHER"
+	check, err = verifyPrincipal(ctx, verifier, other, recorded, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Principal).To(gomega.Equal(&v1beta1.PrincipalStatus{ARN: other, UniqueID: "AROAOTHER", Approval: "first"}))
+}
+
+func TestVerifyPrincipal_Reapproval(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	arn := "arn:aws:iam::123456789012:role/admin"
+	verifier := principal.Static{arn: "AROASECOND"}
+	recorded := &v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROAFIRST", Approval: "first"}
+
+	// A new approval accepts the recreated principal.
+	check, err := verifyPrincipal(ctx, verifier, arn, recorded, true, "second")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Principal).To(gomega.Equal(&v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROASECOND", Approval: "second"}))
+
+	// Revoking the approval forgets the unique ID, so that approving the same
+	// mapping again accepts the recreated principal.
+	check, err = verifyPrincipal(ctx, verifier, arn, recorded, false, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Principal).To(gomega.BeNil())
+	check, err = verifyPrincipal(ctx, verifier, arn, check.Principal, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Principal).To(gomega.Equal(&v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROASECOND", Approval: "first"}))
+
+	// Unique IDs recorded without an approval are adopted by the current
+	// approval only if they still match.
+	legacy := &v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROAFIRST"}
+	check, err = verifyPrincipal(ctx, verifier, arn, legacy, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Reason).To(gomega.Equal(v1beta1.ReasonPrincipalChanged))
+	legacy.UniqueID = "AROASECOND"
+	check, err = verifyPrincipal(ctx, verifier, arn, legacy, true, "first")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Principal).To(gomega.Equal(&v1beta1.PrincipalStatus{ARN: arn, UniqueID: "AROASECOND", Approval: "first"}))
+}
+
+// unverifiableVerifier is a Verifier that cannot look up any principal.
+type unverifiableVerifier struct{}
+
+func (unverifiableVerifier) UniqueID(_ context.Context, principalARN string) (string, error) {
+	return "", fmt.Errorf("%w outside account 123456789012: %s", principal.ErrUnverifiable, principalARN)
+}
+
+func TestVerifyPrincipal_Unverifiable(t *testing.T) {
+	g := gomega.NewWithT(t)
+	arn := "arn:aws:iam::999999999999:role/admin"
+
+	// Principals of other accounts are let through without recording a unique ID.
+	check, err := verifyPrincipal(context.Background(), unverifiableVerifier{}, arn, nil, true, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(check.Verified).To(gomega.BeTrue())
+	g.Expect(check.Reason).To(gomega.Equal(v1beta1.ReasonPrincipalUnverifiable))
+	g.Expect(check.Message).To(gomega.ContainSubstring("outside account 123456789012"))
+	g.Expect(check.Principal).To(gomega.BeNil())
+}
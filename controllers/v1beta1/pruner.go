@@ -0,0 +1,340 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// Default intervals of the Pruner.
+const (
+	DefaultPruneGracePeriod = 24 * time.Hour
+	DefaultPruneInterval    = 5 * time.Minute
+)
+
+// Pruner makes the local aws-auth ConfigMap authoritative: its entries are
+// exactly those declared by MapRole, MapUser, NamespacedMapRole and
+// PermissionSetMapping objects, plus a protected baseline. Entries declared by
+// none are recorded as prune candidates in an annotation of the ConfigMap, and
+// pruned once they have stayed undeclared for the grace period. Missing
+// baseline entries are restored.
+type Pruner struct {
+	// Reader lists the mappings declaring entries, and should read through to
+	// the API server so that newly created mappings are never missed.
+	Reader     ctrlclient.Reader
+	KubeClient kubernetes.Interface
+	Log        logr.Logger
+	Recorder   record.EventRecorder
+
+	// Baseline lists the entries that are never pruned, and are restored when
+	// missing, such as those of node roles.
+	Baseline awsauth.AwsAuthData
+
+	// GracePeriod is how long an entry stays undeclared before it is pruned,
+	// defaulting to DefaultPruneGracePeriod.
+	GracePeriod time.Duration
+
+	// Interval is how often the entries are checked, defaulting to
+	// DefaultPruneInterval.
+	Interval time.Duration
+
+	// DryRun only records the prune candidates, and logs the baseline entries
+	// that would be restored.
+	DryRun bool
+
+	// AuditSink, if set, receives a record of each entry pruned or restored.
+	AuditSink awsauth.AuditSink
+
+	// SizeMonitor, if set, tracks the size of the aws-auth ConfigMap.
+	SizeMonitor *awsauth.SizeMonitor
+
+	// Owner, if set, is the operator instance the Pruner writes entries as.
+	// Entries owned by other instances are never pruned.
+	Owner string
+
+	// now returns the current time, defaulting to time.Now.
+	now func() time.Time
+}
+
+// Start checks the aws-auth entries every interval until ctx is done.
+func (p *Pruner) Start(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Prune(ctx); err != nil {
+			p.Log.Error(err, "failure pruning aws-auth")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneKey identifies the aws-auth entries declared by mappings, by their
+// username and normalized principal ARN, so that an entry of the username of a
+// mapping but of another principal is not declared by it.
+type pruneKey struct {
+	dataType awsauth.DataType
+	username string
+	arn      string
+}
+
+// newPruneKey returns the key of an entry of the principal with arn.
+func newPruneKey(dataType awsauth.DataType, username, arn string) pruneKey {
+	return pruneKey{dataType, username, canonicalARN(dataType, arn)}
+}
+
+// declared returns the keys of the aws-auth entries declared by mappings,
+// including those not currently written, such as inactive mappings.
+func (p *Pruner) declared(ctx context.Context) (map[pruneKey]bool, error) {
+	keys := map[pruneKey]bool{}
+	var mapRoles v1beta1.MapRoleList
+	if err := p.Reader.List(ctx, &mapRoles); err != nil {
+		return nil, err
+	}
+	for _, mapRole := range mapRoles.Items {
+		keys[newPruneKey(awsauth.MapRoleData, mapRole.Name, mapRole.Spec.RoleARN)] = true
+	}
+	var mapUsers v1beta1.MapUserList
+	if err := p.Reader.List(ctx, &mapUsers); err != nil {
+		return nil, err
+	}
+	for _, mapUser := range mapUsers.Items {
+		keys[newPruneKey(awsauth.MapUserData, mapUser.Name, mapUser.Spec.UserARN)] = true
+	}
+	var namespacedMapRoles v1beta1.NamespacedMapRoleList
+	if err := p.Reader.List(ctx, &namespacedMapRoles); err != nil {
+		return nil, err
+	}
+	for _, mapRole := range namespacedMapRoles.Items {
+		keys[newPruneKey(awsauth.MapRoleData, mapRole.Username(), mapRole.Spec.RoleARN)] = true
+	}
+	var mappings v1beta1.PermissionSetMappingList
+	if err := p.Reader.List(ctx, &mappings); err != nil {
+		return nil, err
+	}
+	// The role of a PermissionSetMapping is the one it was last resolved to.
+	for _, mapping := range mappings.Items {
+		keys[newPruneKey(awsauth.MapRoleData, mapping.Username(), mapping.Status.RoleARN)] = true
+	}
+	return keys, nil
+}
+
+// protected returns whether the entry has the principal ARN of an entry of
+// the baseline.
+func (p *Pruner) protected(entry awsauth.Entry) bool {
+	for _, baseline := range p.Baseline.Entries() {
+		if baseline.DataType == entry.DataType && strings.EqualFold(baseline.ARN, canonicalARN(entry.DataType, entry.ARN)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalARN returns the principal ARN normalized, or unchanged if invalid.
+func canonicalARN(dataType awsauth.DataType, principalARN string) string {
+	if normalized, _, err := awsauth.NormalizeARN(dataType, principalARN); err == nil {
+		return normalized
+	}
+	return principalARN
+}
+
+// Prune restores the missing baseline entries, records the entries declared
+// by no mapping as prune candidates, and prunes the candidates whose grace
+// period has passed.
+func (p *Pruner) Prune(ctx context.Context) error {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	gracePeriod := p.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultPruneGracePeriod
+	}
+
+	if err := p.restoreBaseline(ctx); err != nil {
+		return err
+	}
+	keys, err := p.declared(ctx)
+	if err != nil {
+		return err
+	}
+	authData, configMap, err := awsauth.ReadAuthMapWithContext(ctx, p.KubeClient)
+	if err != nil {
+		return err
+	}
+	previous, err := awsauth.ReadPruneCandidates(configMap)
+	if err != nil {
+		p.Log.Error(err, "failure reading prune candidates, restarting their grace periods")
+	}
+
+	checked := now().UTC().Truncate(time.Second)
+	var candidates []awsauth.PruneCandidate
+	var due []awsauth.Entry
+	for _, entry := range authData.Entries() {
+		if keys[newPruneKey(entry.DataType, entry.Username, entry.ARN)] || p.protected(entry) {
+			continue
+		}
+		if owner := authData.Owner(entry.DataType, entry.Username); owner != "" && owner != p.Owner {
+			continue
+		}
+		candidate := awsauth.PruneCandidate{Entry: entry, Since: checked}
+		scheduled := true
+		for _, c := range previous {
+			if c.DataType == entry.DataType && c.Username == entry.Username && c.ARN == entry.ARN {
+				candidate.Since = c.Since
+				scheduled = false
+			}
+		}
+		candidate.PruneAfter = candidate.Since.Add(gracePeriod)
+		if scheduled {
+			p.Log.Info("aws-auth entry is not declared by any mapping", "dataType", entry.DataType, "username", entry.Username, "arn", entry.ARN, "pruneAfter", candidate.PruneAfter, "dryRun", p.DryRun)
+			p.Recorder.Eventf(configMap, kcorev1.EventTypeWarning, "PruneScheduled", "%s %s with username '%s' is not declared by any mapping and will be pruned after %s", entry.DataType, entry.ARN, entry.Username, candidate.PruneAfter.Format(time.RFC3339))
+		}
+		if !p.DryRun && !checked.Before(candidate.PruneAfter) {
+			due = append(due, entry)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if len(due) > 0 {
+		mapper := awsauth.NewMapper(p.KubeClient, false)
+		mapper.Size = p.SizeMonitor
+		mapper.Owner = p.Owner
+		if p.AuditSink != nil {
+			mapper.Audit = p.audit
+		}
+		pruned, err := mapper.Prune(ctx, due)
+		if err != nil {
+			return err
+		}
+		for _, entry := range pruned {
+			p.Log.Info("pruned aws-auth entry", "dataType", entry.DataType, "username", entry.Username, "arn", entry.ARN)
+			p.Recorder.Eventf(configMap, kcorev1.EventTypeNormal, "Pruned", "pruned %s %s with username '%s', not declared by any mapping", entry.DataType, entry.ARN, entry.Username)
+		}
+		candidates = withoutPruned(candidates, pruned)
+	}
+
+	if !reflect.DeepEqual(candidates, previous) {
+		if err := awsauth.WritePruneCandidates(ctx, p.KubeClient, candidates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutPruned returns the candidates that were not pruned.
+func withoutPruned(candidates []awsauth.PruneCandidate, pruned []awsauth.Entry) []awsauth.PruneCandidate {
+	var remaining []awsauth.PruneCandidate
+	for _, candidate := range candidates {
+		var found bool
+		for _, entry := range pruned {
+			if entry.DataType == candidate.DataType && entry.Username == candidate.Username && entry.ARN == candidate.ARN {
+				found = true
+				break
+			}
+		}
+		if !found {
+			remaining = append(remaining, candidate)
+		}
+	}
+	return remaining
+}
+
+// restoreBaseline upserts the baseline entries whose principal ARN and
+// username are both missing from the aws-auth ConfigMap.
+func (p *Pruner) restoreBaseline(ctx context.Context) error {
+	baseline := p.Baseline.Entries()
+	if len(baseline) == 0 {
+		return nil
+	}
+	authData, _, err := awsauth.ReadAuthMapWithContext(ctx, p.KubeClient)
+	if err != nil {
+		return err
+	}
+	entries := authData.Entries()
+	svc, err := awsauth.NewService(&awsauth.ServiceConfig{
+		KubeClient:  p.KubeClient,
+		Log:         p.Log,
+		Context:     ctx,
+		AuditSink:   p.AuditSink,
+		SizeMonitor: p.SizeMonitor,
+		Owner:       p.Owner,
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range baseline {
+		if baselinePresent(entry, entries) {
+			continue
+		}
+		if p.DryRun {
+			p.Log.Info("would restore baseline aws-auth entry", "dataType", entry.DataType, "username", entry.Username, "arn", entry.ARN)
+			continue
+		}
+		if entry.DataType == awsauth.MapRoleData {
+			err = svc.UpsertMapRole(entry.Username, awsauth.MapRole{RoleARN: entry.ARN, Groups: entry.Groups})
+		} else {
+			err = svc.UpsertMapUser(entry.Username, awsauth.MapUser{UserARN: entry.ARN, Groups: entry.Groups})
+		}
+		if err != nil {
+			return err
+		}
+		p.Log.Info("restored baseline aws-auth entry", "dataType", entry.DataType, "username", entry.Username, "arn", entry.ARN)
+	}
+	return nil
+}
+
+// baselinePresent returns whether an entry has the principal ARN or the
+// username of the baseline entry.
+func baselinePresent(baseline awsauth.Entry, entries []awsauth.Entry) bool {
+	for _, entry := range entries {
+		if entry.DataType != baseline.DataType {
+			continue
+		}
+		if entry.Username == baseline.Username || strings.EqualFold(canonicalARN(entry.DataType, entry.ARN), baseline.ARN) {
+			return true
+		}
+	}
+	return false
+}
+
+// audit writes an audit record to the audit sink, logging any failure as the
+// change has already been made.
+func (p *Pruner) audit(record *awsauth.AuditRecord) {
+	if err := p.AuditSink.Write(context.Background(), record); err != nil {
+		p.Log.Error(err, "failure writing audit record", "username", record.Username)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+const (
+	nodeRoleARN   = "arn:aws:iam::123456789012:role/node"
+	opsRoleARN    = "arn:aws:iam::123456789012:role/ops"
+	legacyRoleARN = "arn:aws:iam::123456789012:role/legacy"
+	devRoleARN    = "arn:aws:iam::123456789012:role/dev"
+	teamBUserARN  = "arn:aws:iam::123456789012:user/team-b"
+	breakGlassARN = "arn:aws:iam::123456789012:user/break-glass"
+)
+
+// newTestPruner returns a Pruner of an aws-auth ConfigMap mapping a baseline
+// node role, the roles of a MapRole and a NamespacedMapRole, an undeclared
+// legacy role and a user owned by another operator instance.
+func newTestPruner(g *gomega.WithT, now *time.Time) (*Pruner, *kubefake.Clientset, *record.FakeRecorder) {
+	k := kubefake.NewSimpleClientset()
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData, cm, err := awsauth.ReadAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData.SetMapRoles([]*awsauth.MapRole{
+		awsauth.NewMapRole(nodeRoleARN, "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"}),
+		awsauth.NewMapRole(opsRoleARN, "ops", []string{"system:masters"}),
+		awsauth.NewMapRole(legacyRoleARN, "legacy", []string{"system:masters"}),
+		awsauth.NewMapRole(devRoleARN, "namespace:team-a:dev", []string{"team-a-devs"}),
+	})
+	authData.SetMapUsers([]*awsauth.MapUser{
+		awsauth.NewMapUser(teamBUserARN, "team-b", []string{"team-b"}),
+	})
+	authData.SetOwner(awsauth.MapUserData, "team-b", "shard-b")
+	g.Expect(awsauth.UpdateAuthMap(k, authData, cm)).To(gomega.Succeed())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "ops"}, Spec: v1beta1.MapRoleSpec{RoleARN: opsRoleARN}},
+		&v1beta1.NamespacedMapRole{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "dev"}, Spec: v1beta1.NamespacedMapRoleSpec{RoleARN: devRoleARN}},
+	).Build()
+	recorder := record.NewFakeRecorder(10)
+	pruner := &Pruner{
+		Reader:     c,
+		KubeClient: k,
+		Log:        ctrllog.Log,
+		Recorder:   recorder,
+		Baseline: awsauth.AwsAuthData{
+			MapRoles: []*awsauth.MapRole{awsauth.NewMapRole(nodeRoleARN, "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"})},
+			MapUsers: []*awsauth.MapUser{awsauth.NewMapUser(breakGlassARN, "break-glass", []string{"system:masters"})},
+		},
+		GracePeriod: time.Hour,
+		Owner:       "shard-a",
+		now:         func() time.Time { return *now },
+	}
+	return pruner, k, recorder
+}
+
+// prunerState returns the ARNs of the aws-auth entries and prune candidates.
+func prunerState(g *gomega.WithT, k *kubefake.Clientset) ([]string, []awsauth.PruneCandidate) {
+	authData, cm, err := awsauth.ReadAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	var arns []string
+	for _, entry := range authData.Entries() {
+		arns = append(arns, entry.ARN)
+	}
+	candidates, err := awsauth.ReadPruneCandidates(cm)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	return arns, candidates
+}
+
+func TestPruner_Prune(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	pruner, k, recorder := newTestPruner(g, &now)
+	ctx := context.Background()
+
+	// The undeclared legacy role becomes a candidate, and the missing
+	// baseline user is restored.
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	arns, candidates := prunerState(g, k)
+	g.Expect(arns).To(gomega.Equal([]string{nodeRoleARN, opsRoleARN, legacyRoleARN, devRoleARN, teamBUserARN, breakGlassARN}))
+	g.Expect(candidates).To(gomega.HaveLen(1))
+	g.Expect(candidates[0].ARN).To(gomega.Equal(legacyRoleARN))
+	g.Expect(candidates[0].Since).To(gomega.Equal(now))
+	g.Expect(candidates[0].PruneAfter).To(gomega.Equal(now.Add(time.Hour)))
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.HavePrefix("Warning PruneScheduled mapRole " + legacyRoleARN)))
+
+	// It stays a candidate, scheduled once, until its grace period has passed.
+	now = now.Add(30 * time.Minute)
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	arns, candidates = prunerState(g, k)
+	g.Expect(arns).To(gomega.ContainElement(legacyRoleARN))
+	g.Expect(candidates).To(gomega.HaveLen(1))
+	g.Expect(recorder.Events).NotTo(gomega.Receive())
+
+	now = now.Add(30 * time.Minute)
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	arns, candidates = prunerState(g, k)
+	g.Expect(arns).To(gomega.Equal([]string{nodeRoleARN, opsRoleARN, devRoleARN, teamBUserARN, breakGlassARN}))
+	g.Expect(candidates).To(gomega.BeEmpty())
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.HavePrefix("Normal Pruned pruned mapRole " + legacyRoleARN)))
+}
+
+func TestPruner_Redeclared(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	pruner, k, _ := newTestPruner(g, &now)
+	ctx := context.Background()
+
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	_, candidates := prunerState(g, k)
+	g.Expect(candidates).To(gomega.HaveLen(1))
+
+	// An entry declared again within its grace period is no longer a candidate.
+	g.Expect(pruner.Reader.(ctrlclient.Client).Create(ctx, &v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "legacy"}, Spec: v1beta1.MapRoleSpec{RoleARN: legacyRoleARN}})).To(gomega.Succeed())
+	now = now.Add(2 * time.Hour)
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	arns, candidates := prunerState(g, k)
+	g.Expect(arns).To(gomega.ContainElement(legacyRoleARN))
+	g.Expect(candidates).To(gomega.BeEmpty())
+}
+
+func TestPruner_OtherPrincipal(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	pruner, k, _ := newTestPruner(g, &now)
+	ctx := context.Background()
+
+	// An entry of the username of a mapping, but of another principal, is
+	// not declared by it.
+	var mapRole v1beta1.MapRole
+	g.Expect(pruner.Reader.Get(ctx, ctrlclient.ObjectKey{Name: "ops"}, &mapRole)).To(gomega.Succeed())
+	mapRole.Spec.RoleARN = "arn:aws:iam::123456789012:role/ops-v2"
+	g.Expect(pruner.Reader.(ctrlclient.Client).Update(ctx, &mapRole)).To(gomega.Succeed())
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	_, candidates := prunerState(g, k)
+	g.Expect(candidates).To(gomega.HaveLen(2))
+	g.Expect([]string{candidates[0].ARN, candidates[1].ARN}).To(gomega.ConsistOf(opsRoleARN, legacyRoleARN))
+
+	// ARNs are compared normalized.
+	mapRole.Spec.RoleARN = "arn:aws:iam::123456789012:role/team/ops"
+	g.Expect(pruner.Reader.(ctrlclient.Client).Update(ctx, &mapRole)).To(gomega.Succeed())
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	_, candidates = prunerState(g, k)
+	g.Expect(candidates).To(gomega.HaveLen(1))
+	g.Expect(candidates[0].ARN).To(gomega.Equal(legacyRoleARN))
+}
+
+func TestPruner_DryRun(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	pruner, k, _ := newTestPruner(g, &now)
+	pruner.DryRun = true
+	ctx := context.Background()
+
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	now = now.Add(2 * time.Hour)
+	g.Expect(pruner.Prune(ctx)).To(gomega.Succeed())
+	arns, candidates := prunerState(g, k)
+	g.Expect(arns).To(gomega.Equal([]string{nodeRoleARN, opsRoleARN, legacyRoleARN, devRoleARN, teamBUserARN}))
+	g.Expect(candidates).To(gomega.HaveLen(1))
+	g.Expect(candidates[0].ARN).To(gomega.Equal(legacyRoleARN))
+}
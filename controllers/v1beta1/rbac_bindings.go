@@ -0,0 +1,151 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+// rbacSubjects returns the subjects of the RBAC bindings of a mapping: its
+// groups, or its username if it has none.
+func rbacSubjects(username string, groups []string) []rbacv1.Subject {
+	if len(groups) == 0 {
+		return []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: username}}
+	}
+	subjects := make([]rbacv1.Subject, 0, len(groups))
+	for _, group := range groups {
+		subjects = append(subjects, rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: group})
+	}
+	return subjects
+}
+
+// rbacBindingName returns the name of the binding of a ClusterRole to a mapping.
+func rbacBindingName(kind, name, clusterRole string) string {
+	return fmt.Sprintf("%s-%s-%s", strings.ToLower(kind), name, clusterRole)
+}
+
+// bindableRBAC returns the bindings of ClusterRoles in bindable, and an error
+// naming the ClusterRoles of the others, which are not bound on behalf of
+// mappings.
+func bindableRBAC(bindable []string, bindings []v1beta1.RBACBinding) ([]v1beta1.RBACBinding, error) {
+	allowed := map[string]bool{}
+	for _, clusterRole := range bindable {
+		allowed[clusterRole] = true
+	}
+	var bound []v1beta1.RBACBinding
+	var refused []string
+	for _, binding := range bindings {
+		if allowed[binding.ClusterRole] {
+			bound = append(bound, binding)
+		} else {
+			refused = append(refused, binding.ClusterRole)
+		}
+	}
+	if len(refused) > 0 {
+		return bound, fmt.Errorf("ClusterRoles not bindable by the operator: %s", strings.Join(refused, ", "))
+	}
+	return bound, nil
+}
+
+// syncRBACBindings creates or updates the ClusterRoleBindings and RoleBindings
+// declared by a mapping, and deletes those it owns that are no longer declared.
+// Passing no bindings deletes all of them.
+func syncRBACBindings(ctx context.Context, c ctrlclient.Client, scheme *pkgruntime.Scheme, kind string, owner ctrlclient.Object, bindings []v1beta1.RBACBinding, subjects []rbacv1.Subject) error {
+	desired := map[string]bool{}
+	for _, binding := range bindings {
+		roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: binding.ClusterRole}
+		name := rbacBindingName(kind, owner.GetName(), binding.ClusterRole)
+		if len(binding.Namespaces) == 0 {
+			crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			if _, err := controllerutil.CreateOrUpdate(ctx, c, crb, func() error {
+				crb.RoleRef = roleRef
+				crb.Subjects = subjects
+				return ownRBACBinding(scheme, kind, owner, crb)
+			}); err != nil {
+				return err
+			}
+			desired[name] = true
+			continue
+		}
+		for _, namespace := range binding.Namespaces {
+			rb := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+			if _, err := controllerutil.CreateOrUpdate(ctx, c, rb, func() error {
+				rb.RoleRef = roleRef
+				rb.Subjects = subjects
+				return ownRBACBinding(scheme, kind, owner, rb)
+			}); err != nil {
+				return err
+			}
+			desired[namespace+"/"+name] = true
+		}
+	}
+
+	// Prune the bindings owned by the mapping that are no longer declared.
+	labels := ctrlclient.MatchingLabels{v1beta1.OwnerKindLabel: kind}
+	var crbs rbacv1.ClusterRoleBindingList
+	if err := c.List(ctx, &crbs, labels); err != nil {
+		return err
+	}
+	for i := range crbs.Items {
+		crb := &crbs.Items[i]
+		if metav1.IsControlledBy(crb, owner) && !desired[crb.Name] {
+			if err := c.Delete(ctx, crb); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	var rbs rbacv1.RoleBindingList
+	if err := c.List(ctx, &rbs, labels); err != nil {
+		return err
+	}
+	for i := range rbs.Items {
+		rb := &rbs.Items[i]
+		if metav1.IsControlledBy(rb, owner) && !desired[rb.Namespace+"/"+rb.Name] {
+			if err := c.Delete(ctx, rb); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ownRBACBinding labels a binding and makes the mapping its controller, so it
+// is garbage collected with the mapping. It refuses to adopt existing bindings
+// not created for the mapping.
+func ownRBACBinding(scheme *pkgruntime.Scheme, kind string, owner, binding ctrlclient.Object) error {
+	if binding.GetResourceVersion() != "" && !metav1.IsControlledBy(binding, owner) {
+		return fmt.Errorf("RBAC binding %s already exists and is not owned by %s %s", binding.GetName(), kind, owner.GetName())
+	}
+	labels := binding.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[v1beta1.OwnerKindLabel] = kind
+	binding.SetLabels(labels)
+	return controllerutil.SetControllerReference(owner, binding, scheme)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestRBACSubjects(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(rbacSubjects("admin", nil)).To(gomega.Equal([]rbacv1.Subject{
+		{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "admin"},
+	}))
+	g.Expect(rbacSubjects("admin", []string{"ops"})).To(gomega.Equal([]rbacv1.Subject{
+		{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "ops"},
+	}))
+}
+
+func TestBindableRBAC(t *testing.T) {
+	g := gomega.NewWithT(t)
+	bindings := []v1beta1.RBACBinding{
+		{ClusterRole: "view"},
+		{ClusterRole: "cluster-admin"},
+		{ClusterRole: "edit", Namespaces: []string{"payments"}},
+	}
+	bound, err := bindableRBAC([]string{"edit", "view"}, bindings)
+	g.Expect(err).To(gomega.MatchError("ClusterRoles not bindable by the operator: cluster-admin"))
+	g.Expect(bound).To(gomega.Equal([]v1beta1.RBACBinding{bindings[0], bindings[2]}))
+
+	bound, err = bindableRBAC(nil, bindings)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(bound).To(gomega.BeEmpty())
+
+	bound, err = bindableRBAC([]string{"edit", "view"}, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(bound).To(gomega.BeEmpty())
+}
+
+func TestSyncRBACBindings(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+	scheme := pkgruntime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	foreign := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "maprole-admin-cluster-admin"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(foreign).Build()
+
+	mapRole := &v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "admin", UID: "1234"}}
+	subjects := rbacSubjects(mapRole.Name, []string{"ops"})
+	bindings := []v1beta1.RBACBinding{
+		{ClusterRole: "view"},
+		{ClusterRole: "edit", Namespaces: []string{"payments", "billing"}},
+	}
+	g.Expect(syncRBACBindings(ctx, c, scheme, "MapRole", mapRole, bindings, subjects)).To(gomega.Succeed())
+
+	var crbs rbacv1.ClusterRoleBindingList
+	g.Expect(c.List(ctx, &crbs)).To(gomega.Succeed())
+	g.Expect(crbs.Items).To(gomega.HaveLen(2))
+	var rbs rbacv1.RoleBindingList
+	g.Expect(c.List(ctx, &rbs)).To(gomega.Succeed())
+	g.Expect(rbs.Items).To(gomega.HaveLen(2))
+	for _, rb := range rbs.Items {
+		g.Expect(rb.Name).To(gomega.Equal("maprole-admin-edit"))
+		g.Expect(rb.RoleRef.Name).To(gomega.Equal("edit"))
+		g.Expect(rb.Subjects).To(gomega.Equal(subjects))
+		g.Expect(metav1.IsControlledBy(&rb, mapRole)).To(gomega.BeTrue())
+	}
+
+	// Bindings no longer declared are pruned.
+	g.Expect(syncRBACBindings(ctx, c, scheme, "MapRole", mapRole, bindings[1:], subjects)).To(gomega.Succeed())
+	g.Expect(c.List(ctx, &crbs)).To(gomega.Succeed())
+	g.Expect(crbs.Items).To(gomega.HaveLen(1))
+	g.Expect(crbs.Items[0].Name).To(gomega.Equal(foreign.Name))
+
+	// Bindings not created for the mapping are not adopted.
+	bindings = []v1beta1.RBACBinding{{ClusterRole: "cluster-admin"}}
+	g.Expect(syncRBACBindings(ctx, c, scheme, "MapRole", mapRole, bindings, subjects)).NotTo(gomega.Succeed())
+
+	// Inactive mappings have all of their bindings removed.
+	g.Expect(syncRBACBindings(ctx, c, scheme, "MapRole", mapRole, nil, nil)).To(gomega.Succeed())
+	g.Expect(c.List(ctx, &rbs)).To(gomega.Succeed())
+	g.Expect(rbs.Items).To(gomega.BeEmpty())
+	g.Expect(c.List(ctx, &crbs)).To(gomega.Succeed())
+	g.Expect(crbs.Items).To(gomega.HaveLen(1))
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// selects returns true if selector, if any, selects obj.
+func selects(selector labels.Selector, obj ctrlclient.Object) bool {
+	return selector == nil || selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// selectorPredicate returns a predicate passing the events of the objects
+// selected by selector, if any, including updates deselecting them, so that
+// the entries of deselected objects are released.
+func selectorPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return selects(selector, e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return selects(selector, e.ObjectOld) || selects(selector, e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return selects(selector, e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return selects(selector, e.Object)
+		},
+	}
+}
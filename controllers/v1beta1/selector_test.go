@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+)
+
+func TestSelectorPredicate(t *testing.T) {
+	g := gomega.NewWithT(t)
+	selector, err := labels.Parse("team=a")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	teamA := &v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"team": "a"}}}
+	teamB := &v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "b", Labels: map[string]string{"team": "b"}}}
+
+	g.Expect(selects(nil, teamB)).To(gomega.BeTrue())
+	g.Expect(selects(selector, teamA)).To(gomega.BeTrue())
+	g.Expect(selects(selector, teamB)).To(gomega.BeFalse())
+
+	predicate := selectorPredicate(selector)
+	g.Expect(predicate.Create(event.CreateEvent{Object: teamA})).To(gomega.BeTrue())
+	g.Expect(predicate.Create(event.CreateEvent{Object: teamB})).To(gomega.BeFalse())
+	g.Expect(predicate.Delete(event.DeleteEvent{Object: teamB})).To(gomega.BeFalse())
+
+	// Objects deselected by an update are reconciled to release their entries.
+	g.Expect(predicate.Update(event.UpdateEvent{ObjectOld: teamA, ObjectNew: teamB})).To(gomega.BeTrue())
+	g.Expect(predicate.Update(event.UpdateEvent{ObjectOld: teamB, ObjectNew: teamB})).To(gomega.BeFalse())
+}
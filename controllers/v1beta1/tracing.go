@@ -0,0 +1,57 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/client-go/kubernetes"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+
+	"github.com/sambatv/aws-auth-operator/kube"
+	"github.com/sambatv/aws-auth-operator/tracing"
+)
+
+var tracer = otel.Tracer("github.com/sambatv/aws-auth-operator/controllers/v1beta1")
+
+// newKubeClient returns a client of the local cluster, and is replaced by
+// tests.
+var newKubeClient = kube.GetClient
+
+// startReconcileSpan starts the span of the reconciliation of an object of kind.
+func startReconcileSpan(ctx context.Context, kind string, req ctrlruntime.Request) (context.Context, trace.Span) {
+	return tracer.Start(ctx, kind+".Reconcile", trace.WithAttributes(
+		tracing.KindKey.String(kind),
+		tracing.NamespaceKey.String(req.Namespace),
+		tracing.NameKey.String(req.Name),
+	))
+}
+
+// getKubeClient returns a client of the local cluster, tracing its setup.
+func getKubeClient(ctx context.Context) (kubernetes.Interface, error) {
+	_, span := tracer.Start(ctx, "kube.GetClient")
+	defer span.End()
+	client, err := newKubeClient()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return client, err
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health provides the readiness and liveness checks of the operator.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// AuthMapCheck returns a readiness check that the aws-auth ConfigMap can be
+// read. As with every read of the operator, the ConfigMap is created if it
+// does not exist. Malformed data does not fail the check: the ConfigMap is
+// quarantined instead, and the operator stays ready to serve the webhooks
+// needed to repair it.
+func AuthMapCheck(client kubernetes.Interface) healthz.Checker {
+	return func(req *http.Request) error {
+		if _, _, err := awsauth.ReadAuthMapWithContext(req.Context(), client); err != nil && !awsauth.IsMalformed(err) {
+			return fmt.Errorf("reading %s/%s ConfigMap: %w", awsauth.ConfigMapNamespace, awsauth.ConfigMapName, err)
+		}
+		return nil
+	}
+}
+
+// AccessCheck returns a readiness check that the operator is allowed to
+// perform verb on the aws-auth ConfigMap, as reviewed by a
+// SelfSubjectAccessReview.
+func AccessCheck(client kubernetes.Interface, verb string) healthz.Checker {
+	return func(req *http.Request) error {
+		review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(req.Context(), &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: awsauth.ConfigMapNamespace,
+					Verb:      verb,
+					Resource:  "configmaps",
+					Name:      awsauth.ConfigMapName,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("reviewing access to %s/%s ConfigMap: %w", awsauth.ConfigMapNamespace, awsauth.ConfigMapName, err)
+		}
+		if !review.Status.Allowed {
+			message := fmt.Sprintf("not allowed to %s %s/%s ConfigMap", verb, awsauth.ConfigMapNamespace, awsauth.ConfigMapName)
+			if review.Status.Reason != "" {
+				message += ": " + review.Status.Reason
+			}
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+// DefaultReconcileTimeout is the time after which an unfinished reconcile is
+// considered stuck by a Progress without a timeout.
+const DefaultReconcileTimeout = 10 * time.Minute
+
+// Progress tracks the reconciles in flight, so that a liveness check can
+// detect those that have stopped making progress.
+type Progress struct {
+	// Timeout is the time after which an unfinished reconcile is considered
+	// stuck, defaulting to DefaultReconcileTimeout.
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	next     uint64
+	inFlight map[uint64]reconcileStart
+	now      func() time.Time
+}
+
+type reconcileStart struct {
+	controller string
+	request    reconcile.Request
+	time       time.Time
+}
+
+// Start records the start of a reconcile, returning a function recording its end.
+func (p *Progress) Start(controller string, req reconcile.Request) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inFlight == nil {
+		p.inFlight = map[uint64]reconcileStart{}
+	}
+	id := p.next
+	p.next++
+	p.inFlight[id] = reconcileStart{controller: controller, request: req, time: p.clock()}
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.inFlight, id)
+	}
+}
+
+// Check is a liveness check failing while any reconcile has been in flight
+// for longer than the timeout.
+func (p *Progress) Check(_ *http.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReconcileTimeout
+	}
+	now := p.clock()
+	var stuck []string
+	for _, start := range p.inFlight {
+		if elapsed := now.Sub(start.time); elapsed > timeout {
+			stuck = append(stuck, fmt.Sprintf("%s %s for %s", start.controller, start.request, elapsed.Round(time.Second)))
+		}
+	}
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("reconciles stuck: %s", strings.Join(stuck, ", "))
+	}
+	return nil
+}
+
+func (p *Progress) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// Reconciler returns r, tracking the progress of its reconciles as those of
+// controller. A nil Progress returns r unchanged.
+func (p *Progress) Reconciler(controller string, r reconcile.Reconciler) reconcile.Reconciler {
+	if p == nil {
+		return r
+	}
+	return reconcile.Func(func(ctx context.Context, req ctrlruntime.Request) (ctrlruntime.Result, error) {
+		defer p.Start(controller, req)()
+		return r.Reconcile(ctx, req)
+	})
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+func TestAuthMapCheck(t *testing.T) {
+	g := gomega.NewWithT(t)
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	configMap := &kcorev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: awsauth.ConfigMapName, Namespace: awsauth.ConfigMapNamespace},
+		Data:       map[string]string{"mapRoles": "- rolearn: arn:aws:iam::123456789012:role/admin\n  username: admin\n"},
+	}
+	g.Expect(AuthMapCheck(fake.NewSimpleClientset(configMap))(req)).To(gomega.Succeed())
+
+	// Malformed data is quarantined rather than failing the check.
+	configMap.Data["mapRoles"] = "rolearn: [unterminated"
+	g.Expect(AuthMapCheck(fake.NewSimpleClientset(configMap))(req)).To(gomega.Succeed())
+
+	client := fake.NewSimpleClientset(configMap)
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, pkgruntime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	err := AuthMapCheck(client)(req)
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("reading kube-system/aws-auth ConfigMap")))
+}
+
+func TestAccessCheck(t *testing.T) {
+	g := gomega.NewWithT(t)
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	client := fake.NewSimpleClientset()
+	var reviewed *authorizationv1.ResourceAttributes
+	allowed := true
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, pkgruntime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		reviewed = review.Spec.ResourceAttributes
+		review.Status.Allowed = allowed
+		if !allowed {
+			review.Status.Reason = "no RBAC policy matched"
+		}
+		return true, review, nil
+	})
+
+	g.Expect(AccessCheck(client, "update")(req)).To(gomega.Succeed())
+	g.Expect(reviewed).To(gomega.Equal(&authorizationv1.ResourceAttributes{
+		Namespace: "kube-system",
+		Verb:      "update",
+		Resource:  "configmaps",
+		Name:      "aws-auth",
+	}))
+
+	allowed = false
+	err := AccessCheck(client, "update")(req)
+	g.Expect(err).To(gomega.MatchError("not allowed to update kube-system/aws-auth ConfigMap: no RBAC policy matched"))
+}
+
+func TestProgress(t *testing.T) {
+	g := gomega.NewWithT(t)
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	progress := &Progress{Timeout: time.Minute, now: func() time.Time { return now }}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "admin"}}
+
+	g.Expect(progress.Check(nil)).To(gomega.Succeed())
+	done := progress.Start("MapRole", req)
+	now = now.Add(time.Minute)
+	g.Expect(progress.Check(nil)).To(gomega.Succeed())
+	now = now.Add(time.Second)
+	g.Expect(progress.Check(nil)).To(gomega.MatchError("reconciles stuck: MapRole /admin for 1m1s"))
+	done()
+	g.Expect(progress.Check(nil)).To(gomega.Succeed())
+
+	// Reconcilers report their reconciles while in flight.
+	var inFlight error
+	r := progress.Reconciler("MapUser", reconcile.Func(func(context.Context, ctrlruntime.Request) (ctrlruntime.Result, error) {
+		now = now.Add(2 * time.Minute)
+		inFlight = progress.Check(nil)
+		return ctrlruntime.Result{}, nil
+	}))
+	_, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(inFlight).To(gomega.MatchError(gomega.ContainSubstring("MapUser /admin for 2m0s")))
+	g.Expect(progress.Check(nil)).To(gomega.Succeed())
+
+	var nilProgress *Progress
+	inner := &noopReconciler{}
+	g.Expect(nilProgress.Reconciler("MapUser", inner)).To(gomega.BeIdenticalTo(inner))
+}
+
+type noopReconciler struct{}
+
+func (*noopReconciler) Reconcile(context.Context, ctrlruntime.Request) (ctrlruntime.Result, error) {
+	return ctrlruntime.Result{}, nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hub provides access to the clusters whose mappings are managed from a
+// hub cluster. Each managed cluster is registered by a Secret holding its
+// kubeconfig, or its EKS cluster name if it uses the EKS access entries
+// backend, whose labels are matched by mapping cluster selectors.
+package hub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/kube"
+)
+
+const (
+	// ClusterLabel marks the Secrets registering managed clusters.
+	ClusterLabel = "aws-auth.samba.tv/cluster"
+
+	// KubeconfigKey is the key of the kubeconfig in cluster Secrets.
+	KubeconfigKey = "kubeconfig"
+
+	// BackendKey is the key of the backend type in cluster Secrets, defaulting
+	// to the aws-auth ConfigMap.
+	BackendKey = "backend"
+
+	// ClusterNameKey is the key of the EKS cluster name in cluster Secrets,
+	// required by the EKS access entries backend.
+	ClusterNameKey = "clusterName"
+
+	// RegionKey is the key of the AWS region in cluster Secrets, used by the
+	// EKS access entries backend.
+	RegionKey = "region"
+)
+
+// Cluster is a managed cluster, named after the Secret registering it.
+type Cluster struct {
+	Name   string
+	Labels map[string]string
+
+	// KubeClient is the client of the cluster, and Backend stores its
+	// mappings if it does not use the aws-auth ConfigMap, unless Err explains
+	// why either could not be created.
+	KubeClient kubernetes.Interface
+	Backend    awsauth.Backend
+	Err        error
+}
+
+// Registry lists the managed clusters registered by Secrets in a namespace.
+type Registry struct {
+	Reader    ctrlclient.Reader
+	Namespace string
+
+	// NewClient creates the client of a cluster from its kubeconfig,
+	// defaulting to kube.GetClientForKubeconfig.
+	NewClient func(kubeconfig []byte) (kubernetes.Interface, error)
+
+	// mu guards clients, the clients and backends of the clusters by Secret
+	// name, reused until their Secret is replaced or changes.
+	mu      sync.Mutex
+	clients map[string]cachedClient
+}
+
+// cachedClient is the client and backend of a cluster created from a version
+// of its Secret.
+type cachedClient struct {
+	uid             types.UID
+	resourceVersion string
+	kubeClient      kubernetes.Interface
+	backend         awsauth.Backend
+}
+
+// Clusters returns the managed clusters sorted by name. The clients of the
+// clusters are created once per version of their Secret, and reused by later
+// calls.
+func (r *Registry) Clusters(ctx context.Context) ([]Cluster, error) {
+	var secrets kcorev1.SecretList
+	if err := r.Reader.List(ctx, &secrets, ctrlclient.InNamespace(r.Namespace), ctrlclient.HasLabels{ClusterLabel}); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clients := make(map[string]cachedClient, len(secrets.Items))
+	clusters := make([]Cluster, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		cluster := Cluster{Name: secret.Name, Labels: secret.Labels}
+		client, ok := r.clients[secret.Name]
+		if !ok || client.uid != secret.UID || client.resourceVersion != secret.ResourceVersion {
+			client = cachedClient{uid: secret.UID, resourceVersion: secret.ResourceVersion}
+			client.kubeClient, client.backend, cluster.Err = r.newClient(secret)
+		}
+		// Clients failing to be created are retried by the next call.
+		if cluster.Err == nil {
+			cluster.KubeClient, cluster.Backend = client.kubeClient, client.backend
+			clients[secret.Name] = client
+		}
+		clusters = append(clusters, cluster)
+	}
+	// Forget the clients of the clusters whose Secret was deleted.
+	r.clients = clients
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters, nil
+}
+
+// newClient creates the client of the cluster registered by secret, or its
+// backend if it does not use the aws-auth ConfigMap.
+func (r *Registry) newClient(secret *kcorev1.Secret) (kubernetes.Interface, awsauth.Backend, error) {
+	switch backend := awsauth.BackendType(secret.Data[BackendKey]); backend {
+	case awsauth.EKSAccessEntriesBackend:
+		eksBackend, err := awsauth.NewEKSBackend(&awsauth.EKSBackendConfig{
+			ClusterName: string(secret.Data[ClusterNameKey]),
+			Region:      string(secret.Data[RegionKey]),
+		})
+		return nil, eksBackend, err
+	case "", awsauth.ConfigMapBackend:
+		kubeconfig, ok := secret.Data[KubeconfigKey]
+		if !ok {
+			return nil, nil, fmt.Errorf("secret %s/%s has no %s key", secret.Namespace, secret.Name, KubeconfigKey)
+		}
+		newClient := r.NewClient
+		if newClient == nil {
+			newClient = kube.GetClientForKubeconfig
+		}
+		kubeClient, err := newClient(kubeconfig)
+		return kubeClient, nil, err
+	default:
+		return nil, nil, fmt.Errorf("secret %s/%s has unknown backend %s", secret.Namespace, secret.Name, backend)
+	}
+}
+
+// Matches returns whether the cluster's labels match selector.
+func (c *Cluster) Matches(selector labels.Selector) bool {
+	return selector.Matches(labels.Set(c.Labels))
+}
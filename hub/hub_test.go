@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newClusterSecret(namespace, name string, clusterLabels map[string]string, data map[string][]byte) *kcorev1.Secret {
+	return &kcorev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: clusterLabels},
+		Data:       data,
+	}
+}
+
+func TestRegistry_Clusters(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(gomega.Succeed())
+	kubeconfig := map[string][]byte{KubeconfigKey: []byte("kubeconfig")}
+	reader := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newClusterSecret("hub", "prod-us", map[string]string{ClusterLabel: "true", "env": "prod"}, kubeconfig),
+		newClusterSecret("hub", "dev-us", map[string]string{ClusterLabel: "true", "env": "dev"}, kubeconfig),
+		newClusterSecret("hub", "broken", map[string]string{ClusterLabel: "true"}, nil),
+		newClusterSecret("hub", "eks", map[string]string{ClusterLabel: "true"}, map[string][]byte{BackendKey: []byte("eks"), ClusterNameKey: []byte("eks"), RegionKey: []byte("us-east-1")}),
+		newClusterSecret("hub", "unknown", map[string]string{ClusterLabel: "true"}, map[string][]byte{BackendKey: []byte("unknown")}),
+		newClusterSecret("hub", "unrelated", nil, kubeconfig),
+		newClusterSecret("other", "prod-eu", map[string]string{ClusterLabel: "true", "env": "prod"}, kubeconfig),
+	).Build()
+
+	var kubeconfigs []string
+	registry := &Registry{
+		Reader:    reader,
+		Namespace: "hub",
+		NewClient: func(kubeconfig []byte) (kubernetes.Interface, error) {
+			kubeconfigs = append(kubeconfigs, string(kubeconfig))
+			return fake.NewSimpleClientset(), nil
+		},
+	}
+	clusters, err := registry.Clusters(context.Background())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters).To(gomega.HaveLen(5))
+	g.Expect(kubeconfigs).To(gomega.Equal([]string{"kubeconfig", "kubeconfig"}))
+
+	g.Expect(clusters[0].Name).To(gomega.Equal("broken"))
+	g.Expect(clusters[0].Err).To(gomega.HaveOccurred())
+	g.Expect(clusters[1].Name).To(gomega.Equal("dev-us"))
+	g.Expect(clusters[1].KubeClient).NotTo(gomega.BeNil())
+	g.Expect(clusters[2].Name).To(gomega.Equal("eks"))
+	g.Expect(clusters[2].Err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters[2].Backend).NotTo(gomega.BeNil())
+	g.Expect(clusters[3].Name).To(gomega.Equal("prod-us"))
+	g.Expect(clusters[4].Name).To(gomega.Equal("unknown"))
+	g.Expect(clusters[4].Err).To(gomega.MatchError(gomega.ContainSubstring("unknown backend")))
+
+	selector := labels.SelectorFromSet(labels.Set{"env": "prod"})
+	g.Expect(clusters[1].Matches(selector)).To(gomega.BeFalse())
+	g.Expect(clusters[3].Matches(selector)).To(gomega.BeTrue())
+}
+
+func TestRegistry_ClustersCachesClients(t *testing.T) {
+	g := gomega.NewWithT(t)
+	scheme := pkgruntime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(gomega.Succeed())
+	secret := newClusterSecret("hub", "prod-us", map[string]string{ClusterLabel: "true"}, map[string][]byte{KubeconfigKey: []byte("kubeconfig")})
+	reader := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+
+	var kubeconfigs []string
+	registry := &Registry{
+		Reader:    reader,
+		Namespace: "hub",
+		NewClient: func(kubeconfig []byte) (kubernetes.Interface, error) {
+			kubeconfigs = append(kubeconfigs, string(kubeconfig))
+			return fake.NewSimpleClientset(), nil
+		},
+	}
+	ctx := context.Background()
+	clusters, err := registry.Clusters(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters).To(gomega.HaveLen(1))
+	kubeClient := clusters[0].KubeClient
+
+	// The client is reused while the Secret is unchanged.
+	clusters, err = registry.Clusters(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters[0].KubeClient).To(gomega.BeIdenticalTo(kubeClient))
+	g.Expect(kubeconfigs).To(gomega.Equal([]string{"kubeconfig"}))
+
+	// The client is recreated from the changed Secret.
+	g.Expect(reader.Get(ctx, ctrlclient.ObjectKeyFromObject(secret), secret)).To(gomega.Succeed())
+	secret.Data[KubeconfigKey] = []byte("rotated")
+	g.Expect(reader.Update(ctx, secret)).To(gomega.Succeed())
+	clusters, err = registry.Clusters(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters[0].KubeClient).NotTo(gomega.BeIdenticalTo(kubeClient))
+	g.Expect(kubeconfigs).To(gomega.Equal([]string{"kubeconfig", "rotated"}))
+
+	// The client is forgotten with the Secret.
+	g.Expect(reader.Delete(ctx, secret)).To(gomega.Succeed())
+	clusters, err = registry.Clusters(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(clusters).To(gomega.BeEmpty())
+	g.Expect(registry.clients).To(gomega.BeEmpty())
+}
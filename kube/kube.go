@@ -41,6 +41,16 @@ func GetClient() (kubernetes.Interface, error) {
 	return client, nil
 }
 
+// GetClientForKubeconfig returns a new Kubernetes client configured by the
+// contents of a kubeconfig file.
+func GetClientForKubeconfig(kubeconfig []byte) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
 // fileExists tests if a file exists at path.
 func fileExists(path string) bool {
 	info, err := os.Stat(path)
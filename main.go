@@ -17,22 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	pkgruntime "k8s.io/apimachinery/pkg/runtime"
 	pkgutilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrlruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
+	"github.com/sambatv/aws-auth-operator/allowlist"
+	v1api "github.com/sambatv/aws-auth-operator/apis/v1"
 	v1beta1api "github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/approval"
+	"github.com/sambatv/aws-auth-operator/awsauth"
 	v1beta1ctrl "github.com/sambatv/aws-auth-operator/controllers/v1beta1"
+	"github.com/sambatv/aws-auth-operator/health"
+	"github.com/sambatv/aws-auth-operator/hub"
+	"github.com/sambatv/aws-auth-operator/kube"
+	"github.com/sambatv/aws-auth-operator/principal"
+	"github.com/sambatv/aws-auth-operator/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -45,6 +62,7 @@ func init() {
 	pkgutilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	pkgutilruntime.Must(v1beta1api.AddToScheme(scheme))
+	pkgutilruntime.Must(v1api.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,9 +70,72 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableWebhooks bool
+	var requireApproval bool
+	var approverKeysDir string
+	var requireCatalogedGroups bool
+	var bindableClusterRoles string
+	var hubNamespace string
+	var backendType string
+	var eksBackendConfig awsauth.EKSBackendConfig
+	var migrate bool
+	var migrationOptions awsauth.MigrationOptions
+	var verifyPrincipals bool
+	var allowlistPath string
+	var iamVerifierConfig principal.IAMVerifierConfig
+	var auditConfigMap string
+	var auditHistoryLimit int
+	var auditWebhookURL string
+	var tracingConfig tracing.Config
+	var reconcileTimeout time.Duration
+	var batchWindow time.Duration
+	var maxConcurrentReconciles int
+	var sizeWarningPercent int
+	var conflictPolicy string
+	var selector string
+	var instanceName string
+	var authoritative bool
+	var baselinePath string
+	var pruner v1beta1ctrl.Pruner
+	var quarantineInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false, "Enable the admission webhooks. Their serving certificates must be provisioned.")
+	flag.BoolVar(&requireApproval, "require-approval", false, "Keep mappings out of aws-auth until approved by an identity other than their requester. Requires --enable-webhooks or --approver-keys-dir.")
+	flag.StringVar(&approverKeysDir, "approver-keys-dir", "", "The directory of approver public keys trusted to sign approval annotations.")
+	flag.StringVar(&backendType, "backend", string(awsauth.ConfigMapBackend), "The backend storing the mappings of the local cluster, either configmap or eks.")
+	flag.StringVar(&eksBackendConfig.ClusterName, "eks-cluster-name", "", "The name of the local EKS cluster, required by the eks backend.")
+	flag.StringVar(&eksBackendConfig.Region, "eks-region", "", "The AWS region of the local EKS cluster, defaulting to that of the environment.")
+	flag.StringVar(&eksBackendConfig.Endpoint, "eks-endpoint", "", "Overrides the EKS API endpoint used by the eks backend.")
+	flag.BoolVar(&migrate, "migrate-to-access-entries", false, "Migrate the aws-auth ConfigMap entries of the local cluster to EKS access entries, print a JSON report and exit.")
+	flag.BoolVar(&migrationOptions.DryRun, "migrate-dry-run", false, "Only report the entries a migration would migrate.")
+	flag.IntVar(&migrationOptions.RemoveBatchSize, "migrate-remove-batch-size", 0, "The number of migrated entries to remove from the aws-auth ConfigMap, none if zero.")
+	flag.StringVar(&hubNamespace, "hub-namespace", "", "Run in hub mode, syncing mappings with a cluster selector to the clusters registered by kubeconfig Secrets in this namespace.")
+	flag.BoolVar(&verifyPrincipals, "verify-principals", false, "Keep MapRole and MapUser objects out of aws-auth unless their IAM principal exists with the unique ID it had when they were approved.")
+	flag.StringVar(&iamVerifierConfig.Endpoint, "iam-endpoint", "", "Overrides the IAM API endpoint used to verify principals and resolve permission sets.")
+	flag.StringVar(&allowlistPath, "allowlist", "", "The YAML file listing the AWS partitions and accounts whose principals mappings may grant access to, optionally by group.")
+	flag.BoolVar(&requireCatalogedGroups, "require-cataloged-groups", false, "Keep mappings assigning groups not cataloged by an AuthGroup out of aws-auth, and reject them if webhooks are enabled.")
+	flag.StringVar(&bindableClusterRoles, "bindable-cluster-roles", "admin,edit,view", "The comma-separated ClusterRoles that the spec.rbac of MapRole and MapUser objects may bind. The operator must be granted bind on each of them.")
+	flag.StringVar(&auditConfigMap, "audit-configmap", "", "The <namespace>/<name> of a ConfigMap to append audit records of aws-auth changes to.")
+	flag.IntVar(&auditHistoryLimit, "audit-history-limit", awsauth.DefaultAuditHistoryLimit, "The number of audit records kept in the audit ConfigMap, fewer if they would exceed its size limit.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "The URL to post audit records of aws-auth changes to as JSON.")
+	flag.StringVar((*string)(&tracingConfig.Exporter), "tracing-exporter", string(tracing.NoExporter), "Where to export OpenTelemetry traces, either none, stdout or otlp.")
+	flag.StringVar(&tracingConfig.Endpoint, "otlp-endpoint", "", "The OTLP gRPC endpoint of the otlp tracing exporter, defaulting to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317.")
+	flag.BoolVar(&tracingConfig.Insecure, "otlp-insecure", false, "Disable TLS with the OTLP endpoint.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", health.DefaultReconcileTimeout, "The time after which an unfinished reconcile fails the liveness check.")
+	flag.DurationVar(&batchWindow, "batch-window", 0, "Coalesce the aws-auth changes made within this window into a single ConfigMap update, disabled if zero.")
+	flag.IntVar(&sizeWarningPercent, "aws-auth-size-warning-percent", awsauth.DefaultSizeWarningPercent, "Warn when the aws-auth ConfigMap exceeds this percentage of its 1 MiB size limit.")
+	flag.StringVar(&conflictPolicy, "conflict-policy", string(v1beta1ctrl.RejectNewerPolicy), "Which of the MapRole and MapUser objects with the same IAM principal or username is written to aws-auth, either reject-newer, oldest-wins or merge-groups.")
+	flag.StringVar(&selector, "selector", "", "Only reconcile the mappings matching this label selector, leaving the others to other operator instances. Requires --instance-name.")
+	flag.StringVar(&instanceName, "instance-name", "", "The name of this operator instance, recorded as the owner of the aws-auth entries it writes so that other instances never remove them.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "The number of objects each controller reconciles at once.")
+	flag.BoolVar(&authoritative, "authoritative", false, "Prune the aws-auth entries of the local cluster declared by no mapping nor the protected baseline, and restore missing baseline entries.")
+	flag.StringVar(&baselinePath, "protected-baseline", "", "The YAML file listing the mapRoles and mapUsers never pruned in authoritative mode, such as those of node roles.")
+	flag.DurationVar(&pruner.GracePeriod, "prune-grace-period", v1beta1ctrl.DefaultPruneGracePeriod, "How long an aws-auth entry stays undeclared before it is pruned in authoritative mode.")
+	flag.DurationVar(&pruner.Interval, "prune-interval", v1beta1ctrl.DefaultPruneInterval, "How often the aws-auth entries are checked in authoritative mode.")
+	flag.BoolVar(&pruner.DryRun, "prune-dry-run", false, "Only record the aws-auth entries authoritative mode would prune.")
+	flag.DurationVar(&quarantineInterval, "quarantine-check-interval", awsauth.DefaultQuarantineInterval, "How often the aws-auth ConfigMap is checked for malformed data, which is backed up and quarantined.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -63,49 +144,371 @@ func main() {
 
 	ctrlruntime.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if migrate {
+		if err := migrateToAccessEntries(&eksBackendConfig, migrationOptions); err != nil {
+			setupLog.Error(err, "unable to migrate to access entries")
+			os.Exit(1)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), &tracingConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "failure flushing traces")
+		}
+	}()
+
+	var labelSelector labels.Selector
+	if selector != "" {
+		if instanceName == "" {
+			setupLog.Error(errors.New("--selector requires --instance-name"), "unable to parse selector")
+			os.Exit(1)
+		}
+		if labelSelector, err = labels.Parse(selector); err != nil {
+			setupLog.Error(err, "unable to parse selector")
+			os.Exit(1)
+		}
+	}
+	// Instances sharding the mappings each elect their own leader.
+	leaderElectionID := "7bfe6d29.aws-auth.samba.tv"
+	if instanceName != "" {
+		leaderElectionID = instanceName + "." + leaderElectionID
+	}
+
 	mgr, err := ctrlruntime.NewManager(ctrlruntime.GetConfigOrDie(), ctrlruntime.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "7bfe6d29.aws-auth.samba.tv",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	var approvalChecker *approval.Checker
+	if requireApproval {
+		approvalChecker = &approval.Checker{
+			Reader:               mgr.GetClient(),
+			TrustApprovalObjects: enableWebhooks,
+		}
+		if approverKeysDir != "" {
+			if approvalChecker.Keys, err = approval.LoadKeyRing(approverKeysDir); err != nil {
+				setupLog.Error(err, "unable to load approver keys")
+				os.Exit(1)
+			}
+		}
+		// Mappings could never be approved without a source of approvals.
+		if !approvalChecker.TrustApprovalObjects && len(approvalChecker.Keys) == 0 {
+			setupLog.Error(errors.New("--require-approval requires --enable-webhooks or approver keys in --approver-keys-dir"), "unable to check approvals")
+			os.Exit(1)
+		}
+	}
+
+	sizeMonitor := &awsauth.SizeMonitor{
+		WarningPercent: sizeWarningPercent,
+		Log:            ctrlruntime.Log.WithName("aws-auth-size"),
+	}
+	metrics.Registry.MustRegister(sizeMonitor)
+
+	var backend awsauth.Backend
+	switch awsauth.BackendType(backendType) {
+	case awsauth.ConfigMapBackend:
+		if batchWindow > 0 {
+			kubeClient, err := kube.GetClient()
+			if err != nil {
+				setupLog.Error(err, "unable to create batcher")
+				os.Exit(1)
+			}
+			batcher := awsauth.NewBatcher(kubeClient, batchWindow)
+			batcher.Size = sizeMonitor
+			batcher.Owner = instanceName
+			backend = batcher
+		}
+	case awsauth.EKSAccessEntriesBackend:
+		if backend, err = awsauth.NewEKSBackend(&eksBackendConfig); err != nil {
+			setupLog.Error(err, "unable to create eks backend")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Error(fmt.Errorf("unknown backend %s", backendType), "unable to create backend")
+		os.Exit(1)
+	}
+
+	switch v1beta1ctrl.ConflictPolicy(conflictPolicy) {
+	case v1beta1ctrl.RejectNewerPolicy, v1beta1ctrl.OldestWinsPolicy, v1beta1ctrl.MergeGroupsPolicy:
+	default:
+		setupLog.Error(fmt.Errorf("unknown conflict policy %s", conflictPolicy), "unable to create controllers")
+		os.Exit(1)
+	}
+
+	var verifier principal.Verifier
+	if verifyPrincipals {
+		if verifier, err = principal.NewIAMVerifier(&iamVerifierConfig); err != nil {
+			setupLog.Error(err, "unable to create IAM verifier")
+			os.Exit(1)
+		}
+	}
+
+	var principalAllowlist *allowlist.Allowlist
+	if allowlistPath != "" {
+		if principalAllowlist, err = allowlist.Load(allowlistPath); err != nil {
+			setupLog.Error(err, "unable to load allowlist")
+			os.Exit(1)
+		}
+	}
+
+	auditSink := awsauth.AuditSinks{awsauth.LogAuditSink{Log: ctrlruntime.Log.WithName("audit")}}
+	if auditConfigMap != "" {
+		parts := strings.SplitN(auditConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			setupLog.Error(fmt.Errorf("invalid audit ConfigMap %s, want <namespace>/<name>", auditConfigMap), "unable to create audit ConfigMap sink")
+			os.Exit(1)
+		}
+		kubeClient, err := kube.GetClient()
+		if err != nil {
+			setupLog.Error(err, "unable to create audit ConfigMap sink")
+			os.Exit(1)
+		}
+		auditSink = append(auditSink, awsauth.ConfigMapAuditSink{
+			KubeClient: kubeClient,
+			Namespace:  parts[0],
+			Name:       parts[1],
+			Limit:      auditHistoryLimit,
+		})
+	}
+	if auditWebhookURL != "" {
+		auditSink = append(auditSink, awsauth.WebhookAuditSink{URL: auditWebhookURL})
+	}
+
+	progress := &health.Progress{Timeout: reconcileTimeout}
+
+	var bindable []string
+	if bindableClusterRoles != "" {
+		bindable = strings.Split(bindableClusterRoles, ",")
+	}
+
+	var hubRegistry *hub.Registry
+	if hubNamespace != "" {
+		hubRegistry = &hub.Registry{
+			Reader:    mgr.GetAPIReader(),
+			Namespace: hubNamespace,
+		}
+	}
+
 	if err = (&v1beta1ctrl.MapUserReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrlruntime.Log.WithName("controllers").WithName("MapUser"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrlruntime.Log.WithName("controllers").WithName("MapUser"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("mapuser-controller"),
+		Approval: approvalChecker,
+		Backend:  backend,
+		Hub:      hubRegistry,
+		Verifier: verifier,
+
+		AuditSink:               auditSink,
+		SizeMonitor:             sizeMonitor,
+		Progress:                progress,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Selector:                labelSelector,
+		Owner:                   instanceName,
+		Allowlist:               principalAllowlist,
+		RequireCatalogedGroups:  requireCatalogedGroups,
+		ConflictPolicy:          v1beta1ctrl.ConflictPolicy(conflictPolicy),
+		BindableClusterRoles:    bindable,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MapUser")
 		os.Exit(1)
 	}
 	if err = (&v1beta1ctrl.MapRoleReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrlruntime.Log.WithName("controllers").WithName("MapRole"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrlruntime.Log.WithName("controllers").WithName("MapRole"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("maprole-controller"),
+		Approval: approvalChecker,
+		Backend:  backend,
+		Hub:      hubRegistry,
+		Verifier: verifier,
+
+		AuditSink:               auditSink,
+		SizeMonitor:             sizeMonitor,
+		Progress:                progress,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Selector:                labelSelector,
+		Owner:                   instanceName,
+		Allowlist:               principalAllowlist,
+		RequireCatalogedGroups:  requireCatalogedGroups,
+		ConflictPolicy:          v1beta1ctrl.ConflictPolicy(conflictPolicy),
+		BindableClusterRoles:    bindable,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MapRole")
 		os.Exit(1)
 	}
+	if err = (&v1beta1ctrl.NamespacedMapRoleReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrlruntime.Log.WithName("controllers").WithName("NamespacedMapRole"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("namespacedmaprole-controller"),
+		Approval: approvalChecker,
+		Backend:  backend,
+		Verifier: verifier,
+
+		AuditSink:               auditSink,
+		SizeMonitor:             sizeMonitor,
+		Progress:                progress,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Selector:                labelSelector,
+		Owner:                   instanceName,
+		Allowlist:               principalAllowlist,
+		RequireCatalogedGroups:  requireCatalogedGroups,
+		ConflictPolicy:          v1beta1ctrl.ConflictPolicy(conflictPolicy),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NamespacedMapRole")
+		os.Exit(1)
+	}
+	// Permission sets are only resolved, with the AWS credentials of the
+	// environment, once PermissionSetMapping objects exist.
+	permissionSetResolver, err := principal.NewIAMVerifier(&iamVerifierConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create permission set resolver")
+		os.Exit(1)
+	}
+	if err = (&v1beta1ctrl.PermissionSetMappingReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrlruntime.Log.WithName("controllers").WithName("PermissionSetMapping"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("permissionsetmapping-controller"),
+		Approval: approvalChecker,
+		Backend:  backend,
+		Resolver: permissionSetResolver,
+		Verifier: verifier,
+
+		AuditSink:               auditSink,
+		SizeMonitor:             sizeMonitor,
+		Progress:                progress,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Selector:                labelSelector,
+		Owner:                   instanceName,
+		Allowlist:               principalAllowlist,
+		RequireCatalogedGroups:  requireCatalogedGroups,
+		ConflictPolicy:          v1beta1ctrl.ConflictPolicy(conflictPolicy),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PermissionSetMapping")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		v1beta1api.SetupCreatorWebhookWithManager(mgr)
+		v1beta1api.SetupGroupCatalogWebhookWithManager(mgr, requireCatalogedGroups)
+		v1beta1api.SetupAllowlistWebhookWithManager(mgr, principalAllowlist)
+		if err = v1api.SetupConversionWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "conversion")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
+	if err := mgr.AddHealthzCheck("reconcile", progress.Check); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
 	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	// The aws-auth ConfigMap of the local cluster is only used by the configmap backend.
+	if awsauth.BackendType(backendType) == awsauth.ConfigMapBackend {
+		kubeClient, err := kube.GetClient()
+		if err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("aws-auth", health.AuthMapCheck(kubeClient)); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("aws-auth-update", health.AccessCheck(kubeClient, "update")); err != nil {
+			setupLog.Error(err, "unable to set up ready check")
+			os.Exit(1)
+		}
+
+		quarantine := &awsauth.QuarantineMonitor{
+			KubeClient: kubeClient,
+			Log:        ctrlruntime.Log.WithName("aws-auth-quarantine"),
+			Recorder:   mgr.GetEventRecorderFor("aws-auth-quarantine"),
+			Interval:   quarantineInterval,
+		}
+		metrics.Registry.MustRegister(quarantine)
+		if err := mgr.Add(quarantine); err != nil {
+			setupLog.Error(err, "unable to create quarantine monitor")
+			os.Exit(1)
+		}
+	}
+
+	if authoritative {
+		if awsauth.BackendType(backendType) != awsauth.ConfigMapBackend {
+			setupLog.Error(errors.New("--authoritative requires the configmap backend"), "unable to create pruner")
+			os.Exit(1)
+		}
+		if baselinePath != "" {
+			if pruner.Baseline, err = awsauth.LoadBaseline(baselinePath); err != nil {
+				setupLog.Error(err, "unable to load protected baseline")
+				os.Exit(1)
+			}
+		}
+		if pruner.KubeClient, err = kube.GetClient(); err != nil {
+			setupLog.Error(err, "unable to create pruner")
+			os.Exit(1)
+		}
+		pruner.Reader = mgr.GetAPIReader()
+		pruner.Log = ctrlruntime.Log.WithName("pruner")
+		pruner.Recorder = mgr.GetEventRecorderFor("aws-auth-pruner")
+		pruner.AuditSink = auditSink
+		pruner.SizeMonitor = sizeMonitor
+		pruner.Owner = instanceName
+		if err := mgr.Add(&pruner); err != nil {
+			setupLog.Error(err, "unable to create pruner")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrlruntime.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
+		shutdownTracing(context.Background())
 		os.Exit(1)
 	}
 }
+
+// migrateToAccessEntries migrates the aws-auth ConfigMap entries of the local
+// cluster to EKS access entries, and prints the report.
+func migrateToAccessEntries(cfg *awsauth.EKSBackendConfig, opts awsauth.MigrationOptions) error {
+	kubeClient, err := kube.GetClient()
+	if err != nil {
+		return err
+	}
+	backend, err := awsauth.NewEKSBackend(cfg)
+	if err != nil {
+		return err
+	}
+	report, err := awsauth.Migrate(context.Background(), kubeClient, backend, opts)
+	if report != nil {
+		setupLog.Info("migrated to access entries", "report", report.String())
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	}
+	return err
+}
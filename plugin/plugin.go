@@ -0,0 +1,357 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements the kubectl aws-auth plugin, resolving the
+// Kubernetes identity AWS IAM principals are mapped to by the aws-auth
+// ConfigMap, the custom resources managing those mappings, and the access
+// Kubernetes RBAC grants them.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// UnmanagedSource is the source of aws-auth entries no custom resource
+// manages.
+const UnmanagedSource = "unmanaged"
+
+// authenticatedGroup is the group the API server adds to every authenticated
+// user.
+const authenticatedGroup = "system:authenticated"
+
+// ErrNotMapped indicates a principal is not mapped by the aws-auth ConfigMap.
+var ErrNotMapped = errors.New("principal is not mapped in aws-auth")
+
+// Identity is the Kubernetes identity an aws-auth entry maps a principal to.
+type Identity struct {
+	// ARN is the principal ARN of the aws-auth entry.
+	ARN string `json:"arn"`
+
+	// Type is the type of the aws-auth entry, mapRole or mapUser.
+	Type awsauth.DataType `json:"type"`
+
+	// Username is the Kubernetes username of the principal.
+	Username string `json:"username"`
+
+	// Groups are the Kubernetes groups of the principal.
+	Groups []string `json:"groups"`
+
+	// Source is the custom resource managing the aws-auth entry, as
+	// <kind>/[<namespace>/]<name>, or UnmanagedSource if there is none.
+	Source string `json:"source"`
+
+	// Owner is the operator instance owning the aws-auth entry, if any.
+	Owner string `json:"owner,omitempty"`
+
+	// Description is the description of the custom resource managing the
+	// aws-auth entry, if any.
+	Description string `json:"description,omitempty"`
+
+	// Email is the contact email of the custom resource managing the aws-auth
+	// entry, if any.
+	Email string `json:"email,omitempty"`
+}
+
+// Managed returns whether a custom resource manages the aws-auth entry.
+func (id *Identity) Managed() bool {
+	return id.Source != UnmanagedSource
+}
+
+// Inspector resolves aws-auth identities in a cluster.
+type Inspector struct {
+	// Kubernetes reads the aws-auth ConfigMap and reviews access.
+	Kubernetes kubernetes.Interface
+
+	// Client looks up the custom resources managing aws-auth entries.
+	Client client.Client
+}
+
+// WhoAmI returns the identity the aws-auth ConfigMap maps the IAM role, IAM
+// user or assumed-role session ARN to, or ErrNotMapped if it maps none. Role
+// and assumed-role ARNs are matched against mapRoles, as the AWS IAM
+// authenticator does, without their path.
+func (i *Inspector) WhoAmI(ctx context.Context, principalARN string) (*Identity, error) {
+	parsed, err := arn.Parse(principalARN)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", awsauth.ErrInvalidARN, err)
+	}
+	canonical := parsed.Canonical().String()
+	authData, _, err := awsauth.ReadAuthMapWithContext(ctx, i.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	var id *Identity
+	if parsed.IsRole() {
+		for _, mapRole := range authData.MapRoles {
+			if strings.EqualFold(mapRole.RoleARN, canonical) {
+				id = &Identity{ARN: mapRole.RoleARN, Type: awsauth.MapRoleData, Username: mapRole.Username, Groups: mapRole.Groups}
+				break
+			}
+		}
+	} else {
+		for _, mapUser := range authData.MapUsers {
+			if strings.EqualFold(mapUser.UserARN, canonical) {
+				id = &Identity{ARN: mapUser.UserARN, Type: awsauth.MapUserData, Username: mapUser.Username, Groups: mapUser.Groups}
+				break
+			}
+		}
+	}
+	if id == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotMapped, principalARN)
+	}
+	if err := i.resolve(ctx, &authData, id); err != nil {
+		return nil, err
+	}
+	id.Username = renderUsername(id.Username, parsed)
+	return id, nil
+}
+
+// WhoCan returns the identities of every aws-auth entry mapping principals to
+// group.
+func (i *Inspector) WhoCan(ctx context.Context, group string) ([]*Identity, error) {
+	authData, _, err := awsauth.ReadAuthMapWithContext(ctx, i.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	return i.identities(ctx, &authData, func(groups []string) bool {
+		return hasGroup(groups, group)
+	})
+}
+
+// identities returns the resolved identities of the aws-auth entries whose
+// groups match.
+func (i *Inspector) identities(ctx context.Context, authData *awsauth.AwsAuthData, match func(groups []string) bool) ([]*Identity, error) {
+	var ids []*Identity
+	for _, mapRole := range authData.MapRoles {
+		if match(mapRole.Groups) {
+			ids = append(ids, &Identity{ARN: mapRole.RoleARN, Type: awsauth.MapRoleData, Username: mapRole.Username, Groups: mapRole.Groups})
+		}
+	}
+	for _, mapUser := range authData.MapUsers {
+		if match(mapUser.Groups) {
+			ids = append(ids, &Identity{ARN: mapUser.UserARN, Type: awsauth.MapUserData, Username: mapUser.Username, Groups: mapUser.Groups})
+		}
+	}
+	for _, id := range ids {
+		if err := i.resolve(ctx, authData, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// resolve sets the source, owner, description and email of the identity.
+func (i *Inspector) resolve(ctx context.Context, authData *awsauth.AwsAuthData, id *Identity) error {
+	id.Owner = authData.Owner(id.Type, id.Username)
+	kind, key, obj := sourceObject(id.Type, id.Username)
+	id.Source = UnmanagedSource
+	if obj == nil {
+		return nil
+	}
+	err := i.Client.Get(ctx, key, obj)
+	switch {
+	case err == nil:
+		id.Source = kind + "/" + key.Name
+		if key.Namespace != "" {
+			id.Source = kind + "/" + key.Namespace + "/" + key.Name
+		}
+		id.Description, id.Email = describe(obj)
+	case client.IgnoreNotFound(err) == nil, meta.IsNoMatchError(err):
+		// Neither the resource nor its definition is installed.
+	default:
+		return fmt.Errorf("failure getting %s %s: %w", kind, key, err)
+	}
+	return nil
+}
+
+// sourceObject returns the kind, key and type of the custom resource that
+// would manage the aws-auth entry keyed by username, or a nil object if no
+// custom resource could.
+func sourceObject(dataType awsauth.DataType, username string) (string, types.NamespacedName, client.Object) {
+	if dataType == awsauth.MapUserData {
+		if len(validation.IsDNS1123Subdomain(username)) > 0 {
+			return "", types.NamespacedName{}, nil
+		}
+		return "MapUser", types.NamespacedName{Name: username}, &v1beta1.MapUser{}
+	}
+	if name := strings.TrimPrefix(username, "permission-set:"); name != username {
+		if len(validation.IsDNS1123Subdomain(name)) > 0 {
+			return "", types.NamespacedName{}, nil
+		}
+		return "PermissionSetMapping", types.NamespacedName{Name: name}, &v1beta1.PermissionSetMapping{}
+	}
+	if namespacedName := strings.TrimPrefix(username, v1beta1.NamespacedUsernamePrefix); namespacedName != username {
+		namespace, name, _ := strings.Cut(namespacedName, ":")
+		if len(validation.IsDNS1123Label(namespace)) > 0 || len(validation.IsDNS1123Subdomain(name)) > 0 {
+			return "", types.NamespacedName{}, nil
+		}
+		return "NamespacedMapRole", types.NamespacedName{Namespace: namespace, Name: name}, &v1beta1.NamespacedMapRole{}
+	}
+	if len(validation.IsDNS1123Subdomain(username)) > 0 {
+		return "", types.NamespacedName{}, nil
+	}
+	return "MapRole", types.NamespacedName{Name: username}, &v1beta1.MapRole{}
+}
+
+// describe returns the description and contact email of a custom resource
+// returned by sourceObject.
+func describe(obj client.Object) (string, string) {
+	switch obj := obj.(type) {
+	case *v1beta1.MapRole:
+		return obj.Spec.Description, obj.Spec.Email
+	case *v1beta1.MapUser:
+		return obj.Spec.Description, obj.Spec.Email
+	case *v1beta1.NamespacedMapRole:
+		return obj.Spec.Description, obj.Spec.Email
+	case *v1beta1.PermissionSetMapping:
+		return obj.Spec.Description, obj.Spec.Email
+	}
+	return "", ""
+}
+
+// renderUsername renders the username template variables the AWS IAM
+// authenticator derives from the principal ARN. Variables that depend on the
+// node or credentials, such as {{EC2PrivateDNSName}}, are left as they are.
+func renderUsername(username string, principal arn.ARN) string {
+	username = strings.ReplaceAll(username, "{{AccountID}}", principal.AccountID)
+	if principal.ResourceType == arn.AssumedRole {
+		username = strings.ReplaceAll(username, "{{SessionNameRaw}}", principal.SessionName)
+		username = strings.ReplaceAll(username, "{{SessionName}}", strings.ReplaceAll(principal.SessionName, "@", "-"))
+	}
+	return username
+}
+
+// hasGroup returns whether groups contains group.
+func hasGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Check is a resource access reviewed for an identity.
+type Check struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// DefaultChecks are the accesses reviewed when none are given.
+var DefaultChecks = []Check{
+	{Verb: "*", Group: "*", Resource: "*"},
+	{Verb: "list", Resource: "namespaces"},
+	{Verb: "list", Resource: "nodes"},
+	{Verb: "get", Resource: "pods"},
+	{Verb: "create", Resource: "pods", Subresource: "exec"},
+	{Verb: "get", Resource: "secrets"},
+	{Verb: "create", Group: "apps", Resource: "deployments"},
+	{Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "rolebindings"},
+}
+
+// ParseCheck parses a check formatted as <verb>:<resource>[.<group>][/<subresource>],
+// such as get:pods, create:deployments.apps or create:pods/exec.
+func ParseCheck(s string) (Check, error) {
+	verb, resource, ok := strings.Cut(s, ":")
+	if !ok || verb == "" || resource == "" {
+		return Check{}, fmt.Errorf("malformed check %q, expected <verb>:<resource>[.<group>][/<subresource>]", s)
+	}
+	check := Check{Verb: verb}
+	resource, check.Subresource, _ = strings.Cut(resource, "/")
+	check.Resource, check.Group, _ = strings.Cut(resource, ".")
+	if check.Resource == "" {
+		return Check{}, fmt.Errorf("malformed check %q, expected <verb>:<resource>[.<group>][/<subresource>]", s)
+	}
+	return check, nil
+}
+
+// String returns the check formatted as ParseCheck parses it.
+func (c Check) String() string {
+	s := c.Verb + ":" + c.Resource
+	if c.Group != "" {
+		s += "." + c.Group
+	}
+	if c.Subresource != "" {
+		s += "/" + c.Subresource
+	}
+	return s
+}
+
+// AccessResult is the result of reviewing a check for an identity.
+type AccessResult struct {
+	Check   Check  `json:"check"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Access reviews the checks for the identity in namespace, or in all
+// namespaces if it is empty, with a SubjectAccessReview each.
+func (i *Inspector) Access(ctx context.Context, id *Identity, namespace string, checks []Check) ([]AccessResult, error) {
+	groups := append(append([]string{}, id.Groups...), authenticatedGroup)
+	results := make([]AccessResult, 0, len(checks))
+	for _, check := range checks {
+		review := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   id.Username,
+				Groups: groups,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        check.Verb,
+					Group:       check.Group,
+					Resource:    check.Resource,
+					Subresource: check.Subresource,
+				},
+			},
+		}
+		review, err := i.Kubernetes.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failure reviewing access %s: %w", check, err)
+		}
+		reason := review.Status.Reason
+		if review.Status.EvaluationError != "" {
+			reason = strings.TrimSpace(reason + " " + review.Status.EvaluationError)
+		}
+		results = append(results, AccessResult{Check: check, Allowed: review.Status.Allowed, Reason: reason})
+	}
+	return results, nil
+}
+
+// PruneCandidates returns the aws-auth entries an operator in authoritative
+// mode will prune, as it recorded them in the aws-auth ConfigMap.
+func (i *Inspector) PruneCandidates(ctx context.Context) ([]awsauth.PruneCandidate, error) {
+	_, cm, err := awsauth.ReadAuthMapWithContext(ctx, i.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	return awsauth.ReadPruneCandidates(cm)
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// newTestInspector returns an inspector of an aws-auth ConfigMap mapping
+// unmanaged nodes and admins, and roles managed by a MapRole, a
+// NamespacedMapRole and a PermissionSetMapping.
+func newTestInspector(g *gomega.WithT) *Inspector {
+	k := fake.NewSimpleClientset()
+	_, err := awsauth.CreateAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData, cm, err := awsauth.ReadAuthMap(k)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	authData.SetMapRoles([]*awsauth.MapRole{
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/node", "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"}),
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/ops", "ops", []string{"system:masters"}),
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/dev", "namespace:team-a:dev", []string{"team-a-devs"}),
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/AWSReservedSSO_Admins_0123456789abcdef", "permission-set:admins", []string{"system:masters"}),
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/ci", "ci:{{AccountID}}:{{SessionName}}", []string{"ci"}),
+	})
+	authData.SetMapUsers([]*awsauth.MapUser{
+		awsauth.NewMapUser("arn:aws:iam::000000000000:user/admin", "admin", []string{"system:masters"}),
+	})
+	authData.SetOwner(awsauth.MapRoleData, "ops", "shard-a")
+	g.Expect(awsauth.UpdateAuthMap(k, authData, cm)).To(gomega.Succeed())
+
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1beta1.MapRole{ObjectMeta: metav1.ObjectMeta{Name: "ops"}, Spec: v1beta1.MapRoleSpec{Description: "Operations team", Email: "ops@example.com"}},
+		&v1beta1.NamespacedMapRole{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "dev"}},
+		&v1beta1.PermissionSetMapping{ObjectMeta: metav1.ObjectMeta{Name: "admins"}},
+	).Build()
+	return &Inspector{Kubernetes: k, Client: c}
+}
+
+func TestInspector_WhoAmI(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newTestInspector(g)
+	ctx := context.Background()
+
+	tests := []struct {
+		arn  string
+		want Identity
+	}{
+		{
+			arn:  "arn:aws:iam::000000000000:role/ops",
+			want: Identity{ARN: "arn:aws:iam::000000000000:role/ops", Type: awsauth.MapRoleData, Username: "ops", Groups: []string{"system:masters"}, Source: "MapRole/ops", Owner: "shard-a", Description: "Operations team", Email: "ops@example.com"},
+		},
+		{
+			arn:  "arn:aws:sts::000000000000:assumed-role/dev/jane",
+			want: Identity{ARN: "arn:aws:iam::000000000000:role/dev", Type: awsauth.MapRoleData, Username: "namespace:team-a:dev", Groups: []string{"team-a-devs"}, Source: "NamespacedMapRole/team-a/dev"},
+		},
+		{
+			arn:  "arn:aws:iam::000000000000:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Admins_0123456789abcdef",
+			want: Identity{ARN: "arn:aws:iam::000000000000:role/AWSReservedSSO_Admins_0123456789abcdef", Type: awsauth.MapRoleData, Username: "permission-set:admins", Groups: []string{"system:masters"}, Source: "PermissionSetMapping/admins"},
+		},
+		{
+			arn:  "arn:aws:iam::000000000000:role/node",
+			want: Identity{ARN: "arn:aws:iam::000000000000:role/node", Type: awsauth.MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"system:bootstrappers", "system:nodes"}, Source: UnmanagedSource},
+		},
+		{
+			arn:  "arn:aws:sts::000000000000:assumed-role/ci/build@example.com",
+			want: Identity{ARN: "arn:aws:iam::000000000000:role/ci", Type: awsauth.MapRoleData, Username: "ci:000000000000:build-example.com", Groups: []string{"ci"}, Source: UnmanagedSource},
+		},
+		{
+			arn:  "arn:aws:iam::000000000000:user/admin",
+			want: Identity{ARN: "arn:aws:iam::000000000000:user/admin", Type: awsauth.MapUserData, Username: "admin", Groups: []string{"system:masters"}, Source: UnmanagedSource},
+		},
+	}
+	for _, tt := range tests {
+		id, err := inspector.WhoAmI(ctx, tt.arn)
+		g.Expect(err).NotTo(gomega.HaveOccurred(), tt.arn)
+		g.Expect(*id).To(gomega.Equal(tt.want), tt.arn)
+	}
+
+	_, err := inspector.WhoAmI(ctx, "arn:aws:iam::000000000000:user/ops")
+	g.Expect(errors.Is(err, ErrNotMapped)).To(gomega.BeTrue())
+	_, err = inspector.WhoAmI(ctx, "ops")
+	g.Expect(awsauth.IsInvalidARN(err)).To(gomega.BeTrue())
+}
+
+func TestInspector_WhoCan(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newTestInspector(g)
+
+	ids, err := inspector.WhoCan(context.Background(), "system:masters")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	var arns, sources []string
+	for _, id := range ids {
+		arns = append(arns, id.ARN)
+		sources = append(sources, id.Source)
+	}
+	g.Expect(arns).To(gomega.Equal([]string{
+		"arn:aws:iam::000000000000:role/ops",
+		"arn:aws:iam::000000000000:role/AWSReservedSSO_Admins_0123456789abcdef",
+		"arn:aws:iam::000000000000:user/admin",
+	}))
+	g.Expect(sources).To(gomega.Equal([]string{"MapRole/ops", "PermissionSetMapping/admins", UnmanagedSource}))
+
+	ids, err = inspector.WhoCan(context.Background(), "nobody")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ids).To(gomega.BeEmpty())
+}
+
+func TestInspector_Access(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newTestInspector(g)
+	var reviews []*authorizationv1.SubjectAccessReview
+	inspector.Kubernetes.(*fake.Clientset).PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, pkgruntime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		reviews = append(reviews, review)
+		review = review.DeepCopy()
+		if review.Spec.ResourceAttributes.Resource == "pods" {
+			review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: true, Reason: `RBAC: allowed by RoleBinding "dev/team-a"`}
+		}
+		return true, review, nil
+	})
+
+	id, err := inspector.WhoAmI(context.Background(), "arn:aws:iam::000000000000:role/dev")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	checks := []Check{{Verb: "get", Resource: "pods"}, {Verb: "get", Resource: "secrets"}}
+	results, err := inspector.Access(context.Background(), id, "team-a", checks)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(results).To(gomega.Equal([]AccessResult{
+		{Check: checks[0], Allowed: true, Reason: `RBAC: allowed by RoleBinding "dev/team-a"`},
+		{Check: checks[1], Allowed: false},
+	}))
+	g.Expect(reviews).To(gomega.HaveLen(2))
+	g.Expect(reviews[0].Spec.User).To(gomega.Equal("namespace:team-a:dev"))
+	g.Expect(reviews[0].Spec.Groups).To(gomega.Equal([]string{"team-a-devs", "system:authenticated"}))
+	g.Expect(reviews[0].Spec.ResourceAttributes.Namespace).To(gomega.Equal("team-a"))
+
+	var out bytes.Buffer
+	g.Expect(PrintIdentity(&out, id, results)).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.ContainSubstring("Source:    NamespacedMapRole/team-a/dev\n"))
+	g.Expect(out.String()).To(gomega.ContainSubstring("get:pods     yes"))
+}
+
+func TestParseCheck(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	tests := map[string]Check{
+		"get:pods":                             {Verb: "get", Resource: "pods"},
+		"create:deployments.apps":              {Verb: "create", Group: "apps", Resource: "deployments"},
+		"create:pods/exec":                     {Verb: "create", Resource: "pods", Subresource: "exec"},
+		"update:deployments.apps/scale":        {Verb: "update", Group: "apps", Resource: "deployments", Subresource: "scale"},
+		"*:*.*":                                {Verb: "*", Group: "*", Resource: "*"},
+		"bind:roles.rbac.authorization.k8s.io": {Verb: "bind", Group: "rbac.authorization.k8s.io", Resource: "roles"},
+	}
+	for s, want := range tests {
+		check, err := ParseCheck(s)
+		g.Expect(err).NotTo(gomega.HaveOccurred(), s)
+		g.Expect(check).To(gomega.Equal(want), s)
+		g.Expect(check.String()).To(gomega.Equal(s))
+	}
+
+	for _, s := range []string{"", "get", "get:", ":pods", "get:.apps"} {
+		_, err := ParseCheck(s)
+		g.Expect(err).To(gomega.HaveOccurred(), s)
+	}
+}
+
+func TestInspector_PruneCandidates(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newTestInspector(g)
+	ctx := context.Background()
+
+	candidates, err := inspector.PruneCandidates(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(candidates).To(gomega.BeEmpty())
+
+	since := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := []awsauth.PruneCandidate{{
+		Entry:      awsauth.Entry{DataType: awsauth.MapUserData, Username: "admin", ARN: "arn:aws:iam::000000000000:user/admin", Groups: []string{"system:masters"}},
+		Since:      since,
+		PruneAfter: since.Add(24 * time.Hour),
+	}}
+	g.Expect(awsauth.WritePruneCandidates(ctx, inspector.Kubernetes, want)).To(gomega.Succeed())
+	candidates, err = inspector.PruneCandidates(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(candidates).To(gomega.Equal(want))
+
+	var out bytes.Buffer
+	g.Expect(PrintPruneCandidates(&out, candidates)).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.ContainSubstring("arn:aws:iam::000000000000:user/admin  mapUser  admin     system:masters  2021-06-01T12:00:00Z  2021-06-02T12:00:00Z"))
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// PrintIdentity writes the identity and the results of its access checks as
+// aligned text.
+func PrintIdentity(w io.Writer, id *Identity, access []AccessResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ARN:\t%s\n", id.ARN)
+	fmt.Fprintf(tw, "Type:\t%s\n", id.Type)
+	fmt.Fprintf(tw, "Username:\t%s\n", id.Username)
+	fmt.Fprintf(tw, "Groups:\t%s\n", joinOrNone(id.Groups))
+	fmt.Fprintf(tw, "Source:\t%s\n", id.Source)
+	if id.Owner != "" {
+		fmt.Fprintf(tw, "Owner:\t%s\n", id.Owner)
+	}
+	if id.Description != "" {
+		fmt.Fprintf(tw, "Description:\t%s\n", id.Description)
+	}
+	if id.Email != "" {
+		fmt.Fprintf(tw, "Contact:\t%s\n", id.Email)
+	}
+	if len(access) > 0 {
+		fmt.Fprintf(tw, "\nACCESS\tALLOWED\tREASON\n")
+		for _, result := range access {
+			allowed := "no"
+			if result.Allowed {
+				allowed = "yes"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Check, allowed, result.Reason)
+		}
+	}
+	return tw.Flush()
+}
+
+// PrintIdentities writes the identities as an aligned table.
+func PrintIdentities(w io.Writer, ids []*Identity) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ARN\tTYPE\tUSERNAME\tGROUPS\tSOURCE\n")
+	for _, id := range ids {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", id.ARN, id.Type, id.Username, joinOrNone(id.Groups), id.Source)
+	}
+	return tw.Flush()
+}
+
+// joinOrNone joins values with commas, or returns <none> if there are none.
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	return strings.Join(values, ",")
+}
+
+// PrintPruneCandidates writes the prune candidates as an aligned table.
+func PrintPruneCandidates(w io.Writer, candidates []awsauth.PruneCandidate) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ARN\tTYPE\tUSERNAME\tGROUPS\tUNDECLARED SINCE\tPRUNE AFTER\n")
+	for _, c := range candidates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ARN, c.DataType, c.Username, joinOrNone(c.Groups), c.Since.Format(time.RFC3339), c.PruneAfter.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// PrintRepairResult writes the outcome of a repair.
+func PrintRepairResult(w io.Writer, result *RepairResult, dryRun bool) error {
+	if result.Malformed != "" {
+		fmt.Fprintf(w, "%s/%s was %s\n", awsauth.ConfigMapNamespace, awsauth.ConfigMapName, result.Malformed)
+	}
+	if dryRun {
+		fmt.Fprintf(w, "%s/%s would be rebuilt with:\n", awsauth.ConfigMapNamespace, awsauth.ConfigMapName)
+	} else {
+		fmt.Fprintf(w, "%s/%s was backed up to %s and rebuilt with:\n", awsauth.ConfigMapNamespace, awsauth.ConfigMapName, result.Backup)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ARN\tTYPE\tUSERNAME\tGROUPS\n")
+	for _, entry := range result.Entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.ARN, entry.DataType, entry.Username, joinOrNone(entry.Groups))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !dryRun {
+		fmt.Fprintf(w, "Requeued %d mappings to rewrite their entries.\n", len(result.Requeued))
+	}
+	return nil
+}
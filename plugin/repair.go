@@ -0,0 +1,211 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+// RepairOptions are the options of Inspector.Repair.
+type RepairOptions struct {
+	// Baseline lists entries written along with those of the mappings, such
+	// as those of node roles.
+	Baseline awsauth.AwsAuthData
+
+	// Force rebuilds the aws-auth ConfigMap even if it is not malformed,
+	// dropping the entries declared by no mapping.
+	Force bool
+
+	// DryRun only returns the entries the aws-auth ConfigMap would be rebuilt
+	// with.
+	DryRun bool
+}
+
+// RepairResult is the outcome of Inspector.Repair.
+type RepairResult struct {
+	// Malformed is the error in the aws-auth ConfigMap before it was
+	// repaired, if any.
+	Malformed string `json:"malformed,omitempty"`
+
+	// Entries are the entries the aws-auth ConfigMap was rebuilt with.
+	Entries []awsauth.Entry `json:"entries"`
+
+	// Requeued are the mappings requeued to rewrite their entries, as
+	// <kind>/[<namespace>/]<name>.
+	Requeued []string `json:"requeued,omitempty"`
+
+	// Backup is the ConfigMap preserving the raw data replaced.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Repair rebuilds the aws-auth ConfigMap from the mappings of the cluster.
+// Its raw data is backed up, and it is rewritten with the baseline entries and
+// those of the mappings present in aws-auth, as reported by their Active
+// condition. Every mapping is then requeued, by setting its
+// RepairedAtAnnotation, so that the operator rewrites its entry exactly.
+// Unless forced, only a malformed ConfigMap is repaired.
+func (i *Inspector) Repair(ctx context.Context, opts RepairOptions) (*RepairResult, error) {
+	result := &RepairResult{Entries: []awsauth.Entry{}}
+	_, _, err := awsauth.ReadAuthMapWithContext(ctx, i.Kubernetes)
+	switch {
+	case awsauth.IsMalformed(err):
+		result.Malformed = err.Error()
+	case err != nil:
+		return nil, err
+	case !opts.Force:
+		return nil, fmt.Errorf("%s/%s ConfigMap is not malformed, force the repair to rebuild it anyway", awsauth.ConfigMapNamespace, awsauth.ConfigMapName)
+	}
+
+	authData, mappings, err := i.declaredAuthData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range opts.Baseline.Entries() {
+		if !containsEntry(&authData, entry) {
+			if entry.DataType == awsauth.MapRoleData {
+				authData.MapRoles = append(authData.MapRoles, awsauth.NewMapRole(entry.ARN, entry.Username, entry.Groups))
+			} else {
+				authData.MapUsers = append(authData.MapUsers, awsauth.NewMapUser(entry.ARN, entry.Username, entry.Groups))
+			}
+		}
+	}
+	result.Entries = append(result.Entries, authData.Entries()...)
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if err := awsauth.RepairAuthMap(ctx, i.Kubernetes, authData); err != nil {
+		return nil, err
+	}
+	result.Backup = awsauth.ConfigMapNamespace + "/" + awsauth.BackupConfigMapName
+
+	repairedAt := time.Now().UTC().Format(time.RFC3339)
+	for _, obj := range mappings {
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[v1beta1.RepairedAtAnnotation] = repairedAt
+		obj.SetAnnotations(annotations)
+		if err := i.Client.Patch(ctx, obj, patch); err != nil {
+			return result, fmt.Errorf("failure requeueing %s: %w", mappingName(obj), err)
+		}
+		result.Requeued = append(result.Requeued, mappingName(obj))
+	}
+	return result, nil
+}
+
+// declaredAuthData returns the entries of the mappings of the cluster present
+// in its aws-auth ConfigMap, and every mapping.
+func (i *Inspector) declaredAuthData(ctx context.Context) (awsauth.AwsAuthData, []client.Object, error) {
+	var authData awsauth.AwsAuthData
+	var mappings []client.Object
+
+	var mapRoles v1beta1.MapRoleList
+	if err := i.Client.List(ctx, &mapRoles); err != nil {
+		return authData, nil, err
+	}
+	for j := range mapRoles.Items {
+		mapRole := &mapRoles.Items[j]
+		mappings = append(mappings, mapRole)
+		// Mappings with a cluster selector are synced to managed clusters.
+		if mapRole.Spec.ClusterSelector == nil && meta.IsStatusConditionTrue(mapRole.Status.Conditions, v1beta1.ConditionActive) {
+			if roleARN, _, err := awsauth.NormalizeARN(awsauth.MapRoleData, mapRole.Spec.RoleARN); err == nil {
+				authData.MapRoles = append(authData.MapRoles, awsauth.NewMapRole(roleARN, mapRole.Name, mapRole.Spec.Groups))
+			}
+		}
+	}
+	var namespacedMapRoles v1beta1.NamespacedMapRoleList
+	if err := i.Client.List(ctx, &namespacedMapRoles); err != nil {
+		return authData, nil, err
+	}
+	for j := range namespacedMapRoles.Items {
+		mapRole := &namespacedMapRoles.Items[j]
+		mappings = append(mappings, mapRole)
+		if meta.IsStatusConditionTrue(mapRole.Status.Conditions, v1beta1.ConditionActive) {
+			if roleARN, _, err := awsauth.NormalizeARN(awsauth.MapRoleData, mapRole.Spec.RoleARN); err == nil {
+				authData.MapRoles = append(authData.MapRoles, awsauth.NewMapRole(roleARN, mapRole.Username(), mapRole.Spec.Groups))
+			}
+		}
+	}
+	var permissionSetMappings v1beta1.PermissionSetMappingList
+	if err := i.Client.List(ctx, &permissionSetMappings); err != nil {
+		return authData, nil, err
+	}
+	for j := range permissionSetMappings.Items {
+		mapping := &permissionSetMappings.Items[j]
+		mappings = append(mappings, mapping)
+		if mapping.Status.RoleARN != "" && meta.IsStatusConditionTrue(mapping.Status.Conditions, v1beta1.ConditionActive) {
+			authData.MapRoles = append(authData.MapRoles, awsauth.NewMapRole(mapping.Status.RoleARN, mapping.Username(), mapping.Spec.Groups))
+		}
+	}
+	var mapUsers v1beta1.MapUserList
+	if err := i.Client.List(ctx, &mapUsers); err != nil {
+		return authData, nil, err
+	}
+	for j := range mapUsers.Items {
+		mapUser := &mapUsers.Items[j]
+		mappings = append(mappings, mapUser)
+		if mapUser.Spec.ClusterSelector == nil && meta.IsStatusConditionTrue(mapUser.Status.Conditions, v1beta1.ConditionActive) {
+			if userARN, _, err := awsauth.NormalizeARN(awsauth.MapUserData, mapUser.Spec.UserARN); err == nil {
+				authData.MapUsers = append(authData.MapUsers, awsauth.NewMapUser(userARN, mapUser.Name, mapUser.Spec.Groups))
+			}
+		}
+	}
+	return authData, mappings, nil
+}
+
+// containsEntry returns whether the auth map has an entry with the principal
+// ARN or the username of entry.
+func containsEntry(authData *awsauth.AwsAuthData, entry awsauth.Entry) bool {
+	for _, e := range authData.Entries() {
+		if e.DataType == entry.DataType && (e.Username == entry.Username || strings.EqualFold(e.ARN, entry.ARN)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mappingName returns the kind, namespace and name of a mapping as
+// <kind>/[<namespace>/]<name>.
+func mappingName(obj client.Object) string {
+	var kind string
+	switch obj.(type) {
+	case *v1beta1.MapRole:
+		kind = "MapRole"
+	case *v1beta1.MapUser:
+		kind = "MapUser"
+	case *v1beta1.NamespacedMapRole:
+		kind = "NamespacedMapRole"
+	case *v1beta1.PermissionSetMapping:
+		kind = "PermissionSetMapping"
+	}
+	if obj.GetNamespace() != "" {
+		return kind + "/" + obj.GetNamespace() + "/" + obj.GetName()
+	}
+	return kind + "/" + obj.GetName()
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sambatv/aws-auth-operator/apis/v1beta1"
+	"github.com/sambatv/aws-auth-operator/awsauth"
+)
+
+var activeStatus = []metav1.Condition{{Type: v1beta1.ConditionActive, Status: metav1.ConditionTrue, Reason: "Synced", LastTransitionTime: metav1.Now()}}
+
+// newRepairInspector returns an inspector of a malformed aws-auth ConfigMap
+// and of mappings, some of which are not present in aws-auth.
+func newRepairInspector(g *gomega.WithT) *Inspector {
+	k := fake.NewSimpleClientset(&kcorev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: awsauth.ConfigMapName, Namespace: awsauth.ConfigMapNamespace},
+		Data: map[string]string{
+			"mapRoles": "- rolearn: arn:aws:iam::000000000000:role/ops\n  username: ops\n  groups: [system:masters\n",
+		},
+	})
+	scheme := pkgruntime.NewScheme()
+	g.Expect(v1beta1.AddToScheme(scheme)).To(gomega.Succeed())
+	c := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1beta1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops"},
+			Spec:       v1beta1.MapRoleSpec{RoleARN: "arn:aws:iam::000000000000:role/ops", Groups: []string{"system:masters"}},
+			Status:     v1beta1.MapRoleStatus{Conditions: activeStatus},
+		},
+		&v1beta1.MapRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+			Spec:       v1beta1.MapRoleSpec{RoleARN: "arn:aws:iam::000000000000:role/pending", Groups: []string{"view"}},
+		},
+		&v1beta1.MapUser{
+			ObjectMeta: metav1.ObjectMeta{Name: "remote"},
+			Spec: v1beta1.MapUserSpec{
+				UserARN:         "arn:aws:iam::000000000000:user/remote",
+				Groups:          []string{"view"},
+				ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			},
+			Status: v1beta1.MapUserStatus{Conditions: activeStatus},
+		},
+		&v1beta1.PermissionSetMapping{
+			ObjectMeta: metav1.ObjectMeta{Name: "admins"},
+			Spec:       v1beta1.PermissionSetMappingSpec{Groups: []string{"system:masters"}},
+			Status: v1beta1.PermissionSetMappingStatus{
+				RoleARN:    "arn:aws:iam::000000000000:role/AWSReservedSSO_Admins_0123456789abcdef",
+				Conditions: activeStatus,
+			},
+		},
+	).Build()
+	return &Inspector{Kubernetes: k, Client: c}
+}
+
+var repairBaseline = awsauth.AwsAuthData{
+	MapRoles: []*awsauth.MapRole{
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/node", "system:node:{{EC2PrivateDNSName}}", []string{"system:bootstrappers", "system:nodes"}),
+		// Already declared by a mapping.
+		awsauth.NewMapRole("arn:aws:iam::000000000000:role/ops", "ops", []string{"view"}),
+	},
+}
+
+func TestInspector_Repair(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newRepairInspector(g)
+	ctx := context.Background()
+	_, original, _ := awsauth.ReadAuthMapWithContext(ctx, inspector.Kubernetes)
+
+	result, err := inspector.Repair(ctx, RepairOptions{Baseline: repairBaseline})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	want := []awsauth.Entry{
+		{DataType: awsauth.MapRoleData, Username: "ops", ARN: "arn:aws:iam::000000000000:role/ops", Groups: []string{"system:masters"}},
+		{DataType: awsauth.MapRoleData, Username: "permission-set:admins", ARN: "arn:aws:iam::000000000000:role/AWSReservedSSO_Admins_0123456789abcdef", Groups: []string{"system:masters"}},
+		{DataType: awsauth.MapRoleData, Username: "system:node:{{EC2PrivateDNSName}}", ARN: "arn:aws:iam::000000000000:role/node", Groups: []string{"system:bootstrappers", "system:nodes"}},
+	}
+	g.Expect(result.Malformed).To(gomega.HavePrefix("malformed aws-auth data: mapRoles line 3:"))
+	g.Expect(result.Entries).To(gomega.Equal(want))
+	g.Expect(result.Backup).To(gomega.Equal("kube-system/aws-auth-quarantine"))
+	g.Expect(result.Requeued).To(gomega.ConsistOf("MapRole/ops", "MapRole/pending", "MapUser/remote", "PermissionSetMapping/admins"))
+
+	authData, _, err := awsauth.ReadAuthMapWithContext(ctx, inspector.Kubernetes)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(authData.Entries()).To(gomega.ConsistOf(want))
+	backup, err := inspector.Kubernetes.CoreV1().ConfigMaps(awsauth.ConfigMapNamespace).Get(ctx, awsauth.BackupConfigMapName, metav1.GetOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(backup.Data).To(gomega.Equal(original.Data))
+
+	var mapRole v1beta1.MapRole
+	g.Expect(inspector.Client.Get(ctx, types.NamespacedName{Name: "pending"}, &mapRole)).To(gomega.Succeed())
+	g.Expect(mapRole.Annotations).To(gomega.HaveKey(v1beta1.RepairedAtAnnotation))
+
+	// A healthy ConfigMap is only rebuilt when forced.
+	_, err = inspector.Repair(ctx, RepairOptions{})
+	g.Expect(err).To(gomega.MatchError("kube-system/aws-auth ConfigMap is not malformed, force the repair to rebuild it anyway"))
+	result, err = inspector.Repair(ctx, RepairOptions{Force: true})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Malformed).To(gomega.BeEmpty())
+	g.Expect(result.Entries).To(gomega.HaveLen(2))
+}
+
+func TestInspector_Repair_DryRun(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newRepairInspector(g)
+	ctx := context.Background()
+	_, original, _ := awsauth.ReadAuthMapWithContext(ctx, inspector.Kubernetes)
+
+	result, err := inspector.Repair(ctx, RepairOptions{Baseline: repairBaseline, DryRun: true})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Entries).To(gomega.HaveLen(3))
+	g.Expect(result.Backup).To(gomega.BeEmpty())
+	g.Expect(result.Requeued).To(gomega.BeEmpty())
+
+	_, cm, err := awsauth.ReadAuthMapWithContext(ctx, inspector.Kubernetes)
+	g.Expect(awsauth.IsMalformed(err)).To(gomega.BeTrue())
+	g.Expect(cm.Data).To(gomega.Equal(original.Data))
+	_, err = inspector.Kubernetes.CoreV1().ConfigMaps(awsauth.ConfigMapNamespace).Get(ctx, awsauth.BackupConfigMapName, metav1.GetOptions{})
+	g.Expect(err).To(gomega.HaveOccurred())
+}
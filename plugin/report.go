@@ -0,0 +1,202 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sambatv/aws-auth-operator/awsauth"
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// ReportFormat is the format of an access-review report.
+type ReportFormat string
+
+const (
+	// CSVReport formats reports as CSV with a header row.
+	CSVReport ReportFormat = "csv"
+
+	// JSONReport formats reports as a JSON array.
+	JSONReport ReportFormat = "json"
+
+	// MarkdownReport formats reports as a Markdown table.
+	MarkdownReport ReportFormat = "markdown"
+)
+
+// ReportEntry is the access of an IAM principal mapped by an aws-auth entry.
+type ReportEntry struct {
+	*Identity
+
+	// Account is the AWS account ID of the principal.
+	Account string `json:"account"`
+
+	// Managed is whether a custom resource manages the aws-auth entry.
+	Managed bool `json:"managed"`
+
+	// ClusterRoles are the ClusterRoles bound to the username or groups of
+	// the principal by ClusterRoleBindings.
+	ClusterRoles []string `json:"clusterRoles"`
+
+	// Roles are the roles bound to the username or groups of the principal in
+	// namespaces by RoleBindings, as <namespace>/<kind>/<name>.
+	Roles []string `json:"roles"`
+}
+
+// Report returns the access of every IAM principal mapped by the aws-auth
+// ConfigMap: its groups, the roles bound to its username and groups, and the
+// metadata of the custom resource managing it.
+func (i *Inspector) Report(ctx context.Context) ([]*ReportEntry, error) {
+	authData, _, err := awsauth.ReadAuthMapWithContext(ctx, i.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := i.identities(ctx, &authData, func([]string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	crbs, err := i.Kubernetes.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failure listing ClusterRoleBindings: %w", err)
+	}
+	rbs, err := i.Kubernetes.RbacV1().RoleBindings(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failure listing RoleBindings: %w", err)
+	}
+
+	entries := make([]*ReportEntry, 0, len(ids))
+	for _, id := range ids {
+		entry := &ReportEntry{Identity: id, Managed: id.Managed(), ClusterRoles: []string{}, Roles: []string{}}
+		if parsed, err := arn.Parse(id.ARN); err == nil {
+			entry.Account = parsed.AccountID
+		}
+		for _, crb := range crbs.Items {
+			if bindsIdentity(crb.Subjects, id) {
+				entry.ClusterRoles = appendUnique(entry.ClusterRoles, crb.RoleRef.Name)
+			}
+		}
+		for _, rb := range rbs.Items {
+			if bindsIdentity(rb.Subjects, id) {
+				entry.Roles = appendUnique(entry.Roles, rb.Namespace+"/"+rb.RoleRef.Kind+"/"+rb.RoleRef.Name)
+			}
+		}
+		sort.Strings(entry.ClusterRoles)
+		sort.Strings(entry.Roles)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// bindsIdentity returns whether the subjects of a binding include the
+// username or a group of the identity.
+func bindsIdentity(subjects []rbacv1.Subject, id *Identity) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind:
+			if subject.Name == id.Username {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if hasGroup(id.Groups, subject.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendUnique appends value to values unless it is already present.
+func appendUnique(values []string, value string) []string {
+	if hasGroup(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// reportColumns are the column headers of CSV and Markdown reports.
+var reportColumns = []string{"Principal", "Account", "Type", "Username", "Groups", "ClusterRoles", "Roles", "Managed", "Source", "Owner", "Description", "Contact"}
+
+// row returns the cells of the entry in CSV and Markdown reports.
+func (e *ReportEntry) row() []string {
+	return []string{
+		e.ARN,
+		e.Account,
+		string(e.Type),
+		e.Username,
+		strings.Join(e.Groups, ", "),
+		strings.Join(e.ClusterRoles, ", "),
+		strings.Join(e.Roles, ", "),
+		strconv.FormatBool(e.Managed),
+		e.Source,
+		e.Owner,
+		e.Description,
+		e.Email,
+	}
+}
+
+// WriteReport writes the report entries in the format.
+func WriteReport(w io.Writer, entries []*ReportEntry, format ReportFormat) error {
+	switch format {
+	case CSVReport:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(reportColumns); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := cw.Write(entry.row()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case JSONReport:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case MarkdownReport:
+		var b strings.Builder
+		b.WriteString("| " + strings.Join(reportColumns, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat(" --- |", len(reportColumns)) + "\n")
+		for _, entry := range entries {
+			cells := entry.row()
+			for j, cell := range cells {
+				cells[j] = markdownCell(cell)
+			}
+			b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("unsupported report format %q", format)
+}
+
+// markdownEscaper escapes the Markdown table syntax in cell values.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+// markdownCell returns the value escaped for a Markdown table cell.
+func markdownCell(value string) string {
+	return markdownEscaper.Replace(value)
+}
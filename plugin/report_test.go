@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInspector_Report(t *testing.T) {
+	g := gomega.NewWithT(t)
+	inspector := newTestInspector(g)
+	ctx := context.Background()
+	rbac := inspector.Kubernetes.RbacV1()
+	_, err := rbac.ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "system:masters"}},
+	}, metav1.CreateOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = rbac.RoleBindings("team-a").Create(ctx, &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "devs"},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "edit"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "team-a-devs"}},
+	}, metav1.CreateOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, err = rbac.RoleBindings("team-a").Create(ctx, &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "ops"},
+		RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "viewer"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "ops"}, {Kind: rbacv1.GroupKind, Name: "system:masters"}},
+	}, metav1.CreateOptions{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	entries, err := inspector.Report(ctx)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(entries).To(gomega.HaveLen(6))
+
+	ops := entries[1]
+	g.Expect(ops.ARN).To(gomega.Equal("arn:aws:iam::000000000000:role/ops"))
+	g.Expect(ops.Account).To(gomega.Equal("000000000000"))
+	g.Expect(ops.Managed).To(gomega.BeTrue())
+	g.Expect(ops.ClusterRoles).To(gomega.Equal([]string{"cluster-admin"}))
+	g.Expect(ops.Roles).To(gomega.Equal([]string{"team-a/Role/viewer"}))
+	g.Expect(ops.Email).To(gomega.Equal("ops@example.com"))
+
+	dev := entries[2]
+	g.Expect(dev.Managed).To(gomega.BeTrue())
+	g.Expect(dev.ClusterRoles).To(gomega.BeEmpty())
+	g.Expect(dev.Roles).To(gomega.Equal([]string{"team-a/ClusterRole/edit"}))
+
+	admin := entries[5]
+	g.Expect(admin.Type).To(gomega.BeEquivalentTo("mapUser"))
+	g.Expect(admin.Managed).To(gomega.BeFalse())
+	g.Expect(admin.ClusterRoles).To(gomega.Equal([]string{"cluster-admin"}))
+	g.Expect(admin.Roles).To(gomega.Equal([]string{"team-a/Role/viewer"}))
+
+	var out bytes.Buffer
+	g.Expect(WriteReport(&out, entries, CSVReport)).To(gomega.Succeed())
+	records, err := csv.NewReader(&out).ReadAll()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(records).To(gomega.HaveLen(7))
+	g.Expect(records[0]).To(gomega.Equal(reportColumns))
+	g.Expect(records[2]).To(gomega.Equal([]string{
+		"arn:aws:iam::000000000000:role/ops", "000000000000", "mapRole", "ops", "system:masters",
+		"cluster-admin", "team-a/Role/viewer", "true", "MapRole/ops", "shard-a", "Operations team", "ops@example.com",
+	}))
+
+	out.Reset()
+	g.Expect(WriteReport(&out, entries, JSONReport)).To(gomega.Succeed())
+	var decoded []map[string]interface{}
+	g.Expect(json.Unmarshal(out.Bytes(), &decoded)).To(gomega.Succeed())
+	g.Expect(decoded).To(gomega.HaveLen(6))
+	g.Expect(decoded[1]).To(gomega.HaveKeyWithValue("arn", "arn:aws:iam::000000000000:role/ops"))
+	g.Expect(decoded[1]).To(gomega.HaveKeyWithValue("managed", true))
+	g.Expect(decoded[0]).To(gomega.HaveKeyWithValue("roles", []interface{}{}))
+
+	out.Reset()
+	g.Expect(WriteReport(&out, entries, MarkdownReport)).To(gomega.Succeed())
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	g.Expect(lines).To(gomega.HaveLen(8))
+	g.Expect(lines[0]).To(gomega.HavePrefix("| Principal | Account |"))
+	g.Expect(lines[3]).To(gomega.Equal("| arn:aws:iam::000000000000:role/ops | 000000000000 | mapRole | ops | system:masters | cluster-admin | team-a/Role/viewer | true | MapRole/ops | shard-a | Operations team | ops@example.com |"))
+
+	g.Expect(WriteReport(&out, entries, "xml")).To(gomega.HaveOccurred())
+}
+
+func TestMarkdownCell(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(markdownCell("a|b\nc")).To(gomega.Equal(`a\|b c`))
+}
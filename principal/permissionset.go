@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package principal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// SSORolePathPrefix is the IAM path prefix of the roles IAM Identity Center
+// provisions for permission sets.
+const SSORolePathPrefix = "/aws-reserved/sso.amazonaws.com/"
+
+// PermissionSetResolver looks up the roles IAM Identity Center provisions for
+// permission sets, named AWSReservedSSO_<permission set>_<random suffix>.
+type PermissionSetResolver interface {
+	// PermissionSetRoleARN returns the ARN of the role provisioned for the
+	// permission set in the account, or ErrNotFound if there is none.
+	PermissionSetRoleARN(ctx context.Context, accountID, permissionSetName string) (string, error)
+}
+
+// PermissionSetRoleARN returns the ARN of the role provisioned for the
+// permission set in the account. Only roles of the account of the credentials
+// are listed.
+func (v *IAMVerifier) PermissionSetRoleARN(ctx context.Context, accountID, permissionSetName string) (string, error) {
+	var roleARNs []string
+	err := v.Client.ListRolesPagesWithContext(ctx, &iam.ListRolesInput{PathPrefix: aws.String(SSORolePathPrefix)}, func(out *iam.ListRolesOutput, _ bool) bool {
+		for _, role := range out.Roles {
+			roleARNs = append(roleARNs, aws.StringValue(role.Arn))
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	return StaticRoles(roleARNs).PermissionSetRoleARN(ctx, accountID, permissionSetName)
+}
+
+// StaticRoles is a PermissionSetResolver resolving permission sets to the
+// role ARNs it holds, standing in for IAM in tests and local development.
+type StaticRoles []string
+
+// PermissionSetRoleARN returns the role ARN provisioned for the permission
+// set in the account.
+func (s StaticRoles) PermissionSetRoleARN(_ context.Context, accountID, permissionSetName string) (string, error) {
+	var matches []string
+	for _, roleARN := range s {
+		parsed, err := arn.Parse(roleARN)
+		if err != nil || parsed.ResourceType != arn.Role || parsed.AccountID != accountID {
+			continue
+		}
+		if IsPermissionSetRole(parsed.Name, permissionSetName) {
+			matches = append(matches, roleARN)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: no role provisioned for permission set %s in account %s", ErrNotFound, permissionSetName, accountID)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("roles %s are all provisioned for permission set %s in account %s", strings.Join(matches, ", "), permissionSetName, accountID)
+	}
+}
+
+// IsPermissionSetRole returns whether roleName is the name of a role IAM
+// Identity Center provisions for the permission set.
+func IsPermissionSetRole(roleName, permissionSetName string) bool {
+	prefix := "AWSReservedSSO_" + permissionSetName + "_"
+	if !strings.HasPrefix(roleName, prefix) {
+		return false
+	}
+	suffix := roleName[len(prefix):]
+	return suffix != "" && !strings.Contains(suffix, "_")
+}
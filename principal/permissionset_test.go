@@ -0,0 +1,80 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package principal
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestIsPermissionSetRole(t *testing.T) {
+	g := gomega.NewWithT(t)
+	g.Expect(IsPermissionSetRole("AWSReservedSSO_AdministratorAccess_0123456789abcdef", "AdministratorAccess")).To(gomega.BeTrue())
+	g.Expect(IsPermissionSetRole("AWSReservedSSO_Read_Only_0123456789abcdef", "Read_Only")).To(gomega.BeTrue())
+	g.Expect(IsPermissionSetRole("AWSReservedSSO_Read_Only_0123456789abcdef", "Read")).To(gomega.BeFalse())
+	g.Expect(IsPermissionSetRole("AWSReservedSSO_AdministratorAccess_", "AdministratorAccess")).To(gomega.BeFalse())
+	g.Expect(IsPermissionSetRole("AdministratorAccess", "AdministratorAccess")).To(gomega.BeFalse())
+}
+
+func TestIAMVerifier_PermissionSetRoleARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	fake := &fakeIAM{roleARNs: []string{
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/us-east-1/AWSReservedSSO_AdministratorAccess_0123456789abcdef",
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_ReadOnly_fedcba9876543210",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	verifier, err := NewIAMVerifier(&IAMVerifierConfig{Endpoint: server.URL})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	ctx := context.Background()
+
+	roleARN, err := verifier.PermissionSetRoleARN(ctx, "123456789012", "AdministratorAccess")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(roleARN).To(gomega.Equal("arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/us-east-1/AWSReservedSSO_AdministratorAccess_0123456789abcdef"))
+	g.Expect(fake.listCalls).To(gomega.Equal([]string{SSORolePathPrefix}))
+
+	_, err = verifier.PermissionSetRoleARN(ctx, "123456789012", "PowerUserAccess")
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeTrue())
+
+	// Roles are only listed in the account of the credentials.
+	_, err = verifier.PermissionSetRoleARN(ctx, "999999999999", "AdministratorAccess")
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeTrue())
+}
+
+func TestStaticRoles_PermissionSetRoleARN(t *testing.T) {
+	g := gomega.NewWithT(t)
+	roles := StaticRoles{
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Admin_0123456789abcdef",
+		"arn:aws:iam::123456789012:role/aws-reserved/sso.amazonaws.com/eu-west-1/AWSReservedSSO_Admin_fedcba9876543210",
+	}
+
+	_, err := roles.PermissionSetRoleARN(context.Background(), "123456789012", "Admin")
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("are all provisioned for permission set Admin")))
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeFalse())
+
+	roleARN, err := roles[:1].PermissionSetRoleARN(context.Background(), "123456789012", "Admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(roleARN).To(gomega.Equal(roles[0]))
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package principal verifies that the AWS IAM principals of mappings exist,
+// looks up their unique IDs, and resolves the roles of IAM Identity Center
+// permission sets.
+package principal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+
+	"github.com/sambatv/aws-auth-operator/awsauth/arn"
+)
+
+// ErrNotFound is returned by a Verifier when a principal does not exist.
+var ErrNotFound = errors.New("IAM principal not found")
+
+// ErrUnverifiable is returned by a Verifier when a principal cannot be looked
+// up, such as a principal of another AWS account.
+var ErrUnverifiable = errors.New("IAM principal cannot be verified")
+
+// Verifier looks up IAM principals by ARN.
+type Verifier interface {
+	// UniqueID returns the unique ID of the IAM role or user with the ARN,
+	// such as AROA... for roles and AIDA... for users, ErrNotFound if it
+	// does not exist, or ErrUnverifiable if it cannot be looked up.
+	UniqueID(ctx context.Context, principalARN string) (string, error)
+}
+
+// IAMVerifierConfig is the configuration for an IAMVerifier object.
+type IAMVerifierConfig struct {
+	// Region is the AWS region used to sign IAM requests, defaulting to that
+	// of the environment, or to the global IAM endpoint of the aws partition.
+	Region string
+
+	// Endpoint overrides the IAM API endpoint.
+	Endpoint string
+}
+
+// IAMVerifier is the Verifier and PermissionSetResolver looking up principals
+// with the IAM API.
+type IAMVerifier struct {
+	Client iamiface.IAMAPI
+
+	// STS looks up the account of the credentials, the only one whose
+	// principals IAM can look up.
+	STS stsiface.STSAPI
+
+	mu        sync.Mutex
+	accountID string
+}
+
+// NewIAMVerifier returns a new IAMVerifier using the AWS credentials of the
+// environment.
+func NewIAMVerifier(cfg *IAMVerifierConfig) (*IAMVerifier, error) {
+	awsConfig := aws.NewConfig()
+	if cfg.Region != "" {
+		awsConfig.WithRegion(cfg.Region)
+	}
+	if cfg.Endpoint != "" {
+		awsConfig.WithEndpoint(cfg.Endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.WithRegion("aws-global")
+	}
+	// The STS endpoint is not overridden by that of IAM.
+	return &IAMVerifier{Client: iam.New(sess), STS: sts.New(sess.Copy(&aws.Config{Endpoint: aws.String("")}))}, nil
+}
+
+// account returns the AWS account of the credentials, looking it up once.
+func (v *IAMVerifier) account(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.accountID == "" {
+		out, err := v.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", fmt.Errorf("failure getting caller identity: %w", err)
+		}
+		v.accountID = aws.StringValue(out.Account)
+	}
+	return v.accountID, nil
+}
+
+// UniqueID returns the unique ID of the IAM role or user with the ARN, or of
+// the role of an assumed-role ARN. IAM only looks up principals by name in the
+// account of the credentials, so principals of other accounts are
+// unverifiable.
+func (v *IAMVerifier) UniqueID(ctx context.Context, principalARN string) (string, error) {
+	parsed, err := arn.Parse(principalARN)
+	if err != nil {
+		return "", err
+	}
+	accountID, err := v.account(ctx)
+	if err != nil {
+		return "", err
+	}
+	if parsed.AccountID != accountID {
+		return "", fmt.Errorf("%w outside account %s: %s", ErrUnverifiable, accountID, principalARN)
+	}
+	var id, foundARN *string
+	if parsed.IsRole() {
+		out, err := v.Client.GetRoleWithContext(ctx, &iam.GetRoleInput{RoleName: aws.String(parsed.Name)})
+		if err != nil {
+			return "", iamError(principalARN, err)
+		}
+		id, foundARN = out.Role.RoleId, out.Role.Arn
+	} else {
+		out, err := v.Client.GetUserWithContext(ctx, &iam.GetUserInput{UserName: aws.String(parsed.Name)})
+		if err != nil {
+			return "", iamError(principalARN, err)
+		}
+		id, foundARN = out.User.UserId, out.User.Arn
+	}
+	if found, err := arn.Parse(aws.StringValue(foundARN)); err != nil || found.AccountID != parsed.AccountID {
+		return "", fmt.Errorf("%w in account %s: %s", ErrNotFound, parsed.AccountID, principalARN)
+	}
+	return aws.StringValue(id), nil
+}
+
+// iamError wraps ErrNotFound for IAM NoSuchEntity errors.
+func iamError(principalARN string, err error) error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == iam.ErrCodeNoSuchEntityException {
+		return fmt.Errorf("%w: %s", ErrNotFound, principalARN)
+	}
+	return err
+}
+
+// Static is a Verifier holding the unique IDs of principals by ARN, standing in
+// for IAM in tests and local development.
+type Static map[string]string
+
+// UniqueID returns the unique ID of the principal with the ARN.
+func (s Static) UniqueID(_ context.Context, principalARN string) (string, error) {
+	id, ok := s[principalARN]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, principalARN)
+	}
+	return id, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package principal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/onsi/gomega"
+)
+
+// fakeIAM is a local HTTP stand-in for the GetRole, GetUser and ListRoles
+// actions of an IAM endpoint, and the GetCallerIdentity action of STS.
+type fakeIAM struct {
+	roles     map[string]string
+	users     map[string]string
+	roleARNs  []string
+	listCalls []string
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var id, result string
+	var ok bool
+	switch r.Form.Get("Action") {
+	case "GetRole":
+		id, ok = f.roles[r.Form.Get("RoleName")]
+		result = fmt.Sprintf("<GetRoleResponse><GetRoleResult><Role><RoleId>%s</RoleId><RoleName>%s</RoleName><Arn>arn:aws:iam::123456789012:role/%[2]s</Arn></Role></GetRoleResult></GetRoleResponse>", id, r.Form.Get("RoleName"))
+	case "GetUser":
+		id, ok = f.users[r.Form.Get("UserName")]
+		result = fmt.Sprintf("<GetUserResponse><GetUserResult><User><UserId>%s</UserId><UserName>%s</UserName><Arn>arn:aws:iam::123456789012:user/%[2]s</Arn></User></GetUserResult></GetUserResponse>", id, r.Form.Get("UserName"))
+	case "GetCallerIdentity":
+		ok = true
+		result = "<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account></GetCallerIdentityResult></GetCallerIdentityResponse>"
+	case "ListRoles":
+		ok = true
+		f.listCalls = append(f.listCalls, r.Form.Get("PathPrefix"))
+		result = "<ListRolesResponse><ListRolesResult><IsTruncated>false</IsTruncated><Roles>"
+		for _, roleARN := range f.roleARNs {
+			result += fmt.Sprintf("<member><Arn>%s</Arn></member>", roleARN)
+		}
+		result += "</Roles></ListRolesResult></ListRolesResponse>"
+	default:
+		http.Error(w, "unsupported action", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		result = "<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>not found</Message></Error></ErrorResponse>"
+	}
+	_, _ = w.Write([]byte(result))
+}
+
+func TestIAMVerifier_UniqueID(t *testing.T) {
+	g := gomega.NewWithT(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	server := httptest.NewServer(&fakeIAM{
+		roles: map[string]string{"admin": "AROAEXAMPLEROLE"},
+		users: map[string]string{"alice": "AIDAEXAMPLEUSER"},
+	})
+	defer server.Close()
+
+	verifier, err := NewIAMVerifier(&IAMVerifierConfig{Endpoint: server.URL})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	verifier.STS = sts.New(session.Must(session.NewSession(aws.NewConfig().WithEndpoint(server.URL).WithRegion("us-east-1"))))
+	ctx := context.Background()
+
+	id, err := verifier.UniqueID(ctx, "arn:aws:iam::123456789012:role/path/admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(id).To(gomega.Equal("AROAEXAMPLEROLE"))
+
+	id, err = verifier.UniqueID(ctx, "arn:aws:iam::123456789012:user/alice")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(id).To(gomega.Equal("AIDAEXAMPLEUSER"))
+
+	_, err = verifier.UniqueID(ctx, "arn:aws:iam::123456789012:role/missing")
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeTrue())
+
+	// Principals of other accounts cannot be looked up, even if a principal
+	// of the account of the credentials has the same name.
+	_, err = verifier.UniqueID(ctx, "arn:aws:iam::999999999999:role/admin")
+	g.Expect(errors.Is(err, ErrUnverifiable)).To(gomega.BeTrue())
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeFalse())
+	_, err = verifier.UniqueID(ctx, "arn:aws:iam::999999999999:role/missing")
+	g.Expect(errors.Is(err, ErrUnverifiable)).To(gomega.BeTrue())
+
+	// Assumed-role ARNs are verified by their role.
+	id, err = verifier.UniqueID(ctx, "arn:aws:sts::123456789012:assumed-role/admin/session")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(id).To(gomega.Equal("AROAEXAMPLEROLE"))
+
+	_, err = verifier.UniqueID(ctx, "arn:aws:iam::123456789012:group/admins")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeFalse())
+}
+
+func TestStatic_UniqueID(t *testing.T) {
+	g := gomega.NewWithT(t)
+	verifier := Static{"arn:aws:iam::123456789012:role/admin": "AROAEXAMPLEROLE"}
+
+	id, err := verifier.UniqueID(context.Background(), "arn:aws:iam::123456789012:role/admin")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(id).To(gomega.Equal("AROAEXAMPLEROLE"))
+
+	_, err = verifier.UniqueID(context.Background(), "arn:aws:iam::123456789012:role/other")
+	g.Expect(errors.Is(err, ErrNotFound)).To(gomega.BeTrue())
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing configures the export of the OpenTelemetry traces of the
+// operator, and defines the attributes of its spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// ServiceName is the OpenTelemetry service name of the operator.
+const ServiceName = "aws-auth-operator"
+
+// Attributes of the spans of the operator.
+const (
+	// KindKey is the kind of the object being reconciled.
+	KindKey = attribute.Key("aws-auth.kind")
+
+	// NamespaceKey is the namespace of the object being reconciled.
+	NamespaceKey = attribute.Key("aws-auth.namespace")
+
+	// NameKey is the name of the object being reconciled.
+	NameKey = attribute.Key("aws-auth.name")
+
+	// OperationKey is the aws-auth operation, upsert or remove.
+	OperationKey = attribute.Key("aws-auth.operation")
+
+	// DataTypeKey is the aws-auth section of the operation, mapRole or mapUser.
+	DataTypeKey = attribute.Key("aws-auth.data_type")
+
+	// UsernameKey is the aws-auth username of the operation.
+	UsernameKey = attribute.Key("aws-auth.username")
+
+	// ARNKey is the ARN of the IAM principal of the operation.
+	ARNKey = attribute.Key("aws-auth.arn")
+
+	// RetryAttemptKey is the attempt number of a retried operation, from zero.
+	RetryAttemptKey = attribute.Key("aws-auth.retry.attempt")
+
+	// BatchSizeKey is the number of operations applied by a batched update.
+	BatchSizeKey = attribute.Key("aws-auth.batch.size")
+)
+
+// Exporter identifies where traces are exported.
+type Exporter string
+
+const (
+	// NoExporter discards traces.
+	NoExporter Exporter = "none"
+
+	// StdoutExporter writes traces to standard output as JSON.
+	StdoutExporter Exporter = "stdout"
+
+	// OTLPExporter sends traces to an OTLP gRPC endpoint.
+	OTLPExporter Exporter = "otlp"
+)
+
+// Config is the configuration of the export of traces.
+type Config struct {
+	Exporter Exporter
+
+	// Endpoint is the OTLP endpoint, defaulting to that of the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable or localhost:4317.
+	Endpoint string
+
+	// Insecure disables TLS with the OTLP endpoint.
+	Insecure bool
+
+	// Writer overrides standard output for the stdout exporter.
+	Writer io.Writer
+}
+
+// Setup registers the global OpenTelemetry tracer provider exporting traces
+// as configured, leaving the default no-op provider with NoExporter. It
+// returns a function flushing and stopping the export.
+func Setup(ctx context.Context, cfg *Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", NoExporter:
+		return func(context.Context) error { return nil }, nil
+	case StdoutExporter:
+		var opts []stdouttrace.Option
+		if cfg.Writer != nil {
+			opts = append(opts, stdouttrace.WithWriter(cfg.Writer))
+		}
+		exporter, err = stdouttrace.New(opts...)
+	case OTLPExporter:
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %s", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
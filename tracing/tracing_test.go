@@ -0,0 +1,51 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	provider := otel.GetTracerProvider()
+	shutdown, err := Setup(ctx, &Config{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(otel.GetTracerProvider()).To(gomega.BeIdenticalTo(provider))
+	g.Expect(shutdown(ctx)).To(gomega.Succeed())
+
+	_, err = Setup(ctx, &Config{Exporter: "zipkin"})
+	g.Expect(err).To(gomega.MatchError("unknown tracing exporter zipkin"))
+
+	var out bytes.Buffer
+	shutdown, err = Setup(ctx, &Config{Exporter: StdoutExporter, Writer: &out})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	_, span := otel.Tracer("test").Start(ctx, "MapRole.Reconcile")
+	span.SetAttributes(NameKey.String("admin"))
+	span.End()
+	g.Expect(shutdown(ctx)).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.ContainSubstring(`"Name":"MapRole.Reconcile"`))
+	g.Expect(out.String()).To(gomega.ContainSubstring(`"aws-auth.name"`))
+	g.Expect(out.String()).To(gomega.ContainSubstring(ServiceName))
+}